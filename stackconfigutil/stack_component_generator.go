@@ -0,0 +1,527 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+)
+
+const (
+	componentsFileName        = `components.tfcomponent.hcl`
+	providersFileName         = `providers.tfcomponent.hcl`
+	variablesFileName         = `variables.tfcomponent.hcl`
+	outputsFileName           = `outputs.tfcomponent.hcl`
+	defaultProviderConfigName = `default`
+)
+
+// variableArguments lists the variable block arguments copied verbatim into stack variables, in output order.
+var variableArguments = []string{"type", "default", "description", "sensitive", "ephemeral", "nullable"}
+
+// outputArguments lists the output block arguments copied verbatim into stack outputs, in output order.
+var outputArguments = []string{"description", "sensitive", "ephemeral"}
+
+// GenerateComponentConfigRequest represents the request parameters for generating stack component configuration
+// from a modularised Terraform root module.
+type GenerateComponentConfigRequest struct {
+	TerraformConfigFilesAbsPath string // TerraformConfigFilesAbsPath is the absolute path to the directory containing the root module.
+	StackSourceBundleAbsPath    string // StackSourceBundleAbsPath is the output directory, defaults to _stacks_generated in the root module directory.
+	StateFilePath               string // StateFilePath is an optional path to the workspace state file, used to derive the types of stack outputs and the provider wiring.
+	ProviderSets                bool   // ProviderSets groups the aliased configurations of a provider into a single provider block using for_each where possible.
+
+	// RemoteStateProducers lists where the workspaces the root module reads through terraform_remote_state have been
+	// migrated to, so the references to those data sources can be translated into component or linked stack references.
+	RemoteStateProducers []RemoteStateProducer
+}
+
+// stackProviderRef identifies a provider block in the stack configuration, for example provider "aws" "east".
+// Key selects an element of a provider block that uses for_each.
+type stackProviderRef struct {
+	LocalName  string
+	ConfigName string
+	Key        string
+}
+
+// Traversal returns the reference to the stack provider configuration, for example provider.aws.east
+// or provider.aws.aliases["east"].
+func (p stackProviderRef) Traversal() hcl.Traversal {
+	traversal := hcl.Traversal{
+		hcl.TraverseRoot{Name: "provider"},
+		hcl.TraverseAttr{Name: p.LocalName},
+		hcl.TraverseAttr{Name: p.ConfigName},
+	}
+	if p.Key != "" {
+		traversal = append(traversal, hcl.TraverseIndex{Key: cty.StringVal(p.Key)})
+	}
+	return traversal
+}
+
+// stackProviderRefForAddr converts a classic provider configuration address such as "aws" or "aws.east"
+// into the matching stack provider configuration.
+func stackProviderRefForAddr(addr string) stackProviderRef {
+	localName, alias, found := strings.Cut(addr, ".")
+	if !found {
+		alias = defaultProviderConfigName
+	}
+	return stackProviderRef{LocalName: localName, ConfigName: alias}
+}
+
+// GenerateComponentConfig reads the module, provider, variable and output blocks of a modularised root module and
+// writes the equivalent stack configuration as .tfcomponent.hcl files. Each module block becomes a component with
+// the same name, so the generated configuration satisfies WorkspaceToStackAddressMap for the workspace state.
+func (s *stackConfigUtility) GenerateComponentConfig(request GenerateComponentConfigRequest) (*GeneratedStackConfig, error) {
+	root, err := tfconfigutil.LoadModule(s.hclParser, request.TerraformConfigFilesAbsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Terraform configuration, err: %v", err)
+	}
+
+	if len(root.ModuleCalls) == 0 {
+		return nil, fmt.Errorf("no module blocks found in %s", request.TerraformConfigFilesAbsPath)
+	}
+
+	// resources in the root module would not be part of any component
+	if len(root.ManagedResources) > 0 {
+		return nil, fmt.Errorf("the Terraform configuration is not fully modular, found root module resources %v", tfconfigutil.SortedKeys(root.ManagedResources))
+	}
+
+	outputDir := request.StackSourceBundleAbsPath
+	if outputDir == "" {
+		outputDir = filepath.Join(request.TerraformConfigFilesAbsPath, stackSourceBundleDirName)
+	}
+
+	result := &GeneratedStackConfig{Dir: outputDir}
+
+	linker, err := newRemoteStateLinker(root, request.RemoteStateProducers)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = append(result.Warnings, linker.warnings...)
+
+	for _, addr := range tfconfigutil.SortedKeys(root.DataResources) {
+		if root.DataResources[addr].Type == remoteStateDataSourceType {
+			// the linker translates the references to remote states, or lists their workspaces as pending
+			continue
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("data source %s in the root module is not migrated, move it into a module or replace its references", addr))
+	}
+
+	writeFiles, err := parseWriteFiles(root.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := readOptionalState(request.StateFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var outputTypes map[string]*tfstateutil.WorkspaceStateOutput
+	if state != nil {
+		outputTypes = state.Outputs
+	}
+
+	children, nested, warnings, err := s.loadModuleCalls(root)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = append(result.Warnings, warnings...)
+	for _, name := range tfconfigutil.SortedKeys(children) {
+		sources, _ := findRemoteStateSources(children[name])
+		for _, source := range sources {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("module %s reads %s, move the data source into the root module so it can be translated into a component or linked stack reference", name, source.Resource.Addr()))
+		}
+	}
+
+	files := make(map[string]*hclwrite.File)
+	usedProviders := make(map[stackProviderRef]struct{})
+	resolver := &providerRefResolver{}
+	if request.ProviderSets {
+		resolver.sets = findProviderSets(root)
+	}
+
+	translator := newExprTranslator(root)
+	translator.remoteStates = linker
+
+	componentsFile := hclwrite.NewEmptyFile()
+	for i, name := range tfconfigutil.SortedKeys(root.ModuleCalls) {
+		if i > 0 {
+			componentsFile.Body().AppendNewline()
+		}
+		warnings, diags, err := generateComponentBlock(componentsFile.Body(), root, children[name], nested[name], root.ModuleCalls[name], state, writeFiles, translator, resolver, outputDir, usedProviders)
+		if err != nil {
+			return nil, err
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+		result.Diagnostics = append(result.Diagnostics, diags...)
+		result.Components = append(result.Components, name)
+	}
+	files[componentsFileName] = componentsFile
+
+	providersFile, diags, err := generateProvidersFile(root, children, translator, resolver, usedProviders)
+	if err != nil {
+		return nil, err
+	}
+	result.Diagnostics = append(result.Diagnostics, diags...)
+	files[providersFileName] = providersFile
+
+	if len(root.Outputs) > 0 {
+		outputsFile := hclwrite.NewEmptyFile()
+		for i, name := range tfconfigutil.SortedKeys(root.Outputs) {
+			if i > 0 {
+				outputsFile.Body().AppendNewline()
+			}
+			diags, err := generateOutputBlock(outputsFile.Body(), root, root.Outputs[name], writeFiles, translator, outputTypes[name])
+			if err != nil {
+				return nil, err
+			}
+			result.Diagnostics = append(result.Diagnostics, diags...)
+		}
+		files[outputsFileName] = outputsFile
+	}
+
+	// the outputs are translated first, they may declare variables for the outputs of linked stacks
+	if len(root.Variables) > 0 || len(linker.variables) > 0 {
+		variablesFile := hclwrite.NewEmptyFile()
+		for i, name := range tfconfigutil.SortedKeys(root.Variables) {
+			if i > 0 {
+				variablesFile.Body().AppendNewline()
+			}
+			generateVariableBlock(variablesFile.Body(), root, root.Variables[name], writeFiles)
+		}
+		linker.generateVariableBlocks(variablesFile.Body())
+		files[variablesFileName] = variablesFile
+	}
+
+	if upstreamInputsFile := linker.generateUpstreamInputsFile(); upstreamInputsFile != nil {
+		files[upstreamInputsFileName] = upstreamInputsFile
+	}
+
+	result.Files, err = writeGeneratedFiles(outputDir, files)
+	if err != nil {
+		return nil, err
+	}
+
+	publishOutputsFiles := linker.generatePublishOutputsFiles()
+	for _, upstream := range tfconfigutil.SortedKeys(publishOutputsFiles) {
+		dir := filepath.Join(linkedStacksDirName, upstream)
+		written, err := writeGeneratedFiles(filepath.Join(outputDir, dir), map[string]*hclwrite.File{publishOutputsFileName: publishOutputsFiles[upstream]})
+		if err != nil {
+			return nil, err
+		}
+		for name, content := range written {
+			result.Files[filepath.ToSlash(filepath.Join(dir, name))] = content
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("copy %s into the deployment configuration of the linked stack read through upstream_input %s", filepath.ToSlash(filepath.Join(dir, publishOutputsFileName)), upstream))
+	}
+
+	result.Links = linker.Links()
+	result.PendingProducers = linker.PendingProducers()
+
+	return result, nil
+}
+
+// loadModuleCalls loads the source of every module called from the root module, together with the provider
+// configurations the modules nested in each of them need. Modules whose source is not available locally are
+// reported as warnings.
+func (s *stackConfigUtility) loadModuleCalls(root *tfconfigutil.Module) (map[string]*tfconfigutil.Module, map[string]map[string]struct{}, []string, error) {
+	children := make(map[string]*tfconfigutil.Module)
+	nested := make(map[string]map[string]struct{})
+	var warnings []string
+	for _, name := range tfconfigutil.SortedKeys(root.ModuleCalls) {
+		childDir, ok := tfconfigutil.ResolveModuleCallDir(root.Dir, root.ModuleCalls[name])
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("source of module %s is not available locally, run terraform init to resolve its providers", name))
+			continue
+		}
+		child, err := tfconfigutil.LoadModule(s.hclParser, childDir)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load module %s, err: %v", name, err)
+		}
+		children[name] = child
+
+		configs, nestedWarnings, err := s.nestedProviderConfigs(child, "module."+name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		nested[name] = configs
+		warnings = append(warnings, nestedWarnings...)
+	}
+	return children, nested, warnings, nil
+}
+
+// generateComponentBlock appends the component block equivalent to the given module call.
+// The diagnostics report the references in the module arguments that could not be translated.
+func generateComponentBlock(body *hclwrite.Body, root *tfconfigutil.Module, child *tfconfigutil.Module, nested map[string]struct{}, moduleCall *tfconfigutil.ModuleCall, state *tfstateutil.WorkspaceState, writeFiles map[string]*hclwrite.File, translator *exprTranslator, resolver *providerRefResolver, outputDir string, usedProviders map[stackProviderRef]struct{}) ([]string, hcl.Diagnostics, error) {
+	var warnings []string
+	var diags hcl.Diagnostics
+
+	if findWriteBlock(root.Files, writeFiles, moduleCall.DeclRange, "module", []string{moduleCall.Name}) == nil {
+		return nil, nil, fmt.Errorf("module %s must be declared in native HCL syntax", moduleCall.Name)
+	}
+
+	source := moduleCall.Source
+	if tfconfigutil.IsLocalModuleSource(source) {
+		relSource, err := filepath.Rel(outputDir, filepath.Join(root.Dir, source))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve source of module %s: %w", moduleCall.Name, err)
+		}
+		source = filepath.ToSlash(relSource)
+		if !strings.HasPrefix(source, "../") {
+			source = "./" + source
+		}
+	}
+
+	component := body.AppendNewBlock("component", []string{moduleCall.Name})
+	component.Body().SetAttributeValue("source", cty.StringVal(source))
+	if moduleCall.Version != "" {
+		component.Body().SetAttributeValue("version", cty.StringVal(moduleCall.Version))
+	}
+
+	if moduleCall.ForEach != nil {
+		tokens, exprDiags := translator.Translate(moduleCall.ForEach, false)
+		diags = append(diags, exprDiags...)
+		component.Body().SetAttributeRaw("for_each", tokens)
+	}
+	if moduleCall.Count != nil {
+		warnings = append(warnings, fmt.Sprintf("module %s uses count, which components do not support, convert it to for_each", moduleCall.Name))
+	}
+
+	// keep the inputs in the order they were declared in
+	inputNames := make([]string, 0, len(moduleCall.Inputs))
+	for name := range moduleCall.Inputs {
+		inputNames = append(inputNames, name)
+	}
+	sort.Slice(inputNames, func(i, j int) bool {
+		return moduleCall.Inputs[inputNames[i]].Range.Start.Byte < moduleCall.Inputs[inputNames[j]].Range.Start.Byte
+	})
+
+	var inputs []hclwrite.ObjectAttrTokens
+	for _, name := range inputNames {
+		tokens, exprDiags := translator.Translate(moduleCall.Inputs[name].Expr, moduleCall.ForEach != nil)
+		diags = append(diags, exprDiags...)
+		inputs = append(inputs, hclwrite.ObjectAttrTokens{
+			Name:  hclwrite.TokensForIdentifier(name),
+			Value: tokens,
+		})
+	}
+	component.Body().SetAttributeRaw("inputs", hclwrite.TokensForObject(inputs))
+
+	analysis := analyzeComponentProviders(root, moduleCall, child, nested, state)
+	warnings = append(warnings, analysis.Warnings...)
+
+	var providers []hclwrite.ObjectAttrTokens
+	for _, inChild := range tfconfigutil.SortedKeys(analysis.Configs) {
+		ref := resolver.Ref(analysis.Configs[inChild])
+		usedProviders[ref] = struct{}{}
+		providers = append(providers, hclwrite.ObjectAttrTokens{
+			Name:  hclwrite.TokensForTraversal(localProviderTraversal(inChild)),
+			Value: hclwrite.TokensForTraversal(ref.Traversal()),
+		})
+	}
+	component.Body().SetAttributeRaw("providers", hclwrite.TokensForObject(providers))
+
+	var dependsOn []hclwrite.Tokens
+	for _, traversal := range moduleCall.DependsOn {
+		if traversal.RootName() != "module" || len(traversal) < 2 {
+			warnings = append(warnings, fmt.Sprintf("module %s depends on %s, which has no equivalent in a stack", moduleCall.Name, tfconfigutil.TraversalString(traversal)))
+			continue
+		}
+		dependsOn = append(dependsOn, hclwrite.TokensForTraversal(hcl.Traversal{
+			hcl.TraverseRoot{Name: "component"},
+			traversal[1],
+		}))
+	}
+	if len(dependsOn) > 0 {
+		component.Body().SetAttributeRaw("depends_on", hclwrite.TokensForTuple(dependsOn))
+	}
+
+	return warnings, diags, nil
+}
+
+// generateProvidersFile builds the required_providers block and one provider block for every provider
+// configuration declared in the root module or used by a component. The diagnostics report the references in the
+// provider configurations that could not be translated.
+func generateProvidersFile(root *tfconfigutil.Module, children map[string]*tfconfigutil.Module, translator *exprTranslator, resolver *providerRefResolver, usedProviders map[stackProviderRef]struct{}) (*hclwrite.File, hcl.Diagnostics, error) {
+	refs := make(map[stackProviderRef]*tfconfigutil.ProviderConfig)
+	for ref := range usedProviders {
+		if ref.Key != "" {
+			// elements of a provider set share the provider block written for the set
+			ref = stackProviderRef{LocalName: ref.LocalName, ConfigName: ref.ConfigName}
+		}
+		refs[ref] = nil
+	}
+	for addr, providerConfig := range root.ProviderConfigs {
+		ref := resolver.Ref(addr)
+		if ref.Key != "" {
+			refs[stackProviderRef{LocalName: ref.LocalName, ConfigName: ref.ConfigName}] = nil
+			continue
+		}
+		refs[ref] = providerConfig
+	}
+
+	sortedRefs := make([]stackProviderRef, 0, len(refs))
+	localNames := make(map[string]struct{})
+	for ref := range refs {
+		sortedRefs = append(sortedRefs, ref)
+		localNames[ref.LocalName] = struct{}{}
+	}
+	sort.Slice(sortedRefs, func(i, j int) bool {
+		if sortedRefs[i].LocalName != sortedRefs[j].LocalName {
+			return sortedRefs[i].LocalName < sortedRefs[j].LocalName
+		}
+		return sortedRefs[i].ConfigName < sortedRefs[j].ConfigName
+	})
+
+	file := hclwrite.NewEmptyFile()
+	requiredProviders := file.Body().AppendNewBlock("required_providers", nil)
+	for _, localName := range tfconfigutil.SortedKeys(localNames) {
+		source, version := requiredProviderFor(localName, root, children)
+		attrs := []hclwrite.ObjectAttrTokens{
+			{Name: hclwrite.TokensForIdentifier("source"), Value: hclwrite.TokensForValue(cty.StringVal(source))},
+		}
+		if version != "" {
+			attrs = append(attrs, hclwrite.ObjectAttrTokens{Name: hclwrite.TokensForIdentifier("version"), Value: hclwrite.TokensForValue(cty.StringVal(version))})
+		}
+		requiredProviders.Body().SetAttributeRaw(localName, hclwrite.TokensForObject(attrs))
+	}
+
+	var diags hcl.Diagnostics
+	for _, ref := range sortedRefs {
+		file.Body().AppendNewline()
+		if set, ok := resolver.sets[ref.LocalName]; ok && ref.ConfigName == providerSetConfigName {
+			setDiags, err := generateProviderSetBlock(file.Body(), translator, set)
+			if err != nil {
+				return nil, nil, err
+			}
+			diags = append(diags, setDiags...)
+			continue
+		}
+		provider := file.Body().AppendNewBlock("provider", []string{ref.LocalName, ref.ConfigName})
+		config := provider.Body().AppendNewBlock("config", nil)
+
+		providerConfig := refs[ref]
+		if providerConfig == nil {
+			continue
+		}
+
+		providerBlock := findSyntaxBlock(root.Files, providerConfig.DeclRange, "provider", []string{providerConfig.Name})
+		if providerBlock == nil {
+			return nil, nil, fmt.Errorf("provider %s must be declared in native HCL syntax", providerConfig.Addr())
+		}
+		src, configDiags := translator.TranslateBlockBody(providerBlock)
+		diags = append(diags, configDiags...)
+		configFile, parseDiags := hclwrite.ParseConfig([]byte(src), providerConfig.DeclRange.Filename, hcl.InitialPos)
+		if parseDiags.HasErrors() {
+			return nil, nil, fmt.Errorf("failed to parse translated provider %s, err: %v", providerConfig.Addr(), parseDiags.Error())
+		}
+		configFile.Body().RemoveAttribute("alias")
+		configFile.Body().RemoveAttribute("version")
+		config.Body().AppendUnstructuredTokens(trimLeadingNewlines(configFile.Body().BuildTokens(nil)))
+	}
+
+	return file, diags, nil
+}
+
+// requiredProviderFor returns the source address and version constraint for a provider local name,
+// preferring the root module's required_providers over those of the child modules.
+func requiredProviderFor(localName string, root *tfconfigutil.Module, children map[string]*tfconfigutil.Module) (string, string) {
+	if requiredProvider, ok := root.RequiredProviders[localName]; ok && requiredProvider.Source != "" {
+		return requiredProvider.Source, requiredProvider.Requirement
+	}
+
+	for _, name := range tfconfigutil.SortedKeys(children) {
+		if requiredProvider, ok := children[name].RequiredProviders[localName]; ok && requiredProvider.Source != "" {
+			return requiredProvider.Source, requiredProvider.Requirement
+		}
+	}
+
+	source := strings.TrimPrefix(tfconfigutil.NormalizeProviderSource(localName), "registry.terraform.io/")
+	if requiredProvider, ok := root.RequiredProviders[localName]; ok {
+		return source, requiredProvider.Requirement
+	}
+	return source, ""
+}
+
+// generateVariableBlock appends the stack variable equivalent to the given root module variable.
+func generateVariableBlock(body *hclwrite.Body, root *tfconfigutil.Module, variable *tfconfigutil.Variable, writeFiles map[string]*hclwrite.File) {
+	block := body.AppendNewBlock("variable", []string{variable.Name})
+	source := findWriteBlock(root.Files, writeFiles, variable.DeclRange, "variable", []string{variable.Name})
+
+	for _, name := range variableArguments {
+		if source == nil {
+			break
+		}
+		if attr := source.Body().GetAttribute(name); attr != nil {
+			block.Body().SetAttributeRaw(name, attr.Expr().BuildTokens(nil))
+		}
+	}
+
+	// stack variables must always declare a type
+	if block.Body().GetAttribute("type") == nil {
+		block.Body().SetAttributeRaw("type", hclwrite.TokensForIdentifier("any"))
+	}
+}
+
+// generateOutputBlock appends the stack output equivalent to the given root module output.
+// The diagnostics report the references in the output value that could not be translated.
+func generateOutputBlock(body *hclwrite.Body, root *tfconfigutil.Module, output *tfconfigutil.Output, writeFiles map[string]*hclwrite.File, translator *exprTranslator, stateOutput *tfstateutil.WorkspaceStateOutput) (hcl.Diagnostics, error) {
+	source := findWriteBlock(root.Files, writeFiles, output.DeclRange, "output", []string{output.Name})
+	if source == nil {
+		return nil, fmt.Errorf("output %s must be declared in native HCL syntax", output.Name)
+	}
+
+	block := body.AppendNewBlock("output", []string{output.Name})
+
+	// stack outputs must always declare a type, which only the state can tell us
+	typeTokens := hclwrite.TokensForIdentifier("any")
+	if stateOutput != nil && len(stateOutput.Type) > 0 {
+		ty, err := ctyjson.UnmarshalType(stateOutput.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the type of output %s: %w", output.Name, err)
+		}
+		typeTokens, err = rawExprTokens(typeexpr.TypeString(ty))
+		if err != nil {
+			return nil, err
+		}
+	}
+	block.Body().SetAttributeRaw("type", typeTokens)
+	valueTokens, diags := translator.Translate(output.Expr, false)
+	block.Body().SetAttributeRaw("value", valueTokens)
+
+	for _, name := range outputArguments {
+		if attr := source.Body().GetAttribute(name); attr != nil {
+			block.Body().SetAttributeRaw(name, attr.Expr().BuildTokens(nil))
+		}
+	}
+
+	return diags, nil
+}
+
+// rawExprTokens parses the given expression source into hclwrite tokens.
+func rawExprTokens(src string) (hclwrite.Tokens, error) {
+	file, diags := hclwrite.ParseConfig([]byte("expr = "+src+"\n"), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse expression %q: %v", src, diags.Error())
+	}
+	return file.Body().GetAttribute("expr").Expr().BuildTokens(nil), nil
+}
+
+// trimLeadingNewlines drops the newline tokens at the start of a copied block body.
+func trimLeadingNewlines(tokens hclwrite.Tokens) hclwrite.Tokens {
+	for len(tokens) > 0 && tokens[0].Type == hclsyntax.TokenNewline {
+		tokens = tokens[1:]
+	}
+	return tokens
+}
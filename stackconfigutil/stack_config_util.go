@@ -0,0 +1,149 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+const (
+	stackSourceBundleDirName = `_stacks_generated`
+)
+
+type stackConfigUtility struct {
+	ctx       context.Context
+	hclParser *hclparse.Parser
+}
+
+// StackConfigUtility defines the interface for utility functions that generate Terraform Stacks configuration
+// from classic Terraform configuration.
+type StackConfigUtility interface {
+	AnalyzeComponentProviders(request GenerateComponentConfigRequest) ([]*ComponentProviders, error)
+	GenerateComponentConfig(request GenerateComponentConfigRequest) (*GeneratedStackConfig, error)
+	GenerateDeploymentConfig(request GenerateDeploymentConfigRequest) (*GeneratedStackConfig, error)
+	MergeWorkspaceConfigs(request MergeWorkspacesRequest) (*GeneratedStackConfig, error)
+}
+
+// NewStackConfigUtility creates a new instance of stackConfigUtility with the provided context.
+func NewStackConfigUtility(ctx context.Context) StackConfigUtility {
+	return &stackConfigUtility{
+		ctx:       ctx,
+		hclParser: hclparse.NewParser(),
+	}
+}
+
+// GeneratedStackConfig holds the stack configuration files produced by a generator.
+type GeneratedStackConfig struct {
+	Dir              string             // Dir is the directory the files were written to.
+	Files            map[string][]byte  // Files maps each generated file name to its formatted content.
+	Components       []string           // Components lists the names of the generated components.
+	Deployments      map[string]string  // Deployments maps each source workspace name to the name of its generated deployment.
+	Links            []*RemoteStateLink // Links lists the terraform_remote_state data sources replaced by component or linked stack references.
+	PendingProducers []string           // PendingProducers lists the workspaces read through terraform_remote_state that have not been migrated yet.
+	Warnings         []string           // Warnings lists the constructs that could not be translated automatically.
+	Diagnostics      hcl.Diagnostics    // Diagnostics point at the source ranges of the expressions that could not be translated.
+}
+
+// writeGeneratedFiles formats and writes the generated files into the given directory, creating it if needed.
+func writeGeneratedFiles(dir string, files map[string]*hclwrite.File) (map[string][]byte, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	written := make(map[string][]byte)
+	for name, file := range files {
+		content := hclwrite.Format(file.Bytes())
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write file %s: %w", name, err)
+		}
+		written[name] = content
+	}
+
+	return written, nil
+}
+
+// parseWriteFiles parses the native syntax files of a module again with hclwrite so that
+// expressions can be copied into the generated configuration without losing their formatting.
+func parseWriteFiles(files map[string]*hcl.File) (map[string]*hclwrite.File, error) {
+	parsed := make(map[string]*hclwrite.File)
+	for filename, file := range files {
+		if filepath.Ext(filename) != ".tf" {
+			continue
+		}
+		writeFile, diags := hclwrite.ParseConfig(file.Bytes, filename, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse HCL file %s, err: %v", filename, diags.Error())
+		}
+		parsed[filename] = writeFile
+	}
+	return parsed, nil
+}
+
+// findWriteBlock returns the hclwrite block of the given type and labels that is declared at declRange,
+// or nil if there is none.
+func findWriteBlock(files map[string]*hcl.File, writeFiles map[string]*hclwrite.File, declRange hcl.Range, blockType string, labels []string) *hclwrite.Block {
+	file, ok := files[declRange.Filename]
+	if !ok {
+		return nil
+	}
+	writeFile, ok := writeFiles[declRange.Filename]
+	if !ok {
+		return nil
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	// blocks with the same type and labels, such as aliased provider configurations,
+	// can only be told apart by their position, which hclwrite preserves
+	index := -1
+	count := 0
+	for _, block := range body.Blocks {
+		if block.Type != blockType || !equalLabels(block.Labels, labels) {
+			continue
+		}
+		if block.DefRange().Start.Byte == declRange.Start.Byte {
+			index = count
+			break
+		}
+		count++
+	}
+	if index < 0 {
+		return nil
+	}
+
+	count = 0
+	for _, block := range writeFile.Body().Blocks() {
+		if block.Type() != blockType || !equalLabels(block.Labels(), labels) {
+			continue
+		}
+		if count == index {
+			return block
+		}
+		count++
+	}
+
+	return nil
+}
+
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,369 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	deploymentsFileName    = `deployments.tfdeploy.hcl`
+	stackComponentFileGlob = `*.tfcomponent.hcl`
+	defaultVarFileName     = `terraform.tfvars`
+	defaultVarJSONFileName = `terraform.tfvars.json`
+	autoVarFileGlob        = `*.auto.tfvars`
+	autoVarJSONFileGlob    = `*.auto.tfvars.json`
+	envVariablePrefix      = `TF_VAR_`
+	varsetStoreType        = `varset`
+	varsetStoreCategory    = `terraform`
+	varsetIDPlaceholder    = `varset-REPLACE_ME`
+	invalidIdentifierChars = `[^a-zA-Z0-9_-]`
+	deploymentNameFallback = `deployment`
+)
+
+// SensitiveInputMode selects how sensitive deployment inputs are written.
+type SensitiveInputMode string
+
+const (
+	// SensitiveInputStore references sensitive values through a varset store block, one per deployment.
+	SensitiveInputStore SensitiveInputMode = "store"
+	// SensitiveInputVariable references sensitive values through deployment variables supplied at plan time.
+	SensitiveInputVariable SensitiveInputMode = "variable"
+)
+
+// WorkspaceVariables describes where the variable values of a single workspace come from.
+type WorkspaceVariables struct {
+	Name         string   // Name is the workspace name, the deployment is named after it.
+	ConfigDir    string   // ConfigDir is the directory terraform.tfvars and *.auto.tfvars files are loaded from.
+	VarFilePaths []string // VarFilePaths lists additional variable files, in the order they would be passed with -var-file.
+	Environment  []string // Environment lists KEY=VALUE pairs, TF_VAR_ entries are used as variable values. Pass os.Environ() to use the current environment.
+	VarsetID     string   // VarsetID is the ID of the variable set holding the sensitive values, used with SensitiveInputStore.
+}
+
+// GenerateDeploymentConfigRequest represents the request parameters for generating stack deployment configuration
+// from the variable values of one or more workspaces.
+type GenerateDeploymentConfigRequest struct {
+	Workspaces               []WorkspaceVariables // Workspaces lists the workspaces to generate one deployment for each.
+	StackSourceBundleAbsPath string               // StackSourceBundleAbsPath is the stack configuration directory the deployments file is written to.
+	SensitiveInputs          SensitiveInputMode   // SensitiveInputs selects how sensitive inputs are written, defaults to SensitiveInputStore.
+	UpstreamInputs           map[string]string    // UpstreamInputs maps stack variables to the upstream_input references every deployment passes into them, see RemoteStateLink.Variables.
+}
+
+// stackVariable represents a variable block of a stack configuration.
+type stackVariable struct {
+	Name      string
+	Type      cty.Type
+	Sensitive bool
+}
+
+// GenerateDeploymentConfig reads the *.tfvars, *.auto.tfvars and TF_VAR_* values of each workspace and writes a
+// deployment block for each of them, named after the workspace. Values of sensitive stack variables are never written
+// as literals, they are referenced through a varset store or a deployment variable instead.
+func (s *stackConfigUtility) GenerateDeploymentConfig(request GenerateDeploymentConfigRequest) (*GeneratedStackConfig, error) {
+	if len(request.Workspaces) == 0 {
+		return nil, fmt.Errorf("no workspaces to generate deployments for")
+	}
+
+	mode := request.SensitiveInputs
+	if mode == "" {
+		mode = SensitiveInputStore
+	}
+	if mode != SensitiveInputStore && mode != SensitiveInputVariable {
+		return nil, fmt.Errorf("unsupported sensitive input mode %q", mode)
+	}
+
+	variables, err := s.loadStackVariables(request.StackSourceBundleAbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GeneratedStackConfig{
+		Dir:         request.StackSourceBundleAbsPath,
+		Deployments: make(map[string]string),
+	}
+
+	file := hclwrite.NewEmptyFile()
+	sensitiveVariables := make(map[string]*stackVariable)
+	deploymentNames := make(map[string]string)
+
+	for i, workspace := range request.Workspaces {
+		deploymentName := deploymentNameForWorkspace(workspace.Name)
+		if other, ok := deploymentNames[deploymentName]; ok {
+			return nil, fmt.Errorf("workspaces %s and %s both map to the deployment name %s", other, workspace.Name, deploymentName)
+		}
+		deploymentNames[deploymentName] = workspace.Name
+		result.Deployments[workspace.Name] = deploymentName
+
+		values, warnings, err := s.loadWorkspaceVariableValues(workspace, variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load variable values of workspace %s: %w", workspace.Name, err)
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+		for name := range request.UpstreamInputs {
+			if _, ok := values[name]; ok {
+				delete(values, name)
+				result.Warnings = append(result.Warnings, fmt.Sprintf("workspace %s sets %s, which deployment %s reads from a linked stack instead", workspace.Name, name, deploymentName))
+			}
+		}
+
+		var inputs []hclwrite.ObjectAttrTokens
+		var sensitiveNames []string
+		for _, name := range tfconfigutil.SortedKeys(values) {
+			value := hclwrite.TokensForValue(values[name])
+			if variables[name].Sensitive {
+				sensitiveNames = append(sensitiveNames, name)
+				if mode == SensitiveInputStore {
+					value = hclwrite.TokensForTraversal(hcl.Traversal{
+						hcl.TraverseRoot{Name: "store"},
+						hcl.TraverseAttr{Name: varsetStoreType},
+						hcl.TraverseAttr{Name: deploymentName},
+						hcl.TraverseAttr{Name: name},
+					})
+				} else {
+					// each workspace has its own value, so every deployment gets its own variable
+					variableName := deploymentName + "_" + name
+					sensitiveVariables[variableName] = variables[name]
+					value = hclwrite.TokensForTraversal(hcl.Traversal{
+						hcl.TraverseRoot{Name: "var"},
+						hcl.TraverseAttr{Name: variableName},
+					})
+				}
+			}
+			inputs = append(inputs, hclwrite.ObjectAttrTokens{
+				Name:  hclwrite.TokensForIdentifier(name),
+				Value: value,
+			})
+		}
+
+		for _, name := range tfconfigutil.SortedKeys(request.UpstreamInputs) {
+			tokens, err := rawExprTokens(request.UpstreamInputs[name])
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, hclwrite.ObjectAttrTokens{
+				Name:  hclwrite.TokensForIdentifier(name),
+				Value: tokens,
+			})
+		}
+
+		if i > 0 {
+			file.Body().AppendNewline()
+		}
+
+		if mode == SensitiveInputStore && len(sensitiveNames) > 0 {
+			varsetID := workspace.VarsetID
+			if varsetID == "" {
+				varsetID = varsetIDPlaceholder
+				result.Warnings = append(result.Warnings, fmt.Sprintf("set the varset ID of deployment %s, the variable set must hold the values of %v", deploymentName, sensitiveNames))
+			}
+			store := file.Body().AppendNewBlock("store", []string{varsetStoreType, deploymentName})
+			store.Body().SetAttributeValue("id", cty.StringVal(varsetID))
+			store.Body().SetAttributeValue("category", cty.StringVal(varsetStoreCategory))
+			file.Body().AppendNewline()
+		}
+
+		deployment := file.Body().AppendNewBlock("deployment", []string{deploymentName})
+		deployment.Body().SetAttributeRaw("inputs", hclwrite.TokensForObject(inputs))
+	}
+
+	for _, name := range tfconfigutil.SortedKeys(sensitiveVariables) {
+		file.Body().AppendNewline()
+		variable := file.Body().AppendNewBlock("variable", []string{name})
+		typeTokens, err := rawExprTokens(typeexpr.TypeString(sensitiveVariables[name].Type))
+		if err != nil {
+			return nil, err
+		}
+		variable.Body().SetAttributeRaw("type", typeTokens)
+		variable.Body().SetAttributeValue("sensitive", cty.True)
+		variable.Body().SetAttributeValue("ephemeral", cty.True)
+	}
+
+	result.Files, err = writeGeneratedFiles(request.StackSourceBundleAbsPath, map[string]*hclwrite.File{deploymentsFileName: file})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// loadStackVariables returns the variables declared in the .tfcomponent.hcl files of the stack configuration.
+func (s *stackConfigUtility) loadStackVariables(stackDir string) (map[string]*stackVariable, error) {
+	stackFiles, err := filepath.Glob(filepath.Join(stackDir, stackComponentFileGlob))
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching stack files from path %s, err: %w", stackDir, err)
+	}
+	if len(stackFiles) == 0 {
+		return nil, fmt.Errorf("no stack files found in the directory %s", stackDir)
+	}
+
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "variable", LabelNames: []string{"name"}},
+		},
+	}
+	variableSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "type"},
+			{Name: "sensitive"},
+		},
+	}
+
+	variables := make(map[string]*stackVariable)
+	for _, filePath := range stackFiles {
+		file, diags := s.hclParser.ParseHCLFile(filePath)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse HCL file %s, err: %v", filePath, diags.Error())
+		}
+
+		content, _, diags := file.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, block := range content.Blocks {
+			variableContent, _, diags := block.Body.PartialContent(variableSchema)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			variable := &stackVariable{
+				Name: block.Labels[0],
+				Type: cty.DynamicPseudoType,
+			}
+			if attr, ok := variableContent.Attributes["type"]; ok {
+				ty, diags := typeexpr.TypeConstraint(attr.Expr)
+				if diags.HasErrors() {
+					return nil, diags
+				}
+				variable.Type = ty
+			}
+			if attr, ok := variableContent.Attributes["sensitive"]; ok {
+				value, diags := attr.Expr.Value(nil)
+				if diags.HasErrors() {
+					return nil, diags
+				}
+				variable.Sensitive = value.Type() == cty.Bool && !value.IsNull() && value.True()
+			}
+			variables[variable.Name] = variable
+		}
+	}
+
+	return variables, nil
+}
+
+// loadWorkspaceVariableValues collects the values of the stack variables for a workspace, using the same precedence
+// as Terraform: environment variables, then terraform.tfvars, then *.auto.tfvars in lexical order, then the explicit
+// variable files in order. Values for variables the stack does not declare are reported as warnings.
+func (s *stackConfigUtility) loadWorkspaceVariableValues(workspace WorkspaceVariables, variables map[string]*stackVariable) (map[string]cty.Value, []string, error) {
+	values := make(map[string]cty.Value)
+	var warnings []string
+
+	for _, env := range workspace.Environment {
+		key, raw, found := strings.Cut(env, "=")
+		if !found || !strings.HasPrefix(key, envVariablePrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, envVariablePrefix)
+		variable, ok := variables[name]
+		if !ok {
+			// Terraform silently ignores environment variables for undeclared variables too
+			continue
+		}
+
+		// only string variables take the raw value, everything else is parsed as an HCL expression
+		if variable.Type == cty.String {
+			values[name] = cty.StringVal(raw)
+			continue
+		}
+		expr, diags := hclsyntax.ParseExpression([]byte(raw), key, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, nil, fmt.Errorf("invalid value for environment variable %s: %v", key, diags.Error())
+		}
+		value, diags := expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, nil, fmt.Errorf("invalid value for environment variable %s: %v", key, diags.Error())
+		}
+		values[name] = value
+	}
+
+	var varFiles []string
+	if workspace.ConfigDir != "" {
+		for _, name := range []string{defaultVarFileName, defaultVarJSONFileName} {
+			if _, err := os.Stat(filepath.Join(workspace.ConfigDir, name)); err == nil {
+				varFiles = append(varFiles, filepath.Join(workspace.ConfigDir, name))
+			}
+		}
+
+		var autoFiles []string
+		for _, pattern := range []string{autoVarFileGlob, autoVarJSONFileGlob} {
+			matches, err := filepath.Glob(filepath.Join(workspace.ConfigDir, pattern))
+			if err != nil {
+				return nil, nil, fmt.Errorf("error while fetching variable files from path %s, err: %w", workspace.ConfigDir, err)
+			}
+			autoFiles = append(autoFiles, matches...)
+		}
+		sort.Strings(autoFiles)
+		varFiles = append(varFiles, autoFiles...)
+	}
+	varFiles = append(varFiles, workspace.VarFilePaths...)
+
+	for _, varFile := range varFiles {
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(varFile, ".json") {
+			file, diags = s.hclParser.ParseJSONFile(varFile)
+		} else {
+			file, diags = s.hclParser.ParseHCLFile(varFile)
+		}
+		if diags.HasErrors() {
+			return nil, nil, fmt.Errorf("failed to parse variable file %s, err: %v", varFile, diags.Error())
+		}
+		if file == nil || file.Body == nil {
+			continue
+		}
+
+		attrs, diags := file.Body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, nil, fmt.Errorf("failed to decode variable file %s, err: %v", varFile, diags.Error())
+		}
+
+		for name, attr := range attrs {
+			if _, ok := variables[name]; !ok {
+				warnings = append(warnings, fmt.Sprintf("workspace %s sets %s in %s, which the stack does not declare", workspace.Name, name, varFile))
+				continue
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				return nil, nil, fmt.Errorf("invalid value for variable %s in %s: %v", name, varFile, diags.Error())
+			}
+			values[name] = value
+		}
+	}
+
+	sort.Strings(warnings)
+	return values, warnings, nil
+}
+
+// deploymentNameForWorkspace derives a valid deployment name from a workspace name by replacing
+// the characters that are not allowed in identifiers.
+func deploymentNameForWorkspace(workspace string) string {
+	name := regexp.MustCompile(invalidIdentifierChars).ReplaceAllString(workspace, "_")
+	if !hclsyntax.ValidIdentifier(name) {
+		name = deploymentNameFallback + "_" + name
+	}
+	return name
+}
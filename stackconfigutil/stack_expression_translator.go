@@ -0,0 +1,288 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	untranslatableReferenceSummary = `Untranslatable reference`
+)
+
+// exprTranslator rewrites root module expressions into the equivalent stack configuration expressions.
+// References to module outputs become references to component outputs, references to root variables are kept
+// as references to the stack variables of the same name and local values are inlined. References to
+// terraform_remote_state data sources are translated by the remote state linker, if there is one. Every other
+// reference to the root module has no equivalent in a stack and is reported with a diagnostic pointing at its
+// source range.
+type exprTranslator struct {
+	root         *tfconfigutil.Module
+	inlining     map[string]bool
+	remoteStates *remoteStateLinker
+}
+
+func newExprTranslator(root *tfconfigutil.Module) *exprTranslator {
+	return &exprTranslator{
+		root:     root,
+		inlining: make(map[string]bool),
+	}
+}
+
+// Translate returns the tokens of the stack expression equivalent to the given root module expression.
+// allowEach reports whether the expression is evaluated in a component that uses for_each. References that
+// cannot be translated are left unchanged and reported as error diagnostics.
+func (t *exprTranslator) Translate(expr hcl.Expression, allowEach bool) (hclwrite.Tokens, hcl.Diagnostics) {
+	src, diags := t.translateSource(expr, allowEach)
+	if src == "" {
+		return hclwrite.TokensForIdentifier("null"), diags
+	}
+
+	tokens, err := rawExprTokens(src)
+	if err != nil {
+		return hclwrite.TokensForIdentifier("null"), append(diags, invalidTranslationDiagnostic(err, expr.Range()))
+	}
+	return tokens, diags
+}
+
+// translateSource returns the source of the translated expression, or the empty string if the expression
+// is not written in native syntax.
+func (t *exprTranslator) translateSource(expr hcl.Expression, allowEach bool) (string, hcl.Diagnostics) {
+	syntaxExpr, ok := expr.(hclsyntax.Expression)
+	if !ok {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported expression syntax",
+			Detail:   "Only expressions written in native HCL syntax can be translated into stack configuration.",
+			Subject:  expr.Range().Ptr(),
+		}}
+	}
+
+	file, ok := t.root.Files[expr.Range().Filename]
+	if !ok {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported expression syntax",
+			Detail:   fmt.Sprintf("The source of the expression is not part of the root module in %s.", t.root.Dir),
+			Subject:  expr.Range().Ptr(),
+		}}
+	}
+
+	edits, diags := t.exprEdits(syntaxExpr, allowEach)
+	rng := expr.Range()
+	src, err := tfconfigutil.ApplyTextEdits(file.Bytes, rng.Start.Byte, rng.End.Byte, edits)
+	if err != nil {
+		return "", append(diags, invalidTranslationDiagnostic(err, rng))
+	}
+	return string(src), diags
+}
+
+// TranslateBlockBody returns the source of the body of a root module block, such as a provider block, with the
+// references in all of its arguments and nested blocks translated.
+func (t *exprTranslator) TranslateBlockBody(block *hclsyntax.Block) (string, hcl.Diagnostics) {
+	return t.translateBlockRange(block, block.OpenBraceRange.End.Byte, block.CloseBraceRange.Start.Byte)
+}
+
+// TranslateBlock returns the source of a whole root module block, such as a block nested in a provider block,
+// with the references in all of its arguments and nested blocks translated.
+func (t *exprTranslator) TranslateBlock(block *hclsyntax.Block) (string, hcl.Diagnostics) {
+	rng := block.Range()
+	return t.translateBlockRange(block, rng.Start.Byte, rng.End.Byte)
+}
+
+func (t *exprTranslator) translateBlockRange(block *hclsyntax.Block, start, end int) (string, hcl.Diagnostics) {
+	file, ok := t.root.Files[block.Range().Filename]
+	if !ok {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported block syntax",
+			Detail:   fmt.Sprintf("The source of the block is not part of the root module in %s.", t.root.Dir),
+			Subject:  block.DefRange().Ptr(),
+		}}
+	}
+
+	edits, diags := t.blockEdits(block, nil)
+	src, err := tfconfigutil.ApplyTextEdits(file.Bytes, start, end, edits)
+	if err != nil {
+		return "", append(diags, invalidTranslationDiagnostic(err, block.Body.SrcRange))
+	}
+	return string(src), diags
+}
+
+// blockEdits returns the edits that translate the references in all arguments and nested blocks of a block.
+func (t *exprTranslator) blockEdits(block *hclsyntax.Block, shadowed []string) ([]tfconfigutil.TextEdit, hcl.Diagnostics) {
+	// the iterator of a dynamic block is only in scope within the block
+	if block.Type == "dynamic" && len(block.Labels) > 0 {
+		iterator := block.Labels[0]
+		if attr, ok := block.Body.Attributes["iterator"]; ok {
+			iterator = hcl.ExprAsKeyword(attr.Expr)
+		}
+		shadowed = append(slices.Clone(shadowed), iterator)
+	}
+
+	var edits []tfconfigutil.TextEdit
+	var diags hcl.Diagnostics
+	for _, attr := range block.Body.Attributes {
+		attrEdits, attrDiags := t.exprEdits(attr.Expr, false, shadowed...)
+		edits = append(edits, attrEdits...)
+		diags = append(diags, attrDiags...)
+	}
+	for _, nested := range block.Body.Blocks {
+		nestedEdits, nestedDiags := t.blockEdits(nested, shadowed)
+		edits = append(edits, nestedEdits...)
+		diags = append(diags, nestedDiags...)
+	}
+	return edits, diags
+}
+
+// exprEdits returns the edits that translate the references of a native syntax expression. References whose
+// root name is listed in shadowed are left as they are.
+func (t *exprTranslator) exprEdits(expr hclsyntax.Expression, allowEach bool, shadowed ...string) ([]tfconfigutil.TextEdit, hcl.Diagnostics) {
+	// names declared by for expressions shadow the root module objects within the expression
+	iterators := make(map[string]bool)
+	for _, name := range shadowed {
+		iterators[name] = true
+	}
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		if forExpr, ok := node.(*hclsyntax.ForExpr); ok {
+			iterators[forExpr.KeyVar] = true
+			iterators[forExpr.ValVar] = true
+		}
+		return nil
+	})
+
+	var diags hcl.Diagnostics
+	var edits []tfconfigutil.TextEdit
+	for _, ref := range tfconfigutil.ExprReferences(expr) {
+		if iterators[ref.Traversal.RootName()] {
+			continue
+		}
+		edit, refDiags := t.translateReference(ref, allowEach)
+		diags = append(diags, refDiags...)
+		if edit != nil {
+			edits = append(edits, *edit)
+		}
+	}
+	return edits, diags
+}
+
+// translateReference returns the edit turning a single root module reference into its stack equivalent,
+// or nil if the reference means the same in both.
+func (t *exprTranslator) translateReference(ref *hclsyntax.ScopeTraversalExpr, allowEach bool) (*tfconfigutil.TextEdit, hcl.Diagnostics) {
+	traversal := ref.Traversal
+	rootName := traversal.RootName()
+	attrName := ""
+	if len(traversal) > 1 {
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			attrName = attr.Name
+		}
+	}
+
+	switch rootName {
+	case "module":
+		if _, ok := t.root.ModuleCalls[attrName]; !ok {
+			return nil, t.untranslatable(ref, fmt.Sprintf("The root module does not call a module named %q.", attrName))
+		}
+		rootRange := traversal[0].SourceRange()
+		return &tfconfigutil.TextEdit{Start: rootRange.Start.Byte, End: rootRange.End.Byte, Text: "component"}, nil
+
+	case "var":
+		if _, ok := t.root.Variables[attrName]; !ok {
+			return nil, t.untranslatable(ref, fmt.Sprintf("The root module does not declare a variable named %q.", attrName))
+		}
+		return nil, nil
+
+	case "local":
+		return t.inlineLocal(ref, attrName, allowEach)
+
+	case "each":
+		if allowEach {
+			return nil, nil
+		}
+		return nil, t.untranslatable(ref, "each is only available in components that use for_each.")
+
+	case "count":
+		return nil, t.untranslatable(ref, "Components do not support count, convert the module to for_each and use each.key instead.")
+
+	case "data":
+		if attrName == remoteStateDataSourceType && t.remoteStates != nil {
+			edit, detail := t.remoteStates.Translate(ref)
+			if edit == nil {
+				return nil, t.untranslatable(ref, detail)
+			}
+			return edit, nil
+		}
+		return nil, t.untranslatable(ref, "Data sources in the root module have no equivalent in a stack. Move the data source into a module and pass its value through a component output, or replace it with a stack variable.")
+
+	case "path":
+		return nil, t.untranslatable(ref, "Filesystem paths of the root module have no equivalent in a stack, use a path relative to the component source instead.")
+
+	case "terraform":
+		return nil, t.untranslatable(ref, "Stacks have no workspaces, pass the value as a deployment input instead.")
+	}
+
+	if _, ok := t.root.ManagedResources[rootName+"."+attrName]; ok {
+		return nil, t.untranslatable(ref, "Resources in the root module are not part of any component. Move the resource into a module and pass its value through a component output.")
+	}
+
+	return nil, t.untranslatable(ref, fmt.Sprintf("%q is not a known root module object.", rootName))
+}
+
+// inlineLocal replaces a reference to a local value with the translated expression of the local value.
+func (t *exprTranslator) inlineLocal(ref *hclsyntax.ScopeTraversalExpr, name string, allowEach bool) (*tfconfigutil.TextEdit, hcl.Diagnostics) {
+	local, ok := t.root.Locals[name]
+	if !ok {
+		return nil, t.untranslatable(ref, fmt.Sprintf("The root module does not declare a local value named %q.", name))
+	}
+	if t.inlining[name] {
+		return nil, t.untranslatable(ref, fmt.Sprintf("The local value %q refers to itself.", name))
+	}
+
+	t.inlining[name] = true
+	src, diags := t.translateSource(local.Expr, allowEach)
+	delete(t.inlining, name)
+
+	if src == "" || diags.HasErrors() {
+		return nil, append(t.untranslatable(ref, fmt.Sprintf("The local value %q cannot be inlined, see the diagnostics of its expression.", name)), diags...)
+	}
+
+	// keep the operator precedence of the inlined expression intact
+	switch local.Expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr, *hclsyntax.LiteralValueExpr, *hclsyntax.TemplateExpr, *hclsyntax.FunctionCallExpr,
+		*hclsyntax.TupleConsExpr, *hclsyntax.ObjectConsExpr, *hclsyntax.ParenthesesExpr:
+	default:
+		src = "(" + src + ")"
+	}
+
+	return &tfconfigutil.TextEdit{
+		Start: ref.Traversal[0].SourceRange().Start.Byte,
+		End:   ref.Traversal[1].SourceRange().End.Byte,
+		Text:  src,
+	}, diags
+}
+
+func (t *exprTranslator) untranslatable(ref *hclsyntax.ScopeTraversalExpr, detail string) hcl.Diagnostics {
+	return hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  untranslatableReferenceSummary,
+		Detail:   fmt.Sprintf("Cannot translate %s: %s", tfconfigutil.TraversalString(ref.Traversal), detail),
+		Subject:  ref.SrcRange.Ptr(),
+	}}
+}
+
+func invalidTranslationDiagnostic(err error, rng hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid translated expression",
+		Detail:   err.Error(),
+		Subject:  rng.Ptr(),
+	}
+}
@@ -0,0 +1,462 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+)
+
+const (
+	providerSetConfigName = `aliases`
+)
+
+// ComponentProviders describes the provider configurations a component needs and where they come from.
+type ComponentProviders struct {
+	Component    string            `json:"component"`
+	Configs      map[string]string `json:"configs"`       // Configs maps each provider configuration address in the module, such as "aws" or "aws.east", to the root module configuration it receives.
+	Inherited    []string          `json:"inherited"`     // Inherited lists the module configurations the classic configuration only passes implicitly.
+	StateConfigs []string          `json:"state_configs"` // StateConfigs lists the provider configuration addresses recorded in the state for the resources of the module.
+	Warnings     []string          `json:"warnings"`
+}
+
+// providerSet groups the aliased configurations of a single provider into one stack provider block using for_each.
+type providerSet struct {
+	LocalName string
+	Members   map[string]*tfconfigutil.ProviderConfig // Members maps each alias to its root module configuration.
+}
+
+// providerRefResolver turns root module provider configuration addresses into stack provider references,
+// taking the provider sets into account.
+type providerRefResolver struct {
+	sets map[string]*providerSet
+}
+
+// Ref returns the stack provider configuration equivalent to a root module configuration address such as "aws.east".
+func (r *providerRefResolver) Ref(addr string) stackProviderRef {
+	ref := stackProviderRefForAddr(addr)
+	if set, ok := r.sets[ref.LocalName]; ok {
+		if _, ok := set.Members[ref.ConfigName]; ok {
+			return stackProviderRef{LocalName: ref.LocalName, ConfigName: providerSetConfigName, Key: ref.ConfigName}
+		}
+	}
+	return ref
+}
+
+// AnalyzeComponentProviders gathers, for every module call of the root module, the provider configurations its
+// resources use according to the configuration and the state, and how each of them is passed into the module.
+// The result is the wiring GenerateComponentConfig writes into the providers argument of each component.
+func (s *stackConfigUtility) AnalyzeComponentProviders(request GenerateComponentConfigRequest) ([]*ComponentProviders, error) {
+	root, err := tfconfigutil.LoadModule(s.hclParser, request.TerraformConfigFilesAbsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Terraform configuration, err: %v", err)
+	}
+
+	children, nested, _, err := s.loadModuleCalls(root)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := readOptionalState(request.StateFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var analysis []*ComponentProviders
+	for _, name := range tfconfigutil.SortedKeys(root.ModuleCalls) {
+		analysis = append(analysis, analyzeComponentProviders(root, root.ModuleCalls[name], children[name], nested[name], state))
+	}
+	return analysis, nil
+}
+
+// analyzeComponentProviders works out the provider wiring of a single module call. The configurations the module
+// needs come from its resources, its configuration_aliases and the modules nested in it, or from the state when the
+// module source is not available. Explicitly passed configurations are kept, default configurations that are only
+// inherited implicitly are wired to the root configuration of the same name and reported, since components never
+// inherit providers.
+func analyzeComponentProviders(root *tfconfigutil.Module, moduleCall *tfconfigutil.ModuleCall, child *tfconfigutil.Module, nested map[string]struct{}, state *tfstateutil.WorkspaceState) *ComponentProviders {
+	analysis := &ComponentProviders{
+		Component: moduleCall.Name,
+		Configs:   make(map[string]string),
+	}
+
+	passed := make(map[string]string)
+	for _, provider := range moduleCall.Providers {
+		passed[provider.InChild] = provider.InParent
+	}
+
+	stateConfigs := make(map[string]struct{})
+	if state != nil {
+		for _, resource := range state.Resources {
+			if topLevelModuleName(resource.Module) != moduleCall.Name {
+				continue
+			}
+			addr, err := tfstateutil.ParseProviderConfigAddr(resource.Provider)
+			if err != nil {
+				analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("resource %s has an invalid provider configuration address %s", resource.Addr(), resource.Provider))
+				continue
+			}
+			if addr.Module != "" {
+				analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("resource %s uses the provider configuration %s declared inside a module, components cannot declare providers, move the configuration into the stack", resource.Addr(), addr))
+				continue
+			}
+			stateConfigs[rootProviderConfigAddr(root, addr)] = struct{}{}
+		}
+	}
+	analysis.StateConfigs = tfconfigutil.SortedKeys(stateConfigs)
+
+	needed := make(map[string]struct{})
+	if child != nil {
+		for addr := range moduleProviderConfigs(child) {
+			needed[addr] = struct{}{}
+		}
+		for addr := range nested {
+			needed[addr] = struct{}{}
+		}
+		for addr := range child.ProviderConfigs {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("module %s declares the provider configuration %s, components cannot declare providers, move the configuration into the stack", moduleCall.Name, addr))
+		}
+	} else if state == nil {
+		for _, name := range root.ProviderLocalNames() {
+			needed[name] = struct{}{}
+		}
+		for inChild := range passed {
+			needed[inChild] = struct{}{}
+		}
+		analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("providers of module %s were guessed from the root module, review the generated component", moduleCall.Name))
+	} else {
+		// without the module source the state tells us which root configurations the module uses,
+		// which is only unambiguous while the module uses a single configuration per provider
+		perLocalName := make(map[string][]string)
+		for addr := range stateConfigs {
+			localName, _, _ := strings.Cut(addr, ".")
+			perLocalName[localName] = append(perLocalName[localName], addr)
+		}
+		for inChild := range passed {
+			needed[inChild] = struct{}{}
+		}
+		for _, localName := range tfconfigutil.SortedKeys(perLocalName) {
+			if _, ok := passed[localName]; ok {
+				continue
+			}
+			if len(perLocalName[localName]) > 1 {
+				analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("resources of module %s use several configurations of provider %s %v, wire them manually", moduleCall.Name, localName, perLocalName[localName]))
+				continue
+			}
+			analysis.Configs[localName] = perLocalName[localName][0]
+		}
+		if len(analysis.Configs) > 0 {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("providers of module %s were derived from the state, review the generated component", moduleCall.Name))
+		}
+	}
+
+	for _, inChild := range tfconfigutil.SortedKeys(needed) {
+		localName, _, aliased := strings.Cut(inChild, ".")
+		if localName == "terraform" {
+			continue
+		}
+		if inParent, ok := passed[inChild]; ok {
+			analysis.Configs[inChild] = inParent
+			continue
+		}
+		if aliased {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("module %s expects the provider configuration %s, which the module block does not pass", moduleCall.Name, inChild))
+			continue
+		}
+		analysis.Configs[inChild] = inChild
+		analysis.Inherited = append(analysis.Inherited, inChild)
+		if len(passed) > 0 {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("module %s uses provider %s, which its providers argument does not pass, the component receives the default configuration", moduleCall.Name, inChild))
+		} else {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("module %s relies on the implicitly inherited provider %s, the component receives the default configuration explicitly", moduleCall.Name, inChild))
+		}
+	}
+
+	wired := make(map[string]struct{})
+	for _, inParent := range analysis.Configs {
+		wired[inParent] = struct{}{}
+	}
+	for _, addr := range analysis.StateConfigs {
+		if _, ok := wired[addr]; !ok {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("resources of module %s are managed with the provider configuration %s in the state, which the component does not receive", moduleCall.Name, addr))
+		}
+	}
+
+	return analysis
+}
+
+// moduleProviderConfigs returns the provider configurations a module declares it needs itself, the ones its
+// resources use and the aliases listed in configuration_aliases. A provider that is only listed in
+// required_providers is not needed until something uses it.
+func moduleProviderConfigs(module *tfconfigutil.Module) map[string]struct{} {
+	configs := make(map[string]struct{})
+	for _, resource := range module.ManagedResources {
+		configs[resource.ProviderConfigAddr()] = struct{}{}
+	}
+	for _, resource := range module.DataResources {
+		configs[resource.ProviderConfigAddr()] = struct{}{}
+	}
+	for _, requiredProvider := range module.RequiredProviders {
+		for _, alias := range requiredProvider.ConfigurationAliases {
+			configs[alias] = struct{}{}
+		}
+	}
+	return configs
+}
+
+// nestedProviderConfigs returns the provider configurations of a module that the modules it calls need, either
+// passed through their providers argument or inherited implicitly as default configurations. Nested modules whose
+// source is not available locally are reported as warnings.
+func (s *stackConfigUtility) nestedProviderConfigs(module *tfconfigutil.Module, modulePath string) (map[string]struct{}, []string, error) {
+	configs := make(map[string]struct{})
+	var warnings []string
+	for _, name := range tfconfigutil.SortedKeys(module.ModuleCalls) {
+		moduleCall := module.ModuleCalls[name]
+		passed := make(map[string]string)
+		for _, provider := range moduleCall.Providers {
+			passed[provider.InChild] = provider.InParent
+			configs[provider.InParent] = struct{}{}
+		}
+
+		if !tfconfigutil.IsLocalModuleSource(moduleCall.Source) {
+			warnings = append(warnings, fmt.Sprintf("source of module %s.module.%s is not local, the providers it inherits implicitly are not wired", modulePath, name))
+			continue
+		}
+		childDir := filepath.Join(module.Dir, moduleCall.Source)
+		if _, err := os.Stat(childDir); err != nil {
+			warnings = append(warnings, fmt.Sprintf("source of module %s.module.%s is not available locally, the providers it inherits implicitly are not wired", modulePath, name))
+			continue
+		}
+		child, err := tfconfigutil.LoadModule(s.hclParser, childDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load module %s.module.%s, err: %v", modulePath, name, err)
+		}
+
+		needed := moduleProviderConfigs(child)
+		childNested, childWarnings, err := s.nestedProviderConfigs(child, modulePath+".module."+name)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, childWarnings...)
+		for addr := range childNested {
+			needed[addr] = struct{}{}
+		}
+
+		for addr := range needed {
+			if _, ok := passed[addr]; ok {
+				continue
+			}
+			// only default configurations are inherited, aliased ones must be passed explicitly
+			if !strings.Contains(addr, ".") {
+				configs[addr] = struct{}{}
+			}
+		}
+	}
+	return configs, warnings, nil
+}
+
+// rootProviderConfigAddr converts an absolute provider configuration address from the state into the
+// address used in the root module, for example "aws.east" for `provider["registry.terraform.io/hashicorp/aws"].east`.
+func rootProviderConfigAddr(root *tfconfigutil.Module, addr tfstateutil.ProviderConfigAddr) string {
+	localName := addr.Type()
+	for _, name := range root.ProviderLocalNames() {
+		if root.ProviderSource(name) == addr.Source {
+			localName = name
+			break
+		}
+	}
+	if addr.Alias == "" {
+		return localName
+	}
+	return localName + "." + addr.Alias
+}
+
+// topLevelModuleName returns the name of the root module call a state module address belongs to,
+// for example "app" for `module.app["a"].module.db`.
+func topLevelModuleName(moduleAddr string) string {
+	name, ok := strings.CutPrefix(moduleAddr, "module.")
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexAny(name, ".["); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// readOptionalState reads and decodes a workspace state file, returning nil if no path is set.
+func readOptionalState(stateFilePath string) (*tfstateutil.WorkspaceState, error) {
+	if stateFilePath == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(stateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %w", stateFilePath, err)
+	}
+	return tfstateutil.ParseWorkspaceState(raw)
+}
+
+// findProviderSets returns the providers whose aliased configurations can be expressed as a single provider block
+// using for_each. That is the case when there are at least two aliased configurations that set the same arguments
+// and have identical nested blocks, so only the argument values differ between them.
+func findProviderSets(root *tfconfigutil.Module) map[string]*providerSet {
+	aliased := make(map[string]map[string]*tfconfigutil.ProviderConfig)
+	for _, providerConfig := range root.ProviderConfigs {
+		if providerConfig.Alias == "" {
+			continue
+		}
+		if _, ok := aliased[providerConfig.Name]; !ok {
+			aliased[providerConfig.Name] = make(map[string]*tfconfigutil.ProviderConfig)
+		}
+		aliased[providerConfig.Name][providerConfig.Alias] = providerConfig
+	}
+
+	sets := make(map[string]*providerSet)
+	for localName, members := range aliased {
+		if len(members) < 2 {
+			continue
+		}
+
+		groupable := true
+		var attrNames, blocksSrc string
+		for i, alias := range tfconfigutil.SortedKeys(members) {
+			body, ok := members[alias].Config.(*hclsyntax.Body)
+			if !ok {
+				groupable = false
+				break
+			}
+			names := strings.Join(providerSetAttrNames(body), ",")
+			blocks := providerSetBlocksSource(root, body)
+			if i == 0 {
+				attrNames, blocksSrc = names, blocks
+				continue
+			}
+			if names != attrNames || blocks != blocksSrc {
+				groupable = false
+				break
+			}
+		}
+		if groupable {
+			sets[localName] = &providerSet{LocalName: localName, Members: members}
+		}
+	}
+	return sets
+}
+
+// generateProviderSetBlock appends a provider block with for_each over the aliases of a provider set. Arguments
+// with the same value in every configuration are written once, the others are read from each.value. The arguments
+// and nested blocks are translated like any other root module expression, the diagnostics report the references
+// that could not be translated.
+func generateProviderSetBlock(body *hclwrite.Body, translator *exprTranslator, set *providerSet) (hcl.Diagnostics, error) {
+	root := translator.root
+	aliases := tfconfigutil.SortedKeys(set.Members)
+	first := set.Members[aliases[0]].Config.(*hclsyntax.Body)
+
+	varying := make(map[string]bool)
+	for _, name := range providerSetAttrNames(first) {
+		value := exprSource(root, first.Attributes[name].Expr)
+		for _, alias := range aliases[1:] {
+			if exprSource(root, set.Members[alias].Config.(*hclsyntax.Body).Attributes[name].Expr) != value {
+				varying[name] = true
+			}
+		}
+	}
+
+	var diags hcl.Diagnostics
+	translate := func(expr hcl.Expression) string {
+		src, exprDiags := translator.translateSource(expr, false)
+		diags = append(diags, exprDiags...)
+		if src == "" {
+			return "null"
+		}
+		return src
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "provider %q %q {\n", set.LocalName, providerSetConfigName)
+	sb.WriteString("for_each = {\n")
+	for _, alias := range aliases {
+		fmt.Fprintf(&sb, "%s = {\n", alias)
+		memberBody := set.Members[alias].Config.(*hclsyntax.Body)
+		for _, name := range tfconfigutil.SortedKeys(varying) {
+			fmt.Fprintf(&sb, "%s = %s\n", name, translate(memberBody.Attributes[name].Expr))
+		}
+		sb.WriteString("}\n")
+	}
+	sb.WriteString("}\n\n")
+	sb.WriteString("config {\n")
+	for _, name := range providerSetAttrNames(first) {
+		if varying[name] {
+			fmt.Fprintf(&sb, "%s = each.value.%s\n", name, name)
+		} else {
+			fmt.Fprintf(&sb, "%s = %s\n", name, translate(first.Attributes[name].Expr))
+		}
+	}
+	for _, block := range first.Blocks {
+		src, blockDiags := translator.TranslateBlock(block)
+		diags = append(diags, blockDiags...)
+		sb.WriteString(src)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}\n}\n")
+
+	file, parseDiags := hclwrite.ParseConfig([]byte(sb.String()), "", hcl.InitialPos)
+	if parseDiags.HasErrors() {
+		return nil, fmt.Errorf("failed to generate provider %s %s: %v", set.LocalName, providerSetConfigName, parseDiags.Error())
+	}
+	body.AppendUnstructuredTokens(file.BuildTokens(nil))
+	return diags, nil
+}
+
+// providerSetAttrNames returns the arguments of a provider block in declaration order, without alias and version.
+func providerSetAttrNames(body *hclsyntax.Body) []string {
+	var names []string
+	for _, attr := range body.Attributes {
+		if attr.Name == "alias" || attr.Name == "version" {
+			continue
+		}
+		names = append(names, attr.Name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return body.Attributes[names[i]].SrcRange.Start.Byte < body.Attributes[names[j]].SrcRange.Start.Byte
+	})
+	return names
+}
+
+// providerSetBlocksSource returns the source of the nested blocks of a provider block.
+func providerSetBlocksSource(root *tfconfigutil.Module, body *hclsyntax.Body) string {
+	var sb strings.Builder
+	for _, block := range body.Blocks {
+		rng := block.Range()
+		sb.Write(root.Files[rng.Filename].Bytes[rng.Start.Byte:rng.End.Byte])
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// exprSource returns the source of an expression as written in the root module.
+func exprSource(root *tfconfigutil.Module, expr hcl.Expression) string {
+	rng := expr.Range()
+	return string(root.Files[rng.Filename].Bytes[rng.Start.Byte:rng.End.Byte])
+}
+
+// localProviderTraversal returns the traversal of a provider configuration address such as "aws" or "aws.east".
+func localProviderTraversal(addr string) hcl.Traversal {
+	localName, alias, found := strings.Cut(addr, ".")
+	traversal := hcl.Traversal{hcl.TraverseRoot{Name: localName}}
+	if found {
+		traversal = append(traversal, hcl.TraverseAttr{Name: alias})
+	}
+	return traversal
+}
@@ -0,0 +1,458 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	remoteStateDataSourceType = `terraform_remote_state`
+	upstreamInputsFileName    = `upstream_inputs.tfdeploy.hcl`
+	publishOutputsFileName    = `publish_outputs.tfdeploy.hcl`
+	linkedStacksDirName       = `linked_stacks`
+	upstreamInputStackType    = `stack`
+	upstreamInputNameFallback = `upstream`
+)
+
+// RemoteStateLink describes a terraform_remote_state data source that was replaced by component references.
+type RemoteStateLink struct {
+	Consumer      string            // Consumer is the component whose root module read the remote state, empty if the root module of the stack itself did.
+	DataSource    string            // DataSource is the address of the data source in the root module of the consumer.
+	Producer      string            // Producer is the component whose outputs replace the remote state, if the producer is part of the same stack.
+	Stack         string            // Stack is the source address of the linked stack whose published outputs replace the remote state otherwise.
+	UpstreamInput string            // UpstreamInput is the name of the upstream_input block that reads the linked stack.
+	Variables     map[string]string // Variables maps the stack variables replacing the remote state outputs to the upstream_input references the deployments pass into them.
+	Outputs       []string          // Outputs lists the outputs of the producer the consumer reads, "*" stands for the whole set of outputs.
+}
+
+// remoteStateSource is a terraform_remote_state data source of a root module together with the names that
+// identify the workspace it reads.
+type remoteStateSource struct {
+	Resource    *tfconfigutil.Resource
+	Block       *hclsyntax.Block
+	Identifiers []string
+}
+
+// findRemoteStateSources returns the terraform_remote_state data sources of a root module, together with the
+// names of the workspace each of them reads as far as they can be determined without evaluating the configuration.
+func findRemoteStateSources(root *tfconfigutil.Module) ([]*remoteStateSource, []string) {
+	var sources []*remoteStateSource
+	var warnings []string
+	for _, addr := range tfconfigutil.SortedKeys(root.DataResources) {
+		resource := root.DataResources[addr]
+		if resource.Type != remoteStateDataSourceType {
+			continue
+		}
+		block := findSyntaxBlock(root.Files, resource.DeclRange, "data", []string{resource.Type, resource.Name})
+		if block == nil {
+			warnings = append(warnings, fmt.Sprintf("%s in %s must be declared in native HCL syntax to be migrated", addr, root.Dir))
+			continue
+		}
+
+		source := &remoteStateSource{Resource: resource, Block: block}
+		if attr, ok := block.Body.Attributes["config"]; ok {
+			config, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !config.IsWhollyKnown() || config.IsNull() || !config.Type().IsObjectType() {
+				warnings = append(warnings, fmt.Sprintf("the config of %s in %s is not a constant, the workspace it reads cannot be determined", addr, root.Dir))
+			} else {
+				source.Identifiers = remoteStateIdentifiers(root.Dir, config)
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources, warnings
+}
+
+// remoteStateIdentifiers returns the names in a terraform_remote_state config that identify the workspace it reads:
+// the workspace name of the remote and cloud backends, the key of object storage backends and the local path.
+func remoteStateIdentifiers(dir string, config cty.Value) []string {
+	var identifiers []string
+	attrs := config.AsValueMap()
+	if workspaces, ok := attrs["workspaces"]; ok && !workspaces.IsNull() && workspaces.Type().IsObjectType() {
+		if name, ok := workspaces.AsValueMap()["name"]; ok && !name.IsNull() && name.Type() == cty.String {
+			identifiers = append(identifiers, name.AsString())
+		}
+	}
+	if key, ok := attrs["key"]; ok && !key.IsNull() && key.Type() == cty.String {
+		identifiers = append(identifiers, key.AsString())
+	}
+	if path, ok := attrs["path"]; ok && !path.IsNull() && path.Type() == cty.String {
+		statePath := path.AsString()
+		if !filepath.IsAbs(statePath) {
+			statePath = filepath.Join(dir, statePath)
+		}
+		identifiers = append(identifiers, statePath)
+	}
+	return identifiers
+}
+
+// normalizeRemoteStateIdentifier cleans identifiers that are state file paths so that they compare equal.
+func normalizeRemoteStateIdentifier(identifier string) string {
+	if filepath.IsAbs(identifier) {
+		return filepath.Clean(identifier)
+	}
+	return identifier
+}
+
+// remoteStateReferences returns the references to a terraform_remote_state data source in a root module.
+func remoteStateReferences(root *tfconfigutil.Module, name string) []*hclsyntax.ScopeTraversalExpr {
+	var refs []*hclsyntax.ScopeTraversalExpr
+	for _, filename := range tfconfigutil.SortedKeys(root.Files) {
+		body, ok := root.Files[filename].Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+			ref, ok := node.(*hclsyntax.ScopeTraversalExpr)
+			if !ok || len(ref.Traversal) < 3 || ref.Traversal.RootName() != "data" {
+				return nil
+			}
+			resourceType, typeOk := ref.Traversal[1].(hcl.TraverseAttr)
+			resourceName, nameOk := ref.Traversal[2].(hcl.TraverseAttr)
+			if typeOk && nameOk && resourceType.Name == remoteStateDataSourceType && resourceName.Name == name {
+				refs = append(refs, ref)
+			}
+			return nil
+		})
+	}
+	return refs
+}
+
+// remoteStateOutput returns the output a reference to a terraform_remote_state data source reads, the empty string
+// if it reads the whole set of outputs, and the number of traversal steps up to and including the output.
+// It returns false if the reference does not read outputs, for example when it is used in depends_on.
+func remoteStateOutput(traversal hcl.Traversal) (string, int, bool) {
+	if len(traversal) < 4 {
+		return "", 0, false
+	}
+	if outputs, ok := traversal[3].(hcl.TraverseAttr); !ok || outputs.Name != "outputs" {
+		return "", 0, false
+	}
+	if len(traversal) == 4 {
+		return "", 4, true
+	}
+	switch step := traversal[4].(type) {
+	case hcl.TraverseAttr:
+		return step.Name, 5, true
+	case hcl.TraverseIndex:
+		if !step.Key.IsNull() && step.Key.Type() == cty.String {
+			return step.Key.AsString(), 5, true
+		}
+	}
+	return "", 4, true
+}
+
+// RemoteStateProducer describes where a workspace that is read through terraform_remote_state has been migrated to.
+// Exactly one of Component and Stack must be set.
+type RemoteStateProducer struct {
+	Names      []string // Names identify the workspace as terraform_remote_state reads it: its HCP Terraform workspace name, its backend key or its state file path.
+	Component  string   // Component is the component of the generated stack the workspace became, if it is part of the same stack.
+	Stack      string   // Stack is the source address of the linked stack the workspace became otherwise, for example app.terraform.io/org/project/network.
+	Deployment string   // Deployment is the deployment of the linked stack the workspace became, its outputs are published from it.
+}
+
+// remoteStateBinding ties a terraform_remote_state data source of the root module to the producer it reads.
+type remoteStateBinding struct {
+	source      *remoteStateSource
+	producer    *RemoteStateProducer
+	unsupported string
+	link        *RemoteStateLink
+	outputs     map[string]struct{}
+	variables   map[string]string // variables maps each output of a linked stack to the stack variable replacing it.
+}
+
+// publishedOutput is an output a linked stack has to publish for the generated stack.
+type publishedOutput struct {
+	Name       string
+	Deployment string
+	Output     string
+}
+
+// remoteStateLinker translates the references to the terraform_remote_state data sources of a root module.
+// Data sources that read a workspace migrated into the same stack become component references, those that read a
+// workspace migrated into another stack become stack variables that the deployments pass the outputs the linked
+// stack publishes into. Data sources whose workspace has not been migrated yet are left untranslated.
+type remoteStateLinker struct {
+	bindings  map[string]*remoteStateBinding
+	upstreams map[string]string // upstreams maps the source address of each linked stack to its upstream_input name.
+	published map[string]map[string]*publishedOutput
+	shared    map[string]bool // shared reports the linked stacks more than one deployment of is read.
+	variables map[string]string
+	taken     map[string]bool
+	warnings  []string
+}
+
+// newRemoteStateLinker binds the terraform_remote_state data sources of the root module to their producers.
+func newRemoteStateLinker(root *tfconfigutil.Module, producers []RemoteStateProducer) (*remoteStateLinker, error) {
+	byName := make(map[string]*RemoteStateProducer)
+	for i := range producers {
+		producer := &producers[i]
+		if (producer.Component == "") == (producer.Stack == "") {
+			return nil, fmt.Errorf("remote state producer %v must be either a component or a linked stack", producer.Names)
+		}
+		if producer.Stack != "" && producer.Deployment == "" {
+			return nil, fmt.Errorf("remote state producer %v must name the deployment of the linked stack %s", producer.Names, producer.Stack)
+		}
+		for _, name := range producer.Names {
+			byName[normalizeRemoteStateIdentifier(name)] = producer
+		}
+	}
+
+	linker := &remoteStateLinker{
+		bindings:  make(map[string]*remoteStateBinding),
+		upstreams: make(map[string]string),
+		published: make(map[string]map[string]*publishedOutput),
+		shared:    make(map[string]bool),
+		variables: make(map[string]string),
+		taken:     make(map[string]bool),
+	}
+	for name := range root.Variables {
+		linker.taken[name] = true
+	}
+
+	sources, warnings := findRemoteStateSources(root)
+	linker.warnings = warnings
+
+	deployments := make(map[string]string)
+	for _, source := range sources {
+		binding := &remoteStateBinding{
+			source:    source,
+			outputs:   make(map[string]struct{}),
+			variables: make(map[string]string),
+		}
+		linker.bindings[source.Resource.Name] = binding
+
+		for _, identifier := range source.Identifiers {
+			if producer, ok := byName[normalizeRemoteStateIdentifier(identifier)]; ok {
+				binding.producer = producer
+				break
+			}
+		}
+		if binding.producer == nil {
+			continue
+		}
+		if source.Resource.Count != nil || source.Resource.ForEach != nil {
+			binding.unsupported = "Remote state data sources that use count or for_each cannot be translated, read each workspace through its own data source."
+		}
+
+		binding.link = &RemoteStateLink{DataSource: source.Resource.Addr(), Producer: binding.producer.Component, Stack: binding.producer.Stack}
+		if stack := binding.producer.Stack; stack != "" {
+			if deployment, ok := deployments[stack]; ok && deployment != binding.producer.Deployment {
+				linker.shared[stack] = true
+			}
+			deployments[stack] = binding.producer.Deployment
+		}
+	}
+
+	return linker, nil
+}
+
+// Translate returns the edit replacing a reference to a terraform_remote_state data source, or the reason
+// the reference cannot be translated.
+func (l *remoteStateLinker) Translate(ref *hclsyntax.ScopeTraversalExpr) (*tfconfigutil.TextEdit, string) {
+	traversal := ref.Traversal
+	if len(traversal) < 3 {
+		return nil, "Refer to the outputs of a remote state data source instead."
+	}
+	name, ok := traversal[2].(hcl.TraverseAttr)
+	if !ok {
+		return nil, "Refer to the outputs of a remote state data source instead."
+	}
+	binding, ok := l.bindings[name.Name]
+	if !ok {
+		return nil, fmt.Sprintf("The root module does not declare data.%s.%s.", remoteStateDataSourceType, name.Name)
+	}
+	if binding.producer == nil {
+		return nil, "The workspace this data source reads has not been migrated yet. Migrate it first and list it as a remote state producer."
+	}
+	if binding.unsupported != "" {
+		return nil, binding.unsupported
+	}
+	output, steps, ok := remoteStateOutput(traversal)
+	if !ok {
+		return nil, "Only the outputs of a remote state data source can be translated."
+	}
+
+	var replacement hcl.Traversal
+	if binding.producer.Component != "" {
+		replacement = hcl.Traversal{hcl.TraverseRoot{Name: "component"}, hcl.TraverseAttr{Name: binding.producer.Component}}
+		if output != "" {
+			replacement = append(replacement, outputStep(output))
+			binding.outputs[output] = struct{}{}
+		} else {
+			binding.outputs["*"] = struct{}{}
+		}
+	} else {
+		if output == "" {
+			return nil, "Linked stacks only publish single outputs, refer to the outputs of the remote state by name."
+		}
+		replacement = hcl.Traversal{hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: l.linkedVariable(binding, output)}}
+	}
+
+	return &tfconfigutil.TextEdit{
+		Start: traversal[0].SourceRange().Start.Byte,
+		End:   traversal[steps-1].SourceRange().End.Byte,
+		Text:  tfconfigutil.TraversalString(replacement),
+	}, ""
+}
+
+// linkedVariable returns the stack variable replacing an output of a linked stack, declaring it on first use.
+func (l *remoteStateLinker) linkedVariable(binding *remoteStateBinding, output string) string {
+	if variable, ok := binding.variables[output]; ok {
+		return variable
+	}
+
+	stack := binding.producer.Stack
+	upstream, ok := l.upstreams[stack]
+	if !ok {
+		upstream = regexp.MustCompile(invalidIdentifierChars).ReplaceAllString(filepath.Base(stack), "_")
+		if !hclsyntax.ValidIdentifier(upstream) {
+			upstream = upstreamInputNameFallback + "_" + upstream
+		}
+		used := make(map[string]bool)
+		for _, existing := range l.upstreams {
+			used[existing] = true
+		}
+		base := upstream
+		for i := 2; used[upstream]; i++ {
+			upstream = fmt.Sprintf("%s_%d", base, i)
+		}
+		l.upstreams[stack] = upstream
+		l.published[stack] = make(map[string]*publishedOutput)
+	}
+
+	// a stack publishes each output once, so outputs of several of its deployments are told apart by prefix
+	published := output
+	if l.shared[stack] {
+		published = binding.producer.Deployment + "_" + output
+	}
+	l.published[stack][published] = &publishedOutput{Name: published, Deployment: binding.producer.Deployment, Output: output}
+
+	base := regexp.MustCompile(invalidIdentifierChars).ReplaceAllString(binding.source.Resource.Name+"_"+output, "_")
+	variable := base
+	for i := 2; l.taken[variable]; i++ {
+		variable = fmt.Sprintf("%s_%d", base, i)
+	}
+	l.taken[variable] = true
+	l.variables[variable] = stack
+
+	binding.variables[output] = variable
+	binding.outputs[output] = struct{}{}
+	binding.link.UpstreamInput = upstream
+	if binding.link.Variables == nil {
+		binding.link.Variables = make(map[string]string)
+	}
+	binding.link.Variables[variable] = tfconfigutil.TraversalString(hcl.Traversal{
+		hcl.TraverseRoot{Name: "upstream_input"},
+		hcl.TraverseAttr{Name: upstream},
+		outputStep(published),
+	})
+	return variable
+}
+
+// Links returns the data sources whose references were translated.
+func (l *remoteStateLinker) Links() []*RemoteStateLink {
+	var links []*RemoteStateLink
+	for _, name := range tfconfigutil.SortedKeys(l.bindings) {
+		binding := l.bindings[name]
+		if binding.link == nil || len(binding.outputs) == 0 {
+			continue
+		}
+		binding.link.Outputs = tfconfigutil.SortedKeys(binding.outputs)
+		links = append(links, binding.link)
+	}
+	return links
+}
+
+// PendingProducers returns the workspaces read through terraform_remote_state that have not been migrated yet.
+func (l *remoteStateLinker) PendingProducers() []string {
+	var pending []string
+	for _, name := range tfconfigutil.SortedKeys(l.bindings) {
+		binding := l.bindings[name]
+		if binding.producer != nil {
+			continue
+		}
+		if len(binding.source.Identifiers) == 0 {
+			pending = append(pending, binding.source.Resource.Addr())
+			continue
+		}
+		pending = append(pending, binding.source.Identifiers[0])
+	}
+	return pending
+}
+
+// generateVariableBlocks appends the stack variables that replace the outputs of linked stacks.
+func (l *remoteStateLinker) generateVariableBlocks(body *hclwrite.Body) {
+	for _, name := range tfconfigutil.SortedKeys(l.variables) {
+		if len(body.Blocks()) > 0 {
+			body.AppendNewline()
+		}
+		variable := body.AppendNewBlock("variable", []string{name})
+		variable.Body().SetAttributeRaw("type", hclwrite.TokensForIdentifier("any"))
+		variable.Body().SetAttributeValue("description", cty.StringVal(fmt.Sprintf("Published by the linked stack %s.", l.variables[name])))
+	}
+}
+
+// generateUpstreamInputsFile returns the upstream_input blocks of the linked stacks, or nil if there are none.
+func (l *remoteStateLinker) generateUpstreamInputsFile() *hclwrite.File {
+	if len(l.upstreams) == 0 {
+		return nil
+	}
+	file := hclwrite.NewEmptyFile()
+	stacks := tfconfigutil.SortedKeys(l.upstreams)
+	sort.Slice(stacks, func(i, j int) bool {
+		return l.upstreams[stacks[i]] < l.upstreams[stacks[j]]
+	})
+	for i, stack := range stacks {
+		if i > 0 {
+			file.Body().AppendNewline()
+		}
+		upstream := file.Body().AppendNewBlock("upstream_input", []string{l.upstreams[stack]})
+		upstream.Body().SetAttributeValue("type", cty.StringVal(upstreamInputStackType))
+		upstream.Body().SetAttributeValue("source", cty.StringVal(stack))
+	}
+	return file
+}
+
+// generatePublishOutputsFiles returns, for each linked stack, the publish_output blocks it must add to its
+// deployment configuration, keyed by the upstream_input name of the stack.
+func (l *remoteStateLinker) generatePublishOutputsFiles() map[string]*hclwrite.File {
+	files := make(map[string]*hclwrite.File)
+	for stack, outputs := range l.published {
+		file := hclwrite.NewEmptyFile()
+		for i, name := range tfconfigutil.SortedKeys(outputs) {
+			if i > 0 {
+				file.Body().AppendNewline()
+			}
+			output := outputs[name]
+			block := file.Body().AppendNewBlock("publish_output", []string{name})
+			block.Body().SetAttributeRaw("value", hclwrite.TokensForTraversal(hcl.Traversal{
+				hcl.TraverseRoot{Name: "deployment"},
+				hcl.TraverseAttr{Name: output.Deployment},
+				outputStep(output.Output),
+			}))
+		}
+		files[l.upstreams[stack]] = file
+	}
+	return files
+}
+
+// outputStep returns the traversal step selecting an output, as an attribute if the name allows it.
+func outputStep(name string) hcl.Traverser {
+	if hclsyntax.ValidIdentifier(name) {
+		return hcl.TraverseAttr{Name: name}
+	}
+	return hcl.TraverseIndex{Key: cty.StringVal(name)}
+}
@@ -0,0 +1,763 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackconfigutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	mergedComponentsDirName      = `components`
+	remoteStateVariablesFileName = `remote_state_variables.tf`
+	componentProvidersFileName   = `component_providers.tf`
+	defaultStateFileName         = `terraform.tfstate`
+)
+
+// MergeWorkspace is a workspace whose root module becomes one component of a merged stack.
+type MergeWorkspace struct {
+	Component                   string   // Component is the name of the component the workspace becomes.
+	TerraformConfigFilesAbsPath string   // TerraformConfigFilesAbsPath is the absolute path to the root module of the workspace.
+	RemoteStateNames            []string // RemoteStateNames are the names other workspaces read this workspace by through terraform_remote_state, such as its HCP Terraform workspace name, its backend key or its state file path. Defaults to the component name.
+}
+
+// MergeWorkspacesRequest represents the request parameters for merging the root modules of several workspaces
+// into one stack, with one component per workspace.
+type MergeWorkspacesRequest struct {
+	Workspaces               []MergeWorkspace
+	StackSourceBundleAbsPath string // StackSourceBundleAbsPath is the output directory the stack configuration and the component modules are written to.
+}
+
+// remoteStateInput is a variable that replaces the uses of one remote state output in a component module.
+type remoteStateInput struct {
+	Variable string
+	Output   string // Output is the name of the producer output, or empty for the whole set of outputs.
+}
+
+// mergedComponent holds what is generated for the root module of one workspace.
+type mergedComponent struct {
+	MergeWorkspace
+	root       *tfconfigutil.Module
+	dir        string
+	edits      map[string][]tfconfigutil.TextEdit
+	files      map[string][]byte
+	varNames   map[string]string
+	inputs     map[string]hcl.Traversal
+	providers  map[string]stackProviderRef
+	configs    map[stackProviderRef]*tfconfigutil.ProviderConfig
+	producers  map[string]struct{}
+	remoteVars []string
+}
+
+// MergeWorkspaceConfigs merges the root modules of several workspaces into one stack, turning each root module
+// into a component. The root modules are copied into the components directory of the stack without their provider
+// and backend configuration, which moves into the stack. terraform_remote_state data sources that read another of
+// the merged workspaces are replaced by variables, and the component passes the outputs of the component of that
+// workspace into them. Root module variables of the same name and type are merged into a single stack variable.
+func (s *stackConfigUtility) MergeWorkspaceConfigs(request MergeWorkspacesRequest) (*GeneratedStackConfig, error) {
+	if request.StackSourceBundleAbsPath == "" {
+		return nil, fmt.Errorf("the output directory of the merged stack must be set")
+	}
+	if len(request.Workspaces) == 0 {
+		return nil, fmt.Errorf("no workspaces to merge")
+	}
+
+	outputDir := request.StackSourceBundleAbsPath
+	result := &GeneratedStackConfig{Dir: outputDir, Files: make(map[string][]byte)}
+
+	var components []*mergedComponent
+	producers := make(map[string]string)
+	for _, workspace := range request.Workspaces {
+		if !hclsyntax.ValidIdentifier(workspace.Component) {
+			return nil, fmt.Errorf("%q is not a valid component name", workspace.Component)
+		}
+		for _, component := range components {
+			if component.Component == workspace.Component {
+				return nil, fmt.Errorf("the component %q is assigned to more than one workspace", workspace.Component)
+			}
+		}
+
+		root, err := tfconfigutil.LoadModule(s.hclParser, workspace.TerraformConfigFilesAbsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Terraform configuration of component %s, err: %v", workspace.Component, err)
+		}
+
+		component := &mergedComponent{
+			MergeWorkspace: workspace,
+			root:           root,
+			dir:            filepath.Join(outputDir, mergedComponentsDirName, workspace.Component),
+			edits:          make(map[string][]tfconfigutil.TextEdit),
+			files:          make(map[string][]byte),
+			varNames:       make(map[string]string),
+			inputs:         make(map[string]hcl.Traversal),
+			providers:      make(map[string]stackProviderRef),
+			configs:        make(map[stackProviderRef]*tfconfigutil.ProviderConfig),
+			producers:      make(map[string]struct{}),
+		}
+		components = append(components, component)
+
+		// copy the names, appending to the slice of the request could overwrite the array of the caller
+		names := slices.Clone(workspace.RemoteStateNames)
+		if len(names) == 0 {
+			names = []string{workspace.Component}
+		}
+		names = append(names, filepath.Join(root.Dir, defaultStateFileName))
+		for _, name := range names {
+			producers[normalizeRemoteStateIdentifier(name)] = workspace.Component
+		}
+	}
+
+	stackVariables, warnings := mergeStackVariables(components)
+	result.Warnings = append(result.Warnings, warnings...)
+
+	for _, component := range components {
+		links, warnings, err := component.linkRemoteStates(producers)
+		if err != nil {
+			return nil, err
+		}
+		result.Links = append(result.Links, links...)
+		result.Warnings = append(result.Warnings, warnings...)
+
+		warnings, err = component.moveProviderConfigs()
+		if err != nil {
+			return nil, err
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+
+		if err := component.detachBackend(); err != nil {
+			return nil, err
+		}
+		if err := component.retargetModuleSources(); err != nil {
+			return nil, err
+		}
+
+		warnings, err = component.writeModule(outputDir, result.Files)
+		if err != nil {
+			return nil, err
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+		result.Components = append(result.Components, component.Component)
+	}
+	result.Warnings = append(result.Warnings, remoteStateCycles(components)...)
+
+	files := make(map[string]*hclwrite.File)
+	componentsFile := hclwrite.NewEmptyFile()
+	for i, component := range components {
+		if i > 0 {
+			componentsFile.Body().AppendNewline()
+		}
+		component.generateComponentBlock(componentsFile.Body())
+	}
+	files[componentsFileName] = componentsFile
+
+	providersFile, warnings, err := generateMergedProvidersFile(components)
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = append(result.Warnings, warnings...)
+	files[providersFileName] = providersFile
+
+	if len(stackVariables) > 0 {
+		variablesFile := hclwrite.NewEmptyFile()
+		for i, name := range tfconfigutil.SortedKeys(stackVariables) {
+			if i > 0 {
+				variablesFile.Body().AppendNewline()
+			}
+			declaration := stackVariables[name]
+			writeFiles, err := parseWriteFiles(declaration.root.Files)
+			if err != nil {
+				return nil, err
+			}
+			generateVariableBlock(variablesFile.Body(), declaration.root, declaration.variable, writeFiles)
+			blocks := variablesFile.Body().Blocks()
+			blocks[len(blocks)-1].SetLabels([]string{name})
+		}
+		files[variablesFileName] = variablesFile
+	}
+
+	written, err := writeGeneratedFiles(outputDir, files)
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range written {
+		result.Files[name] = content
+	}
+
+	return result, nil
+}
+
+// mergedVariable is the root module variable a stack variable of a merged stack is declared after.
+type mergedVariable struct {
+	root     *tfconfigutil.Module
+	variable *tfconfigutil.Variable
+}
+
+// mergeStackVariables decides the stack variable each root module variable is passed from. Variables of the same
+// name and type share a stack variable, other name clashes are resolved by prefixing the component name.
+func mergeStackVariables(components []*mergedComponent) (map[string]*mergedVariable, []string) {
+	declared := make(map[string]*mergedVariable)
+	var warnings []string
+	for _, component := range components {
+		for _, name := range tfconfigutil.SortedKeys(component.root.Variables) {
+			variable := component.root.Variables[name]
+			existing, ok := declared[name]
+			if !ok {
+				declared[name] = &mergedVariable{root: component.root, variable: variable}
+				component.varNames[name] = name
+				continue
+			}
+			if variableTypeSource(existing.root, existing.variable) == variableTypeSource(component.root, variable) {
+				component.varNames[name] = name
+				continue
+			}
+
+			stackName := component.Component + "_" + name
+			for i := 2; declared[stackName] != nil; i++ {
+				stackName = fmt.Sprintf("%s_%s_%d", component.Component, name, i)
+			}
+			declared[stackName] = &mergedVariable{root: component.root, variable: variable}
+			component.varNames[name] = stackName
+			warnings = append(warnings, fmt.Sprintf("variable %s of component %s has a different type than in another workspace, it is passed from the stack variable %s", name, component.Component, stackName))
+		}
+	}
+	return declared, warnings
+}
+
+func variableTypeSource(root *tfconfigutil.Module, variable *tfconfigutil.Variable) string {
+	if variable.Type == nil {
+		return ""
+	}
+	return strings.TrimSpace(exprSource(root, variable.Type))
+}
+
+// linkRemoteStates replaces the terraform_remote_state data sources that read another merged workspace with
+// variables, whose values the component receives from the component of that workspace.
+func (c *mergedComponent) linkRemoteStates(producers map[string]string) ([]*RemoteStateLink, []string, error) {
+	sources, warnings := findRemoteStateSources(c.root)
+
+	taken := make(map[string]bool)
+	for name := range c.root.Variables {
+		taken[name] = true
+	}
+
+	var links []*RemoteStateLink
+	for _, source := range sources {
+		addr := source.Resource.Addr()
+		producer := ""
+		for _, identifier := range source.Identifiers {
+			if name, ok := producers[normalizeRemoteStateIdentifier(identifier)]; ok && name != c.Component {
+				producer = name
+				break
+			}
+		}
+		if producer == "" {
+			warnings = append(warnings, fmt.Sprintf("%s of component %s does not read any of the merged workspaces and is kept", addr, c.Component))
+			continue
+		}
+		if source.Resource.Count != nil || source.Resource.ForEach != nil {
+			warnings = append(warnings, fmt.Sprintf("%s of component %s uses count or for_each and must be replaced with component %s manually", addr, c.Component, producer))
+			continue
+		}
+
+		refs := remoteStateReferences(c.root, source.Resource.Name)
+		usable := true
+		for _, ref := range refs {
+			if _, _, ok := remoteStateOutput(ref.Traversal); !ok {
+				warnings = append(warnings, fmt.Sprintf("%s of component %s is referenced without reading its outputs at %s and must be replaced with component %s manually", addr, c.Component, ref.SrcRange, producer))
+				usable = false
+			}
+		}
+		if !usable {
+			continue
+		}
+
+		link := &RemoteStateLink{Consumer: c.Component, DataSource: addr, Producer: producer}
+		variables := make(map[string]*remoteStateInput)
+		for _, ref := range refs {
+			output, steps, _ := remoteStateOutput(ref.Traversal)
+			input, ok := variables[output]
+			if !ok {
+				suffix := output
+				if suffix == "" {
+					suffix = "outputs"
+				}
+				base := regexp.MustCompile(invalidIdentifierChars).ReplaceAllString(source.Resource.Name+"_"+suffix, "_")
+				name := base
+				for i := 2; taken[name]; i++ {
+					name = fmt.Sprintf("%s_%d", base, i)
+				}
+				taken[name] = true
+
+				input = &remoteStateInput{Variable: name, Output: output}
+				variables[output] = input
+				c.remoteVars = append(c.remoteVars, name)
+
+				traversal := hcl.Traversal{hcl.TraverseRoot{Name: "component"}, hcl.TraverseAttr{Name: producer}}
+				if output != "" {
+					traversal = append(traversal, hcl.TraverseAttr{Name: output})
+					link.Outputs = append(link.Outputs, output)
+				} else {
+					link.Outputs = append(link.Outputs, "*")
+				}
+				c.inputs[name] = traversal
+			}
+
+			c.edits[ref.SrcRange.Filename] = append(c.edits[ref.SrcRange.Filename], tfconfigutil.TextEdit{
+				Start: ref.Traversal[0].SourceRange().Start.Byte,
+				End:   ref.Traversal[steps-1].SourceRange().End.Byte,
+				Text:  "var." + input.Variable,
+			})
+		}
+		sort.Strings(link.Outputs)
+
+		filename := source.Block.Range().Filename
+		c.edits[filename] = append(c.edits[filename], tfconfigutil.RemoveBlockEdit(c.root.Files[filename].Bytes, source.Block))
+		c.producers[producer] = struct{}{}
+		links = append(links, link)
+	}
+
+	return links, warnings, nil
+}
+
+// moveProviderConfigs removes the provider blocks from the root module and records the stack provider
+// configuration each of them becomes. Provider configurations the root module uses implicitly become empty
+// stack provider configurations.
+func (c *mergedComponent) moveProviderConfigs() ([]string, error) {
+	var warnings []string
+	aliases := make(map[string][]string)
+
+	for _, addr := range tfconfigutil.SortedKeys(c.root.ProviderConfigs) {
+		providerConfig := c.root.ProviderConfigs[addr]
+		block := findSyntaxBlock(c.root.Files, providerConfig.DeclRange, "provider", []string{providerConfig.Name})
+		if block == nil {
+			return nil, fmt.Errorf("provider %s of component %s must be declared in native HCL syntax", addr, c.Component)
+		}
+
+		configName := c.Component
+		if providerConfig.Alias != "" {
+			configName += "_" + providerConfig.Alias
+			aliases[providerConfig.Name] = append(aliases[providerConfig.Name], addr)
+		}
+		ref := stackProviderRef{LocalName: providerConfig.Name, ConfigName: configName}
+		c.providers[addr] = ref
+		c.configs[ref] = providerConfig
+
+		filename := block.Range().Filename
+		c.edits[filename] = append(c.edits[filename], tfconfigutil.RemoveBlockEdit(c.root.Files[filename].Bytes, block))
+	}
+
+	for _, localName := range c.root.ProviderLocalNames() {
+		if _, ok := c.providers[localName]; ok || tfconfigutil.IsBuiltinProviderSource(c.root.ProviderSource(localName)) {
+			continue
+		}
+		ref := stackProviderRef{LocalName: localName, ConfigName: c.Component}
+		c.providers[localName] = ref
+		c.configs[ref] = nil
+	}
+
+	// the aliased configurations are passed in by the stack, so the module has to declare them
+	var missing []string
+	for _, localName := range tfconfigutil.SortedKeys(aliases) {
+		aliasTokens := "configuration_aliases = [" + strings.Join(aliases[localName], ", ") + "]"
+
+		requiredProvider, ok := c.root.RequiredProviders[localName]
+		if !ok {
+			missing = append(missing, localName+" = {\nsource = "+strconv.Quote(strings.TrimPrefix(c.root.ProviderSource(localName), "registry.terraform.io/"))+"\n"+aliasTokens+"\n}")
+			continue
+		}
+		entry := findRequiredProviderExpr(c.root, requiredProvider)
+		if entry == nil {
+			warnings = append(warnings, fmt.Sprintf("add %s to the required_providers entry of %s in component %s", aliasTokens, localName, c.Component))
+			continue
+		}
+		for _, item := range entry.Items {
+			if key := hcl.ExprAsKeyword(item.KeyExpr); key == "configuration_aliases" {
+				warnings = append(warnings, fmt.Sprintf("the required_providers entry of %s in component %s already declares configuration_aliases, make sure it lists %v", localName, c.Component, aliases[localName]))
+				entry = nil
+				break
+			}
+		}
+		if entry == nil {
+			continue
+		}
+		closing := entry.SrcRange.End.Byte - 1
+		text := aliasTokens + "\n"
+		if src := c.root.Files[entry.SrcRange.Filename].Bytes; !strings.HasSuffix(strings.TrimRight(string(src[:closing]), " \t"), "\n") {
+			text = "\n" + text
+		}
+		c.edits[entry.SrcRange.Filename] = append(c.edits[entry.SrcRange.Filename], tfconfigutil.TextEdit{
+			Start: closing,
+			End:   closing,
+			Text:  text,
+		})
+	}
+	if len(missing) > 0 {
+		c.files[componentProvidersFileName] = []byte("terraform {\nrequired_providers {\n" + strings.Join(missing, "\n") + "\n}\n}\n")
+	}
+
+	return warnings, nil
+}
+
+// findRequiredProviderExpr returns the object expression of a required_providers entry, or nil if the entry
+// is not written as an object in native syntax.
+func findRequiredProviderExpr(root *tfconfigutil.Module, requiredProvider *tfconfigutil.RequiredProvider) *hclsyntax.ObjectConsExpr {
+	file, ok := root.Files[requiredProvider.DeclRange.Filename]
+	if !ok {
+		return nil
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" {
+			continue
+		}
+		for _, nested := range block.Body.Blocks {
+			if nested.Type != "required_providers" {
+				continue
+			}
+			if attr, ok := nested.Body.Attributes[requiredProvider.Name]; ok {
+				if object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr); ok {
+					return object
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// detachBackend removes the backend or cloud block, the state of a component is managed by the stack.
+func (c *mergedComponent) detachBackend() error {
+	if c.root.Backend == nil {
+		return nil
+	}
+	filename := c.root.Backend.DeclRange.Filename
+	file, ok := c.root.Files[filename]
+	if !ok {
+		return nil
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return fmt.Errorf("the backend of component %s must be declared in native HCL syntax", c.Component)
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" {
+			continue
+		}
+		for _, nested := range block.Body.Blocks {
+			if nested.DefRange().Start.Byte != c.root.Backend.DeclRange.Start.Byte {
+				continue
+			}
+			// drop the terraform block altogether if the backend is all it declares
+			if len(block.Body.Blocks) == 1 && len(block.Body.Attributes) == 0 {
+				nested = block
+			}
+			c.edits[filename] = append(c.edits[filename], tfconfigutil.RemoveBlockEdit(file.Bytes, nested))
+			return nil
+		}
+	}
+	return nil
+}
+
+// retargetModuleSources rewrites local module sources so that they still point at the original module
+// directories from the copied root module.
+func (c *mergedComponent) retargetModuleSources() error {
+	for _, name := range tfconfigutil.SortedKeys(c.root.ModuleCalls) {
+		moduleCall := c.root.ModuleCalls[name]
+		if !tfconfigutil.IsLocalModuleSource(moduleCall.Source) {
+			continue
+		}
+		block := findSyntaxBlock(c.root.Files, moduleCall.DeclRange, "module", []string{name})
+		if block == nil {
+			return fmt.Errorf("module %s of component %s must be declared in native HCL syntax", name, c.Component)
+		}
+		source, err := relativeModuleSource(c.dir, filepath.Join(c.root.Dir, moduleCall.Source))
+		if err != nil {
+			return fmt.Errorf("failed to resolve source of module %s of component %s: %w", name, c.Component, err)
+		}
+		rng := block.Body.Attributes["source"].Expr.Range()
+		c.edits[rng.Filename] = append(c.edits[rng.Filename], tfconfigutil.TextEdit{
+			Start: rng.Start.Byte,
+			End:   rng.End.Byte,
+			Text:  strconv.Quote(source),
+		})
+	}
+	return nil
+}
+
+// relativeModuleSource returns the local module source address of target as seen from dir.
+func relativeModuleSource(dir string, target string) (string, error) {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel, nil
+}
+
+// writeModule writes the edited root module files and the variables replacing the remote states into the
+// component directory, recording them under their path relative to the output directory.
+func (c *mergedComponent) writeModule(outputDir string, written map[string][]byte) ([]string, error) {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", c.dir, err)
+	}
+
+	var warnings []string
+	files := make(map[string][]byte)
+	for _, filename := range tfconfigutil.SortedKeys(c.root.Files) {
+		src := c.root.Files[filename].Bytes
+		if filepath.Ext(filename) != ".tf" {
+			warnings = append(warnings, fmt.Sprintf("%s of component %s is copied unchanged, move its provider and backend configuration into the stack manually", filepath.Base(filename), c.Component))
+			files[filepath.Base(filename)] = src
+			continue
+		}
+		content, err := tfconfigutil.ApplyTextEdits(src, 0, len(src), c.edits[filename])
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite %s of component %s: %w", filepath.Base(filename), c.Component, err)
+		}
+		files[filepath.Base(filename)] = hclwrite.Format(content)
+	}
+
+	for name, content := range c.files {
+		files[name] = hclwrite.Format(content)
+	}
+
+	if len(c.remoteVars) > 0 {
+		file := hclwrite.NewEmptyFile()
+		for i, name := range c.remoteVars {
+			if i > 0 {
+				file.Body().AppendNewline()
+			}
+			variable := file.Body().AppendNewBlock("variable", []string{name})
+			variable.Body().SetAttributeRaw("type", hclwrite.TokensForIdentifier("any"))
+		}
+		files[remoteStateVariablesFileName] = hclwrite.Format(file.Bytes())
+	}
+
+	for name, content := range files {
+		path := filepath.Join(c.dir, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return nil, err
+		}
+		written[filepath.ToSlash(rel)] = content
+	}
+
+	return warnings, nil
+}
+
+// generateComponentBlock appends the component block of the merged root module.
+func (c *mergedComponent) generateComponentBlock(body *hclwrite.Body) {
+	component := body.AppendNewBlock("component", []string{c.Component})
+	component.Body().SetAttributeValue("source", cty.StringVal("./"+mergedComponentsDirName+"/"+c.Component))
+
+	var inputs []hclwrite.ObjectAttrTokens
+	for _, name := range tfconfigutil.SortedKeys(c.varNames) {
+		inputs = append(inputs, hclwrite.ObjectAttrTokens{
+			Name:  hclwrite.TokensForIdentifier(name),
+			Value: hclwrite.TokensForTraversal(hcl.Traversal{hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: c.varNames[name]}}),
+		})
+	}
+	for _, name := range c.remoteVars {
+		inputs = append(inputs, hclwrite.ObjectAttrTokens{
+			Name:  hclwrite.TokensForIdentifier(name),
+			Value: hclwrite.TokensForTraversal(c.inputs[name]),
+		})
+	}
+	component.Body().SetAttributeRaw("inputs", hclwrite.TokensForObject(inputs))
+
+	var providers []hclwrite.ObjectAttrTokens
+	for _, addr := range tfconfigutil.SortedKeys(c.providers) {
+		providers = append(providers, hclwrite.ObjectAttrTokens{
+			Name:  hclwrite.TokensForTraversal(localProviderTraversal(addr)),
+			Value: hclwrite.TokensForTraversal(c.providers[addr].Traversal()),
+		})
+	}
+	component.Body().SetAttributeRaw("providers", hclwrite.TokensForObject(providers))
+}
+
+// generateMergedProvidersFile builds the required_providers block and the provider blocks of all components.
+func generateMergedProvidersFile(components []*mergedComponent) (*hclwrite.File, []string, error) {
+	var warnings []string
+	type requirement struct {
+		source, version, component string
+	}
+	requirements := make(map[string]requirement)
+	for _, component := range components {
+		for _, addr := range tfconfigutil.SortedKeys(component.providers) {
+			localName := component.providers[addr].LocalName
+			source, version := requiredProviderFor(localName, component.root, nil)
+			existing, ok := requirements[localName]
+			if !ok {
+				requirements[localName] = requirement{source: source, version: version, component: component.Component}
+				continue
+			}
+			if tfconfigutil.NormalizeProviderSource(existing.source) != tfconfigutil.NormalizeProviderSource(source) {
+				return nil, nil, fmt.Errorf("components %s and %s use different providers %s and %s under the local name %s", existing.component, component.Component, existing.source, source, localName)
+			}
+			if existing.version != version && version != "" {
+				warnings = append(warnings, fmt.Sprintf("component %s requires %s %s, the stack keeps the constraint %q of component %s", component.Component, localName, version, existing.version, existing.component))
+			}
+		}
+	}
+
+	file := hclwrite.NewEmptyFile()
+	requiredProviders := file.Body().AppendNewBlock("required_providers", nil)
+	for _, localName := range tfconfigutil.SortedKeys(requirements) {
+		attrs := []hclwrite.ObjectAttrTokens{
+			{Name: hclwrite.TokensForIdentifier("source"), Value: hclwrite.TokensForValue(cty.StringVal(requirements[localName].source))},
+		}
+		if version := requirements[localName].version; version != "" {
+			attrs = append(attrs, hclwrite.ObjectAttrTokens{Name: hclwrite.TokensForIdentifier("version"), Value: hclwrite.TokensForValue(cty.StringVal(version))})
+		}
+		requiredProviders.Body().SetAttributeRaw(localName, hclwrite.TokensForObject(attrs))
+	}
+
+	for _, component := range components {
+		refs := make([]stackProviderRef, 0, len(component.configs))
+		for ref := range component.configs {
+			refs = append(refs, ref)
+		}
+		sort.Slice(refs, func(i, j int) bool {
+			if refs[i].LocalName != refs[j].LocalName {
+				return refs[i].LocalName < refs[j].LocalName
+			}
+			return refs[i].ConfigName < refs[j].ConfigName
+		})
+
+		for _, ref := range refs {
+			file.Body().AppendNewline()
+			provider := file.Body().AppendNewBlock("provider", []string{ref.LocalName, ref.ConfigName})
+			config := provider.Body().AppendNewBlock("config", nil)
+			if component.configs[ref] == nil {
+				continue
+			}
+			tokens, configWarnings, err := component.providerConfigTokens(component.configs[ref])
+			if err != nil {
+				return nil, nil, err
+			}
+			warnings = append(warnings, configWarnings...)
+			config.Body().AppendUnstructuredTokens(tokens)
+		}
+	}
+
+	return file, warnings, nil
+}
+
+// providerConfigTokens returns the body of a root module provider block as the config of a stack provider,
+// with the variables renamed to the stack variables they are passed from.
+func (c *mergedComponent) providerConfigTokens(providerConfig *tfconfigutil.ProviderConfig) (hclwrite.Tokens, []string, error) {
+	block := findSyntaxBlock(c.root.Files, providerConfig.DeclRange, "provider", []string{providerConfig.Name})
+	if block == nil {
+		return nil, nil, fmt.Errorf("provider %s of component %s must be declared in native HCL syntax", providerConfig.Addr(), c.Component)
+	}
+
+	var warnings []string
+	var edits []tfconfigutil.TextEdit
+	hclsyntax.VisitAll(block.Body, func(node hclsyntax.Node) hcl.Diagnostics {
+		ref, ok := node.(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+		if ref.Traversal.RootName() != "var" || len(ref.Traversal) < 2 {
+			warnings = append(warnings, fmt.Sprintf("provider %s of component %s refers to %s, which has no equivalent in the stack", providerConfig.Addr(), c.Component, tfconfigutil.TraversalString(ref.Traversal)))
+			return nil
+		}
+		attr, ok := ref.Traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			return nil
+		}
+		if stackName, ok := c.varNames[attr.Name]; ok && stackName != attr.Name {
+			edits = append(edits, tfconfigutil.TextEdit{
+				Start: attr.SrcRange.Start.Byte,
+				End:   attr.SrcRange.End.Byte,
+				Text:  "." + stackName,
+			})
+		}
+		return nil
+	})
+
+	src := c.root.Files[block.Range().Filename].Bytes
+	inner, err := tfconfigutil.ApplyTextEdits(src, block.OpenBraceRange.End.Byte, block.CloseBraceRange.Start.Byte, edits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to rewrite provider %s of component %s: %w", providerConfig.Addr(), c.Component, err)
+	}
+	file, diags := hclwrite.ParseConfig(inner, block.Range().Filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, nil, fmt.Errorf("failed to parse provider %s of component %s, err: %v", providerConfig.Addr(), c.Component, diags.Error())
+	}
+	file.Body().RemoveAttribute("alias")
+	file.Body().RemoveAttribute("version")
+
+	return trimLeadingNewlines(file.Body().BuildTokens(nil)), warnings, nil
+}
+
+// remoteStateCycles reports components that read each other's outputs, which a stack cannot evaluate.
+func remoteStateCycles(components []*mergedComponent) []string {
+	byName := make(map[string]*mergedComponent)
+	for _, component := range components {
+		byName[component.Component] = component
+	}
+
+	var warnings []string
+	state := make(map[string]int)
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch state[name] {
+		case 1:
+			warnings = append(warnings, fmt.Sprintf("components %s read each other's outputs, which creates a dependency cycle", strings.Join(append(path, name), " -> ")))
+			return
+		case 2:
+			return
+		}
+		state[name] = 1
+		for _, producer := range tfconfigutil.SortedKeys(byName[name].producers) {
+			visit(producer, append(path, name))
+		}
+		state[name] = 2
+	}
+	for _, component := range components {
+		visit(component.Component, nil)
+	}
+	return warnings
+}
+
+// findSyntaxBlock returns the native syntax block of the given type and labels that is declared at declRange,
+// or nil if there is none.
+func findSyntaxBlock(files map[string]*hcl.File, declRange hcl.Range, blockType string, labels []string) *hclsyntax.Block {
+	file, ok := files[declRange.Filename]
+	if !ok {
+		return nil
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+	for _, block := range body.Blocks {
+		if block.Type == blockType && equalLabels(block.Labels, labels) && block.DefRange().Start.Byte == declRange.Start.Byte {
+			return block
+		}
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/hashicorp/terraform-migrate-utility/stateops"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	identifierExpression = `^[A-Za-z_][A-Za-z0-9_-]*$`
+)
+
+// StackStateDiffFormat is the output format of a stack state diff.
+type StackStateDiffFormat string
+
+const (
+	StackStateDiffFormatText StackStateDiffFormat = "text"
+	StackStateDiffFormatJSON StackStateDiffFormat = "json"
+)
+
+// StackStateChangeAction describes how an entry of a stack state changed between two snapshots.
+type StackStateChangeAction string
+
+const (
+	StackStateChangeAdded   StackStateChangeAction = "added"
+	StackStateChangeRemoved StackStateChangeAction = "removed"
+	StackStateChangeChanged StackStateChangeAction = "changed"
+)
+
+// ValueChange is a difference in one value between two snapshots. Sensitive values are redacted.
+type ValueChange struct {
+	Path string `json:"path"`          // Path is the path of the changed value, such as tags.Name or status.
+	Old  any    `json:"old,omitempty"` // Old is the value in the old snapshot, or nil if the value was added.
+	New  any    `json:"new,omitempty"` // New is the value in the new snapshot, or nil if the value was removed.
+}
+
+// ComponentInstanceDiff describes the changes to one component instance.
+type ComponentInstanceDiff struct {
+	Addr            string                 `json:"addr"`
+	Action          StackStateChangeAction `json:"action"`
+	OutputChanges   []*ValueChange         `json:"output_changes,omitempty"`   // OutputChanges are the changes of the output values.
+	InputChanges    []*ValueChange         `json:"input_changes,omitempty"`    // InputChanges are the changes of the input variables.
+	MetadataChanges []*ValueChange         `json:"metadata_changes,omitempty"` // MetadataChanges are the changes of the dependency and dependent addresses.
+}
+
+// ResourceInstanceDiff describes the changes to one resource instance object.
+type ResourceInstanceDiff struct {
+	Addr             string                 `json:"addr"`
+	DeposedKey       string                 `json:"deposed_key,omitempty"`
+	Action           StackStateChangeAction `json:"action"`
+	AttributeChanges []*ValueChange         `json:"attribute_changes,omitempty"` // AttributeChanges are the changes of the attributes of the object value.
+	MetadataChanges  []*ValueChange         `json:"metadata_changes,omitempty"`  // MetadataChanges are the changes of the status, dependencies, provider configuration and other fields.
+}
+
+// RawEntryDiff describes a change to a raw entry the decoder does not recognize, compared verbatim.
+type RawEntryDiff struct {
+	Key    string                 `json:"key"`
+	Action StackStateChangeAction `json:"action"`
+}
+
+// StackStateDiff is the difference between two stack state snapshots.
+type StackStateDiff struct {
+	OldPath    string                   `json:"old_path"`
+	NewPath    string                   `json:"new_path"`
+	Components []*ComponentInstanceDiff `json:"components,omitempty"`
+	Resources  []*ResourceInstanceDiff  `json:"resources,omitempty"`
+	RawEntries []*RawEntryDiff          `json:"raw_entries,omitempty"` // RawEntries are the changes of the unrecognized raw entries.
+}
+
+// IsEmpty reports whether the two snapshots hold the same state.
+func (d *StackStateDiff) IsEmpty() bool {
+	return len(d.Components) == 0 && len(d.Resources) == 0 && len(d.RawEntries) == 0
+}
+
+// DiffStackStates compares two stack state snapshots and lists the component instances and resource instance
+// objects that were added, removed or changed, down to the attributes of the resource values.
+func (s *stackStateUtility) DiffStackStates(oldPath string, newPath string) (*StackStateDiff, error) {
+	oldState, err := stateops.ReadStackStateSnapshot(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newState, err := stateops.ReadStackStateSnapshot(newPath)
+	if err != nil {
+		return nil, err
+	}
+	oldModel, err := s.DecodeStackState(oldState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stack state %s: %w", oldPath, err)
+	}
+	newModel, err := s.DecodeStackState(newState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stack state %s: %w", newPath, err)
+	}
+
+	diff := &StackStateDiff{OldPath: oldPath, NewPath: newPath}
+	for _, addr := range unionKeys(oldModel.Components, newModel.Components) {
+		oldComponent, newComponent := oldModel.Components[addr], newModel.Components[addr]
+		if oldComponent != nil && oldComponent.RawKey == "" {
+			oldComponent = nil
+		}
+		if newComponent != nil && newComponent.RawKey == "" {
+			newComponent = nil
+		}
+		if component := diffComponentInstances(addr, oldComponent, newComponent); component != nil {
+			diff.Components = append(diff.Components, component)
+		}
+	}
+
+	oldObjects, newObjects := objectsByKey(oldModel), objectsByKey(newModel)
+	for _, key := range unionKeys(oldObjects, newObjects) {
+		resource, err := diffResourceObjects(oldObjects[key], newObjects[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s: %w", key, err)
+		}
+		if resource != nil {
+			diff.Resources = append(diff.Resources, resource)
+		}
+	}
+
+	oldRaw, newRaw := unrecognizedKeys(oldModel), unrecognizedKeys(newModel)
+	for _, key := range unionKeys(oldRaw, newRaw) {
+		switch {
+		case !oldRaw[key]:
+			diff.RawEntries = append(diff.RawEntries, &RawEntryDiff{Key: key, Action: StackStateChangeAdded})
+		case !newRaw[key]:
+			diff.RawEntries = append(diff.RawEntries, &RawEntryDiff{Key: key, Action: StackStateChangeRemoved})
+		case !proto.Equal(oldState.Raw[key], newState.Raw[key]):
+			diff.RawEntries = append(diff.RawEntries, &RawEntryDiff{Key: key, Action: StackStateChangeChanged})
+		}
+	}
+
+	return diff, nil
+}
+
+// Write writes the diff in the given format.
+func (d *StackStateDiff) Write(w io.Writer, format StackStateDiffFormat) error {
+	switch format {
+	case StackStateDiffFormatJSON:
+		encoded, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode stack state diff: %w", err)
+		}
+		_, err = w.Write(append(encoded, '\n'))
+		return err
+	case StackStateDiffFormatText, "":
+	default:
+		return fmt.Errorf("unknown stack state diff format %q", format)
+	}
+
+	var buf bytes.Buffer
+	if d.IsEmpty() {
+		fmt.Fprintf(&buf, "No changes between %s and %s.\n", d.OldPath, d.NewPath)
+	}
+	for _, component := range d.Components {
+		fmt.Fprintf(&buf, "%s %s\n", actionSymbol(component.Action), component.Addr)
+		writeValueChanges(&buf, "output ", component.OutputChanges)
+		writeValueChanges(&buf, "input ", component.InputChanges)
+		writeValueChanges(&buf, "", component.MetadataChanges)
+	}
+	for _, resource := range d.Resources {
+		if resource.DeposedKey == "" {
+			fmt.Fprintf(&buf, "%s %s\n", actionSymbol(resource.Action), resource.Addr)
+		} else {
+			fmt.Fprintf(&buf, "%s %s (deposed object %s)\n", actionSymbol(resource.Action), resource.Addr, resource.DeposedKey)
+		}
+		writeValueChanges(&buf, "", resource.AttributeChanges)
+		writeValueChanges(&buf, "", resource.MetadataChanges)
+	}
+	for _, raw := range d.RawEntries {
+		fmt.Fprintf(&buf, "%s raw entry %s\n", actionSymbol(raw.Action), raw.Key)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// diffComponentInstances compares the state of a component instance in two snapshots, it returns nil if the state
+// did not change.
+func diffComponentInstances(addr string, oldComponent *ComponentInstanceState, newComponent *ComponentInstanceState) *ComponentInstanceDiff {
+	switch {
+	case oldComponent == nil && newComponent == nil:
+		return nil
+	case oldComponent == nil:
+		return &ComponentInstanceDiff{Addr: addr, Action: StackStateChangeAdded}
+	case newComponent == nil:
+		return &ComponentInstanceDiff{Addr: addr, Action: StackStateChangeRemoved}
+	}
+
+	diff := &ComponentInstanceDiff{
+		Addr:          addr,
+		Action:        StackStateChangeChanged,
+		OutputChanges: diffDecodedValues(oldComponent.OutputValues, newComponent.OutputValues),
+		InputChanges:  diffDecodedValues(oldComponent.InputVariables, newComponent.InputVariables),
+	}
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "dependency_addrs", oldComponent.DependencyAddrs, newComponent.DependencyAddrs)
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "dependent_addrs", oldComponent.DependentAddrs, newComponent.DependentAddrs)
+	if len(diff.OutputChanges) == 0 && len(diff.InputChanges) == 0 && len(diff.MetadataChanges) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// diffResourceObjects compares a resource instance object in two snapshots, it returns nil if the object did not
+// change.
+func diffResourceObjects(oldObject *ResourceInstanceObjectState, newObject *ResourceInstanceObjectState) (*ResourceInstanceDiff, error) {
+	switch {
+	case oldObject == nil:
+		return &ResourceInstanceDiff{Addr: newObject.StackAddr(), DeposedKey: newObject.DeposedKey, Action: StackStateChangeAdded}, nil
+	case newObject == nil:
+		return &ResourceInstanceDiff{Addr: oldObject.StackAddr(), DeposedKey: oldObject.DeposedKey, Action: StackStateChangeRemoved}, nil
+	}
+
+	oldValue, err := redactedJSON(oldObject.ValueJSON, nil)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := redactedJSON(newObject.ValueJSON, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ResourceInstanceDiff{Addr: oldObject.StackAddr(), DeposedKey: oldObject.DeposedKey, Action: StackStateChangeChanged}
+	diff.AttributeChanges = diffValues("", nil, oldValue, newValue, oldObject.SensitivePaths, newObject.SensitivePaths, nil)
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "status", strings.ToLower(oldObject.Status.String()), strings.ToLower(newObject.Status.String()))
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "dependencies", oldObject.Dependencies, newObject.Dependencies)
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "provider_config_addr", oldObject.ProviderConfigAddr, newObject.ProviderConfigAddr)
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "schema_version", oldObject.SchemaVersion, newObject.SchemaVersion)
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "create_before_destroy", oldObject.CreateBeforeDestroy, newObject.CreateBeforeDestroy)
+	diff.MetadataChanges = appendFieldChange(diff.MetadataChanges, "sensitive_paths", formatPaths(oldObject.SensitivePaths), formatPaths(newObject.SensitivePaths))
+	if len(diff.AttributeChanges) == 0 && len(diff.MetadataChanges) == 0 {
+		return nil, nil
+	}
+	return diff, nil
+}
+
+// diffDecodedValues compares the output values or input variables of a component instance.
+func diffDecodedValues(oldValues map[string]*DecodedValue, newValues map[string]*DecodedValue) []*ValueChange {
+	var changes []*ValueChange
+	for _, name := range unionKeys(oldValues, newValues) {
+		var oldValue, newValue any
+		var oldSensitive, newSensitive []cty.Path
+		if value, ok := oldValues[name]; ok {
+			oldValue, oldSensitive = ctyToJSON(value.Value), value.SensitivePaths
+		}
+		if value, ok := newValues[name]; ok {
+			newValue, newSensitive = ctyToJSON(value.Value), value.SensitivePaths
+		}
+		changes = diffValues(name, nil, oldValue, newValue, oldSensitive, newSensitive, changes)
+	}
+	return changes
+}
+
+// diffValues compares two decoded JSON values down to their leaves and appends a change for every differing value.
+// The values at sensitive paths of either side are redacted in the changes.
+func diffValues(prefix string, path cty.Path, oldValue any, newValue any, oldSensitive []cty.Path, newSensitive []cty.Path, changes []*ValueChange) []*ValueChange {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return changes
+	}
+
+	oldAttrs, oldIsMap := oldValue.(map[string]any)
+	newAttrs, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		for _, name := range unionKeys(oldAttrs, newAttrs) {
+			changes = diffValues(prefix, path.GetAttr(name), oldAttrs[name], newAttrs[name], oldSensitive, newSensitive, changes)
+		}
+		return changes
+	}
+	oldItems, oldIsList := oldValue.([]any)
+	newItems, newIsList := newValue.([]any)
+	if oldIsList && newIsList && len(oldItems) == len(newItems) {
+		for i := range oldItems {
+			changes = diffValues(prefix, path.IndexInt(i), oldItems[i], newItems[i], oldSensitive, newSensitive, changes)
+		}
+		return changes
+	}
+
+	sensitive := append(append([]cty.Path{}, oldSensitive...), newSensitive...)
+	return append(changes, &ValueChange{
+		Path: prefix + formatPath(path),
+		Old:  redactAt(oldValue, path, sensitive),
+		New:  redactAt(newValue, path, sensitive),
+	})
+}
+
+// redactAt redacts a part of a decoded JSON value found at the given path, using sensitive paths relative to the
+// whole value.
+func redactAt(value any, at cty.Path, sensitive []cty.Path) any {
+	if value == nil {
+		return nil
+	}
+	for _, path := range sensitive {
+		switch {
+		case pathHasPrefix(at, path):
+			return sensitiveValuePlaceholder
+		case pathHasPrefix(path, at):
+			value = redactPath(value, path[len(at):])
+		}
+	}
+	return value
+}
+
+// pathHasPrefix reports whether a path starts with the given prefix, treating attribute and string index steps as
+// equivalent since JSON does not tell objects and maps apart.
+func pathHasPrefix(path cty.Path, prefix cty.Path) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if stepKey(prefix[i]) != stepKey(path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// stepKey returns a comparable form of a path step.
+func stepKey(step cty.PathStep) string {
+	return formatPath(cty.Path{step})
+}
+
+// formatPath formats a path in the attribute and index syntax of Terraform, such as tags["Name"] or ingress[0].port.
+func formatPath(path cty.Path) string {
+	identifierRegex := regexp.MustCompile(identifierExpression)
+
+	var b strings.Builder
+	for _, step := range path {
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			if identifierRegex.MatchString(step.Name) {
+				b.WriteString("." + step.Name)
+			} else {
+				b.WriteString("[" + strconv.Quote(step.Name) + "]")
+			}
+		case cty.IndexStep:
+			switch {
+			case !step.Key.IsKnown() || step.Key.IsNull():
+				b.WriteString("[?]")
+			case step.Key.Type() == cty.String && identifierRegex.MatchString(step.Key.AsString()):
+				b.WriteString("." + step.Key.AsString())
+			case step.Key.Type() == cty.String:
+				b.WriteString("[" + strconv.Quote(step.Key.AsString()) + "]")
+			default:
+				b.WriteString("[" + step.Key.AsBigFloat().Text('f', -1) + "]")
+			}
+		}
+	}
+	return strings.TrimPrefix(b.String(), ".")
+}
+
+// formatPaths formats a list of paths, returning nil for an empty list.
+func formatPaths(paths []cty.Path) []string {
+	var formatted []string
+	for _, path := range paths {
+		formatted = append(formatted, formatPath(path))
+	}
+	return formatted
+}
+
+// appendFieldChange appends a change of a metadata field if its values differ.
+func appendFieldChange[V any](changes []*ValueChange, field string, oldValue V, newValue V) []*ValueChange {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return changes
+	}
+	return append(changes, &ValueChange{Path: field, Old: oldValue, New: newValue})
+}
+
+// writeValueChanges writes value changes as indented text lines.
+func writeValueChanges(buf *bytes.Buffer, label string, changes []*ValueChange) {
+	for _, change := range changes {
+		switch {
+		case change.Old == nil:
+			fmt.Fprintf(buf, "    + %s%s: %s\n", label, change.Path, formatChangeValue(change.New))
+		case change.New == nil:
+			fmt.Fprintf(buf, "    - %s%s: %s\n", label, change.Path, formatChangeValue(change.Old))
+		default:
+			fmt.Fprintf(buf, "    ~ %s%s: %s -> %s\n", label, change.Path, formatChangeValue(change.Old), formatChangeValue(change.New))
+		}
+	}
+}
+
+// formatChangeValue formats a changed value as compact JSON, leaving the placeholders unquoted.
+func formatChangeValue(value any) string {
+	if value == sensitiveValuePlaceholder || value == unknownValuePlaceholder {
+		return value.(string)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
+
+// actionSymbol returns the symbol of a change action in the text output.
+func actionSymbol(action StackStateChangeAction) string {
+	switch action {
+	case StackStateChangeAdded:
+		return "+"
+	case StackStateChangeRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// objectsByKey indexes the resource instance objects of a model by their raw key.
+func objectsByKey(model *StackStateModel) map[string]*ResourceInstanceObjectState {
+	objects := make(map[string]*ResourceInstanceObjectState)
+	for _, object := range model.ResourceObjects() {
+		objects[object.RawKey] = object
+	}
+	return objects
+}
+
+// unrecognizedKeys returns the set of the raw keys of the unrecognized entries of a model.
+func unrecognizedKeys(model *StackStateModel) map[string]bool {
+	keys := make(map[string]bool)
+	for _, entry := range model.Unrecognized {
+		keys[entry.Key] = true
+	}
+	return keys
+}
+
+// unionKeys returns the sorted union of the keys of two maps.
+func unionKeys[V any](a map[string]V, b map[string]V) []string {
+	keys := tfconfigutil.SortedKeys(a)
+	for _, key := range tfconfigutil.SortedKeys(b) {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
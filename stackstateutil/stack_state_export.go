@@ -0,0 +1,441 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstackdata1"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+)
+
+const (
+	moduleAddressExpression       = `^module\.[A-Za-z_][A-Za-z0-9_-]*(?:` + instanceKeyExpression + `)?(?:\.module\.[A-Za-z_][A-Za-z0-9_-]*(?:` + instanceKeyExpression + `)?)*$`
+	workspaceStateVersion         = 4
+	defaultExportTerraformVersion = `1.13.0`
+	initialWorkspaceStateSerial   = 1
+)
+
+// StackStateExportRequest represents the request parameters for exporting a migrated stack state back into a classic
+// Terraform state file.
+type StackStateExportRequest struct {
+	StatePath         string            // StatePath is the path to the stack state snapshot.
+	ComponentInstance string            // ComponentInstance is an optional component instance to export on its own, its resources are placed in the root module unless mapped otherwise.
+	ReverseMapping    map[string]string // ReverseMapping maps component instance addresses to module addresses, or "" for the root module, and resource instance addresses within the stack to workspace resource instance addresses.
+	OutputPath        string            // OutputPath is the path to write the Terraform state file to.
+	Overwrite         bool              // Overwrite allows replacing an existing file at the output path.
+	TerraformVersion  string            // TerraformVersion is the Terraform version recorded in the state file, defaults to 1.13.0.
+}
+
+// StackStateExportResult is the outcome of exporting a stack state into a classic Terraform state file.
+type StackStateExportResult struct {
+	State      *tfstateutil.WorkspaceState // State is the exported Terraform state.
+	OutputPath string
+	Resources  map[string]string // Resources maps each exported resource instance address within the stack to its workspace address.
+	Warnings   []string          // Warnings lists the values that could not be carried over.
+}
+
+// exportedObject is a resource instance object with its address in the exported workspace.
+type exportedObject struct {
+	object       *ResourceInstanceObjectState
+	module       string
+	mode         string
+	resourceType string
+	name         string
+	key          string
+	dependencies []string
+	provider     string
+}
+
+// ExportWorkspaceState converts a migrated stack state back into a version 4 Terraform state file, as a way back from
+// a stack migration. Either one component instance is exported, or every component instance is placed in the module
+// given by the reverse mapping. The JSON value, schema version, sensitive paths, status, dependencies and provider of
+// every resource instance object are carried over, with the module of the component prefixed to the dependencies and
+// module provider configurations. The output values of a component instance exported into the root module become the
+// root output values. The state gets a fresh lineage and its first serial.
+func (s *stackStateUtility) ExportWorkspaceState(request StackStateExportRequest) (*StackStateExportResult, error) {
+	if request.OutputPath == "" {
+		return nil, fmt.Errorf("the output path must be set")
+	}
+	if request.ComponentInstance == "" && len(request.ReverseMapping) == 0 {
+		return nil, fmt.Errorf("either a component instance or a reverse mapping must be set")
+	}
+	if _, err := os.Stat(request.OutputPath); err == nil && !request.Overwrite {
+		return nil, fmt.Errorf("the file %s already exists", request.OutputPath)
+	}
+
+	model, err := s.LoadStackState(request.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	if request.ComponentInstance != "" {
+		if _, ok := model.Components[request.ComponentInstance]; !ok {
+			return nil, fmt.Errorf("no component instance %s in stack state %s", request.ComponentInstance, request.StatePath)
+		}
+	}
+	moduleRegex := regexp.MustCompile(moduleAddressExpression)
+	stackAddrs := make(map[string]bool)
+	for _, object := range model.ResourceObjects() {
+		stackAddrs[object.StackAddr()] = true
+	}
+	for _, from := range tfconfigutil.SortedKeys(request.ReverseMapping) {
+		to := request.ReverseMapping[from]
+		if _, isComponent := model.Components[from]; isComponent {
+			if to != "" && !moduleRegex.MatchString(to) {
+				return nil, fmt.Errorf("invalid module address %q for component instance %s", to, from)
+			}
+		} else if !stackAddrs[from] {
+			return nil, fmt.Errorf("the reverse mapping refers to %s, which is neither a component instance nor a resource instance in stack state %s", from, request.StatePath)
+		}
+	}
+
+	lineage, err := newLineage()
+	if err != nil {
+		return nil, err
+	}
+	terraformVersion := request.TerraformVersion
+	if terraformVersion == "" {
+		terraformVersion = defaultExportTerraformVersion
+	}
+	result := &StackStateExportResult{
+		State: &tfstateutil.WorkspaceState{
+			Version:          workspaceStateVersion,
+			TerraformVersion: terraformVersion,
+			Serial:           initialWorkspaceStateSerial,
+			Lineage:          lineage,
+			Outputs:          make(map[string]*tfstateutil.WorkspaceStateOutput),
+			Resources:        []*tfstateutil.WorkspaceStateResource{},
+		},
+		OutputPath: request.OutputPath,
+		Resources:  make(map[string]string),
+	}
+
+	var objects []*exportedObject
+	var unmapped []string
+	for _, componentAddr := range model.ComponentAddrs() {
+		if request.ComponentInstance != "" && componentAddr != request.ComponentInstance {
+			continue
+		}
+		// a component instance is placed in a module if it is mapped, or in the root module if it is exported on its own
+		module, placed := request.ReverseMapping[componentAddr]
+		placed = placed || componentAddr == request.ComponentInstance
+
+		component := model.Components[componentAddr]
+		workspaceAddrs := make(map[*ResourceInstanceObjectState]string)
+		for _, object := range component.ResourceObjects() {
+			workspaceAddr, mapped := request.ReverseMapping[object.StackAddr()]
+			if !mapped {
+				if !placed {
+					unmapped = append(unmapped, object.StackAddr())
+					continue
+				}
+				workspaceAddr = joinModuleAddr(module, object.ResourceInstanceAddr)
+			}
+			workspaceAddrs[object] = workspaceAddr
+		}
+		placements := resourcePlacements(workspaceAddrs)
+		for _, object := range component.ResourceObjects() {
+			workspaceAddr, ok := workspaceAddrs[object]
+			if !ok {
+				continue
+			}
+			exported, err := exportObject(object, workspaceAddr, placements)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, exported)
+			result.Resources[object.StackAddr()] = workspaceAddr
+		}
+
+		if placed && module == "" {
+			result.Warnings = append(result.Warnings, exportOutputs(component, result.State.Outputs)...)
+		}
+	}
+	if len(unmapped) > 0 {
+		return nil, fmt.Errorf("no reverse mapping for resource instance(s) %s", strings.Join(unmapped, ", "))
+	}
+
+	resources, err := groupExportedObjects(objects)
+	if err != nil {
+		return nil, err
+	}
+	result.State.Resources = resources
+
+	encoded, err := json.MarshalIndent(result.State, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Terraform state: %w", err)
+	}
+	if err := os.WriteFile(request.OutputPath, append(encoded, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write file %s: %w", request.OutputPath, err)
+	}
+	return result, nil
+}
+
+// resourcePlacements maps the configuration address of each resource of a component instance to the configuration
+// address it is exported to, or to the empty string if its instances are exported to different configurations.
+func resourcePlacements(workspaceAddrs map[*ResourceInstanceObjectState]string) map[string]string {
+	placements := make(map[string]string)
+	for object, workspaceAddr := range workspaceAddrs {
+		_, _, config, err := parseResourceInstanceAddr(object.ResourceInstanceAddr)
+		if err != nil {
+			continue
+		}
+		_, _, workspaceConfig, err := parseResourceInstanceAddr(workspaceAddr)
+		if err != nil {
+			continue
+		}
+		if placed, ok := placements[config]; ok && placed != workspaceConfig {
+			workspaceConfig = ""
+		}
+		placements[config] = workspaceConfig
+	}
+	return placements
+}
+
+// exportObject places a resource instance object at its workspace address. The dependencies of the object are
+// placed where the resources they refer to are exported, and the dependencies on resources that are not exported
+// and the provider configuration of the object are placed relative to the module the object is exported to.
+func exportObject(object *ResourceInstanceObjectState, workspaceAddr string, placements map[string]string) (*exportedObject, error) {
+	matches := regexp.MustCompile(resourceInstanceExpression).FindStringSubmatch(workspaceAddr)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid workspace resource instance address %q for %s", workspaceAddr, object.StackAddr())
+	}
+	if len(object.ValueJSON) == 0 {
+		return nil, fmt.Errorf("the resource instance object %s has no value", object.StackAddr())
+	}
+
+	exported := &exportedObject{
+		object:       object,
+		module:       strings.TrimSuffix(matches[1], "."),
+		mode:         "managed",
+		resourceType: matches[3],
+		name:         matches[4],
+		key:          matches[5],
+		provider:     object.ProviderConfigAddr,
+	}
+	if matches[2] != "" {
+		exported.mode = "data"
+	}
+	// dependencies and provider configurations are recorded at configuration addresses, without module instance keys
+	objectMatches := regexp.MustCompile(resourceInstanceExpression).FindStringSubmatch(object.ResourceInstanceAddr)
+	if objectMatches == nil {
+		return nil, fmt.Errorf("invalid resource instance address %q of %s", object.ResourceInstanceAddr, object.StackAddr())
+	}
+	moduleConfig := componentModuleConfig(tfstateutil.ModuleConfigAddr(exported.module),
+		tfstateutil.ModuleConfigAddr(strings.TrimSuffix(objectMatches[1], ".")))
+	for _, dependency := range object.Dependencies {
+		if placed := placements[dependency]; placed != "" {
+			exported.dependencies = append(exported.dependencies, placed)
+			continue
+		}
+		exported.dependencies = append(exported.dependencies, joinModuleAddr(moduleConfig, dependency))
+	}
+
+	// provider configurations of the root module of the component are passed in from the root module of the
+	// workspace, those of its child modules move along with the component
+	provider, err := tfstateutil.ParseProviderConfigAddr(object.ProviderConfigAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider of %s: %w", object.StackAddr(), err)
+	}
+	if provider.Module != "" {
+		provider.Module = joinModuleAddr(moduleConfig, provider.Module)
+		exported.provider = provider.String()
+	}
+	return exported, nil
+}
+
+// componentModuleConfig returns the configuration address of the workspace module that stands for the root module
+// of the component, given the module an object is exported to and the module of the object within the component.
+// An object exported to a module whose address does not end with its module within the component stands for the
+// root module of the component itself.
+func componentModuleConfig(workspaceModule string, componentModule string) string {
+	switch {
+	case componentModule == "":
+		return workspaceModule
+	case workspaceModule == componentModule:
+		return ""
+	case strings.HasSuffix(workspaceModule, "."+componentModule):
+		return strings.TrimSuffix(workspaceModule, "."+componentModule)
+	default:
+		return workspaceModule
+	}
+}
+
+// groupExportedObjects groups the exported objects into the resources of the workspace state.
+func groupExportedObjects(objects []*exportedObject) ([]*tfstateutil.WorkspaceStateResource, error) {
+	resources := make(map[string]*tfstateutil.WorkspaceStateResource)
+	seen := make(map[string]bool)
+	for _, exported := range objects {
+		resource := &tfstateutil.WorkspaceStateResource{
+			Module:   exported.module,
+			Mode:     exported.mode,
+			Type:     exported.resourceType,
+			Name:     exported.name,
+			Provider: exported.provider,
+		}
+		if existing, ok := resources[resource.Addr()]; ok {
+			resource = existing
+		} else {
+			resources[resource.Addr()] = resource
+		}
+		if resource.Provider != exported.provider {
+			return nil, fmt.Errorf("the instances of %s use different providers, %s and %s", resource.Addr(), resource.Provider, exported.provider)
+		}
+
+		instanceKey := resource.Addr() + exported.key + "," + exported.object.DeposedKey
+		if seen[instanceKey] {
+			return nil, fmt.Errorf("more than one resource instance object is exported to %s%s", resource.Addr(), exported.key)
+		}
+		seen[instanceKey] = true
+
+		instance, eachMode, err := exportInstance(exported)
+		if err != nil {
+			return nil, err
+		}
+		if resource.EachMode != "" && eachMode != "" && resource.EachMode != eachMode {
+			return nil, fmt.Errorf("the instances of %s mix count and for_each keys", resource.Addr())
+		}
+		if eachMode != "" {
+			resource.EachMode = eachMode
+		}
+		resource.Instances = append(resource.Instances, instance)
+	}
+
+	var grouped []*tfstateutil.WorkspaceStateResource
+	for _, addr := range tfconfigutil.SortedKeys(resources) {
+		grouped = append(grouped, resources[addr])
+	}
+	return grouped, nil
+}
+
+// exportInstance converts a resource instance object into an instance of the workspace state, returning the each
+// mode implied by its instance key.
+func exportInstance(exported *exportedObject) (*tfstateutil.WorkspaceStateInstance, string, error) {
+	object := exported.object
+	instance := &tfstateutil.WorkspaceStateInstance{
+		Deposed:             object.DeposedKey,
+		SchemaVersion:       object.SchemaVersion,
+		AttributesRaw:       json.RawMessage(object.ValueJSON),
+		PrivateRaw:          object.ProviderSpecificData,
+		Dependencies:        exported.dependencies,
+		CreateBeforeDestroy: object.CreateBeforeDestroy,
+	}
+	if object.Status == tfstackdata1.StateResourceInstanceObjectV1_DAMAGED {
+		instance.Status = "tainted"
+	}
+
+	sensitive, err := sensitiveAttributes(object.SensitivePaths)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid sensitive path of %s: %w", object.StackAddr(), err)
+	}
+	instance.SensitiveAttributes = sensitive
+
+	var eachMode string
+	switch {
+	case exported.key == "":
+	case strings.HasPrefix(exported.key, `["`):
+		key, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(exported.key, "["), "]"))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid instance key %s of %s: %w", exported.key, object.StackAddr(), err)
+		}
+		instance.IndexKey, _ = json.Marshal(key)
+		eachMode = "map"
+	default:
+		instance.IndexKey = json.RawMessage(strings.TrimSuffix(strings.TrimPrefix(exported.key, "["), "]"))
+		eachMode = "list"
+	}
+	return instance, eachMode, nil
+}
+
+// exportOutputs writes the output values of a component instance as root output values, returning warnings for the
+// values that cannot be represented in a workspace state.
+func exportOutputs(component *ComponentInstanceState, outputs map[string]*tfstateutil.WorkspaceStateOutput) []string {
+	var warnings []string
+	for _, name := range tfconfigutil.SortedKeys(component.OutputValues) {
+		output := component.OutputValues[name]
+		if !output.Value.IsWhollyKnown() {
+			warnings = append(warnings, fmt.Sprintf("the output value %s of %s is not known and was not exported", name, component.Addr))
+			continue
+		}
+		if output.Value.IsNull() {
+			continue
+		}
+		value, err := ctyjson.Marshal(output.Value, output.Value.Type())
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("the output value %s of %s could not be encoded: %s", name, component.Addr, err))
+			continue
+		}
+		ty, err := ctyjson.MarshalType(output.Value.Type())
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("the type of output value %s of %s could not be encoded: %s", name, component.Addr, err))
+			continue
+		}
+		outputs[name] = &tfstateutil.WorkspaceStateOutput{Value: value, Type: ty, Sensitive: len(output.SensitivePaths) > 0}
+	}
+	return warnings
+}
+
+// sensitiveAttributes encodes sensitive paths in the sensitive_attributes format of a workspace state.
+func sensitiveAttributes(paths []cty.Path) (json.RawMessage, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	type step struct {
+		Type  string `json:"type"`
+		Value any    `json:"value"`
+	}
+	type indexKey struct {
+		Value any             `json:"value"`
+		Type  json.RawMessage `json:"type"`
+	}
+
+	var encoded [][]step
+	for _, path := range paths {
+		steps := []step{}
+		for _, pathStep := range path {
+			switch pathStep := pathStep.(type) {
+			case cty.GetAttrStep:
+				steps = append(steps, step{Type: "get_attr", Value: pathStep.Name})
+			case cty.IndexStep:
+				keyType, err := ctyjson.MarshalType(pathStep.Key.Type())
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, step{Type: "index", Value: indexKey{Value: ctyToJSON(pathStep.Key), Type: keyType}})
+			}
+		}
+		encoded = append(encoded, steps)
+	}
+	return json.Marshal(encoded)
+}
+
+// joinModuleAddr prefixes an address with a module address, which is empty for the root module.
+func joinModuleAddr(module string, addr string) string {
+	if module == "" {
+		return addr
+	}
+	return module + "." + addr
+}
+
+// newLineage returns a random lineage for a new state, formatted as a UUID.
+func newLineage() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate state lineage: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
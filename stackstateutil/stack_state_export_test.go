@@ -0,0 +1,62 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExportObject_KeyedModule(t *testing.T) {
+	object := &ResourceInstanceObjectState{
+		ComponentInstanceAddr: `component.app["a"]`,
+		ResourceInstanceAddr:  "module.db.aws_db_instance.main",
+		ValueJSON:             []byte(`{"id":"db-1"}`),
+		Dependencies:          []string{"module.db.aws_subnet.a"},
+		ProviderConfigAddr:    `module.db.provider["registry.terraform.io/hashicorp/aws"]`,
+	}
+
+	exported, err := exportObject(object, `module.app["a"].module.db.aws_db_instance.main`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exported.module != `module.app["a"].module.db` {
+		t.Errorf("got module %s", exported.module)
+	}
+	if want := []string{"module.app.module.db.aws_subnet.a"}; !slices.Equal(exported.dependencies, want) {
+		t.Errorf("got dependencies %v, want %v", exported.dependencies, want)
+	}
+	if want := `module.app.module.db.provider["registry.terraform.io/hashicorp/aws"]`; exported.provider != want {
+		t.Errorf("got provider %s, want %s", exported.provider, want)
+	}
+
+	// a resource remapped on its own, while its component is exported to the root module, is placed relative to the
+	// module it is remapped to, and its dependencies follow the resources they refer to
+	remapped := &ResourceInstanceObjectState{
+		ComponentInstanceAddr: "component.app",
+		ResourceInstanceAddr:  "module.db.aws_db_instance.main",
+		ValueJSON:             []byte(`{"id":"db-1"}`),
+		Dependencies:          []string{"module.db.aws_kms_key.k", "module.db.aws_subnet.a"},
+		ProviderConfigAddr:    `module.db.provider["registry.terraform.io/hashicorp/aws"]`,
+	}
+	subnet := &ResourceInstanceObjectState{ComponentInstanceAddr: "component.app", ResourceInstanceAddr: "module.db.aws_subnet.a"}
+	placements := resourcePlacements(map[*ResourceInstanceObjectState]string{
+		remapped: `module.storage["x"].module.db.aws_db_instance.main`,
+		subnet:   `module.network[0].aws_subnet.a`,
+	})
+
+	exported, err = exportObject(remapped, `module.storage["x"].module.db.aws_db_instance.main`, placements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exported.module != `module.storage["x"].module.db` {
+		t.Errorf("got module %s", exported.module)
+	}
+	if want := []string{"module.storage.module.db.aws_kms_key.k", "module.network.aws_subnet.a"}; !slices.Equal(exported.dependencies, want) {
+		t.Errorf("got dependencies %v, want %v", exported.dependencies, want)
+	}
+	if want := `module.storage.module.db.provider["registry.terraform.io/hashicorp/aws"]`; exported.provider != want {
+		t.Errorf("got provider %s, want %s", exported.provider, want)
+	}
+}
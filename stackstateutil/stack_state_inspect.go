@@ -0,0 +1,238 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	sensitiveValuePlaceholder = `(sensitive value)`
+	unknownValuePlaceholder   = `(known after apply)`
+)
+
+// ListStackState writes the address of every component instance of a stack state snapshot, each followed by the
+// addresses of its resource instances, one per line.
+func (s *stackStateUtility) ListStackState(path string, w io.Writer) error {
+	model, err := s.LoadStackState(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, componentAddr := range model.ComponentAddrs() {
+		component := model.Components[componentAddr]
+		fmt.Fprintln(&buf, componentAddr)
+		for _, resourceAddr := range tfconfigutil.SortedKeys(component.Resources) {
+			fmt.Fprintln(&buf, componentAddr+"."+resourceAddr)
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// ShowStackResource writes the attributes of a resource instance of a stack state snapshot, decoded from its JSON
+// value with the sensitive attributes redacted. The address is the address of the resource instance within the
+// stack, such as component.app.aws_instance.web. Deposed objects are written after the current object.
+func (s *stackStateUtility) ShowStackResource(path string, addr string, w io.Writer) error {
+	model, err := s.LoadStackState(path)
+	if err != nil {
+		return err
+	}
+
+	var objects []*ResourceInstanceObjectState
+	for _, object := range model.ResourceObjects() {
+		if object.StackAddr() == addr {
+			objects = append(objects, object)
+		}
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no resource instance %s in stack state %s", addr, path)
+	}
+
+	var buf bytes.Buffer
+	for i, object := range objects {
+		if i > 0 {
+			fmt.Fprintln(&buf)
+		}
+		if object.DeposedKey == "" {
+			fmt.Fprintf(&buf, "# %s:\n", addr)
+		} else {
+			fmt.Fprintf(&buf, "# %s (deposed object %s):\n", addr, object.DeposedKey)
+		}
+		fmt.Fprintf(&buf, "# provider: %s\n", object.ProviderConfigAddr)
+		fmt.Fprintf(&buf, "# status: %s, schema version: %d\n", strings.ToLower(object.Status.String()), object.SchemaVersion)
+		if len(object.Dependencies) > 0 {
+			fmt.Fprintf(&buf, "# dependencies: %s\n", strings.Join(object.Dependencies, ", "))
+		}
+
+		attrs, err := redactedJSON(object.ValueJSON, object.SensitivePaths)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", object.RawKey, err)
+		}
+		if err := writeAttributes(&buf, attrs); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// ShowStackOutputs writes the output values of every component instance of a stack state snapshot, as recorded by
+// the most recent apply, with the sensitive values redacted.
+func (s *stackStateUtility) ShowStackOutputs(path string, w io.Writer) error {
+	model, err := s.LoadStackState(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, componentAddr := range model.ComponentAddrs() {
+		component := model.Components[componentAddr]
+		if len(component.OutputValues) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "# %s:\n", componentAddr)
+		outputs := make(map[string]any)
+		for name, output := range component.OutputValues {
+			outputs[name] = redactValue(ctyToJSON(output.Value), output.SensitivePaths)
+		}
+		if err := writeAttributes(&buf, outputs); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// writeAttributes writes the attributes of an object as name = value lines, with the values encoded as indented JSON.
+func writeAttributes(buf *bytes.Buffer, value any) error {
+	attrs, ok := value.(map[string]any)
+	if !ok {
+		encoded, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "%s\n", encoded)
+		return nil
+	}
+
+	width := 0
+	for name := range attrs {
+		width = max(width, len(name))
+	}
+	for _, name := range tfconfigutil.SortedKeys(attrs) {
+		var encoded []byte
+		if attrs[name] == sensitiveValuePlaceholder || attrs[name] == unknownValuePlaceholder {
+			encoded = []byte(attrs[name].(string))
+		} else {
+			var err error
+			if encoded, err = json.MarshalIndent(attrs[name], "    ", "  "); err != nil {
+				return fmt.Errorf("failed to encode attribute %s: %w", name, err)
+			}
+		}
+		fmt.Fprintf(buf, "    %-*s = %s\n", width, name, encoded)
+	}
+	return nil
+}
+
+// redactedJSON decodes a JSON value and replaces the values at the sensitive paths with a placeholder.
+func redactedJSON(raw []byte, paths []cty.Path) (any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return redactValue(value, paths), nil
+}
+
+// redactValue replaces the parts of a decoded JSON value at the sensitive paths with a placeholder. Paths that do not
+// exist in the value are ignored.
+func redactValue(value any, paths []cty.Path) any {
+	for _, path := range paths {
+		value = redactPath(value, path)
+	}
+	return value
+}
+
+// redactPath replaces the part of a decoded JSON value at one path with a placeholder.
+func redactPath(value any, path cty.Path) any {
+	if len(path) == 0 {
+		return sensitiveValuePlaceholder
+	}
+
+	switch step := path[0].(type) {
+	case cty.GetAttrStep:
+		if attrs, ok := value.(map[string]any); ok {
+			if attr, ok := attrs[step.Name]; ok {
+				attrs[step.Name] = redactPath(attr, path[1:])
+			}
+		}
+	case cty.IndexStep:
+		switch collection := value.(type) {
+		case map[string]any:
+			if step.Key.Type() == cty.String && step.Key.IsKnown() && !step.Key.IsNull() {
+				if elem, ok := collection[step.Key.AsString()]; ok {
+					collection[step.Key.AsString()] = redactPath(elem, path[1:])
+				}
+			}
+		case []any:
+			if step.Key.Type() == cty.Number && step.Key.IsKnown() && !step.Key.IsNull() {
+				if i, accuracy := step.Key.AsBigFloat().Int64(); accuracy == 0 && i >= 0 && int(i) < len(collection) {
+					collection[i] = redactPath(collection[i], path[1:])
+				}
+			}
+		}
+	}
+	return value
+}
+
+// ctyToJSON converts a cty value into a value that encodes as its JSON representation, with unknown values replaced
+// by a placeholder.
+func ctyToJSON(value cty.Value) any {
+	switch {
+	case !value.IsKnown():
+		return unknownValuePlaceholder
+	case value.IsNull():
+		return nil
+	}
+
+	ty := value.Type()
+	switch {
+	case ty == cty.String:
+		return value.AsString()
+	case ty == cty.Bool:
+		return value.True()
+	case ty == cty.Number:
+		return json.Number(value.AsBigFloat().Text('f', -1))
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		items := []any{}
+		for it := value.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			items = append(items, ctyToJSON(elem))
+		}
+		return items
+	case ty.IsMapType() || ty.IsObjectType():
+		attrs := make(map[string]any)
+		for it := value.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			attrs[key.AsString()] = ctyToJSON(elem)
+		}
+		return attrs
+	default:
+		return nil
+	}
+}
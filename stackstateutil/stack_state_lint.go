@@ -0,0 +1,157 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+
+	"github.com/hashicorp/terraform-migrate-utility/stateops"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	discardIfUnrecognizedDescription = `its key type is marked to be discarded when unrecognized`
+)
+
+// StackStateLintSeverity is the severity of a finding of the stack state linter.
+type StackStateLintSeverity string
+
+const (
+	StackStateLintError   StackStateLintSeverity = "error"
+	StackStateLintWarning StackStateLintSeverity = "warning"
+)
+
+// StackStateLintCheck identifies the check that produced a finding.
+type StackStateLintCheck string
+
+const (
+	StackStateLintFormatVersion     StackStateLintCheck = "format_version"
+	StackStateLintUnknownType       StackStateLintCheck = "unknown_type"
+	StackStateLintUndecodableValue  StackStateLintCheck = "undecodable_value"
+	StackStateLintOrphanResource    StackStateLintCheck = "orphan_resource"
+	StackStateLintOrphanDescription StackStateLintCheck = "orphan_description"
+	StackStateLintEmptyValue        StackStateLintCheck = "empty_value"
+	StackStateLintMissingDependency StackStateLintCheck = "missing_dependency"
+	StackStateLintMissingComponent  StackStateLintCheck = "missing_component"
+)
+
+// StackStateLintFinding is one problem found in a stack state.
+type StackStateLintFinding struct {
+	Severity StackStateLintSeverity
+	Check    StackStateLintCheck
+	Key      string // Key is the raw or description key the finding is about, empty for findings about the whole state.
+	Message  string
+}
+
+// StackStateLintReport lists the problems found in a stack state snapshot.
+type StackStateLintReport struct {
+	Path     string
+	Findings []*StackStateLintFinding
+}
+
+// HasErrors reports whether any finding would stop Terraform from loading the state.
+func (r *StackStateLintReport) HasErrors() bool {
+	for _, finding := range r.Findings {
+		if finding.Severity == StackStateLintError {
+			return true
+		}
+	}
+	return false
+}
+
+// LintStackState checks the integrity of a stack state snapshot. Raw entries of an unknown type, an unsupported
+// format version and resource instance objects without a value are errors, since Terraform cannot load such a state.
+// Resource instances without a component instance entry, descriptions without a matching raw entry and dependency
+// addresses that point at resources or components missing from the state are warnings.
+func (s *stackStateUtility) LintStackState(path string) (*StackStateLintReport, error) {
+	state, err := stateops.ReadStackStateSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	model, err := s.DecodeStackState(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stack state %s: %w", path, err)
+	}
+
+	report := &StackStateLintReport{Path: path}
+	if state.FormatVersion != stateops.StackStateFormatVersion {
+		report.add(StackStateLintError, StackStateLintFormatVersion, "",
+			fmt.Sprintf("the state has format version %d, only version %d is supported", state.FormatVersion, stateops.StackStateFormatVersion))
+	}
+
+	for _, entry := range model.Unrecognized {
+		if entry.Key != "" && unicode.IsLower(rune(entry.Key[0])) {
+			report.add(StackStateLintWarning, StackStateLintUnknownType, entry.Key,
+				fmt.Sprintf("the entry is not recognized but %s: %s", discardIfUnrecognizedDescription, entry.Reason))
+			continue
+		}
+		report.add(StackStateLintError, StackStateLintUnknownType, entry.Key, entry.Reason)
+	}
+	for _, warning := range model.Warnings {
+		report.add(StackStateLintWarning, StackStateLintUndecodableValue, "", warning)
+	}
+
+	for _, componentAddr := range model.ComponentAddrs() {
+		component := model.Components[componentAddr]
+		if component.RawKey == "" {
+			report.add(StackStateLintWarning, StackStateLintOrphanResource, componentAddr,
+				fmt.Sprintf("the state holds resource instances of component instance %s but no entry for the component instance itself", componentAddr))
+		}
+		for _, addr := range append(append([]string{}, component.DependencyAddrs...), component.DependentAddrs...) {
+			if !hasComponentInstanceOf(model, addr, "") {
+				report.add(StackStateLintWarning, StackStateLintMissingComponent, component.RawKey,
+					fmt.Sprintf("the component instance %s records a dependency on %s, which has no instance in the state", componentAddr, addr))
+			}
+		}
+	}
+
+	for _, object := range model.ResourceObjects() {
+		if len(object.ValueJSON) == 0 {
+			report.add(StackStateLintError, StackStateLintEmptyValue, object.RawKey, fmt.Sprintf("the resource instance object %s has no value", object.StackAddr()))
+		}
+		configs := resourceConfigAddrs(model.Components[object.ComponentInstanceAddr])
+		for _, dependency := range object.Dependencies {
+			if !configs[dependency] {
+				report.add(StackStateLintWarning, StackStateLintMissingDependency, object.RawKey,
+					fmt.Sprintf("the resource instance object %s depends on %s, which has no instance in component instance %s", object.StackAddr(), dependency, object.ComponentInstanceAddr))
+			}
+		}
+	}
+
+	for _, key := range tfconfigutil.SortedKeys(state.GetDescriptions()) {
+		if _, ok := state.Raw[key]; ok {
+			continue
+		}
+		if rawKey := descriptionRawKey(state.Descriptions[key]); rawKey != "" {
+			if _, ok := state.Raw[rawKey]; ok {
+				continue
+			}
+		}
+		report.add(StackStateLintWarning, StackStateLintOrphanDescription, key, "the description has no matching raw state entry")
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Severity == StackStateLintError && report.Findings[j].Severity != StackStateLintError
+	})
+	return report, nil
+}
+
+// add appends a finding to the report.
+func (r *StackStateLintReport) add(severity StackStateLintSeverity, check StackStateLintCheck, key string, message string) {
+	r.Findings = append(r.Findings, &StackStateLintFinding{Severity: severity, Check: check, Key: key, Message: message})
+}
+
+// resourceConfigAddrs returns the set of the configuration addresses of the resource instances of a component
+// instance, which is what resource dependencies refer to.
+func resourceConfigAddrs(component *ComponentInstanceState) map[string]bool {
+	configs := make(map[string]bool)
+	for addr := range component.Resources {
+		if _, _, config, err := parseResourceInstanceAddr(addr); err == nil {
+			configs[config] = true
+		}
+	}
+	return configs
+}
@@ -0,0 +1,306 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/planproto"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstackdata1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	componentInstanceKeyPrefix      = `CMPT`
+	resourceInstanceObjectKeyPrefix = `RSRC`
+	rawKeyPrefixLength              = 4
+	currentObjectDeposedKey         = `cur`
+)
+
+// StackStateModel is the decoded form of the raw values of a stack state, keyed by component instance and resource
+// instance address.
+type StackStateModel struct {
+	FormatVersion int64
+	Components    map[string]*ComponentInstanceState // Components maps each component instance address to its state.
+	Unrecognized  []*UnrecognizedRawEntry            // Unrecognized lists the raw entries whose key or message type is not understood.
+	Warnings      []string                           // Warnings lists the values of recognized entries that could not be decoded.
+}
+
+// ComponentInstanceState is the decoded state of one component instance.
+type ComponentInstanceState struct {
+	Addr            string
+	RawKey          string                            // RawKey is the key of the component instance entry, empty if the state holds only resources of the instance.
+	OutputValues    map[string]*DecodedValue          // OutputValues are the output values as of the most recent apply.
+	InputVariables  map[string]*DecodedValue          // InputVariables are the input variables as of the most recent apply.
+	DependencyAddrs []string                          // DependencyAddrs are the components this component instance depended on.
+	DependentAddrs  []string                          // DependentAddrs are the components that depended on this component instance.
+	Resources       map[string]*ResourceInstanceState // Resources maps each resource instance address within the component instance to its state.
+}
+
+// ResourceInstanceState is the decoded state of one resource instance, with its current and deposed objects.
+type ResourceInstanceState struct {
+	Addr    string
+	Current *ResourceInstanceObjectState            // Current is the current object of the resource instance, if any.
+	Deposed map[string]*ResourceInstanceObjectState // Deposed maps each deposed key to its deposed object.
+}
+
+// ResourceInstanceObjectState is the decoded state of one object of a resource instance.
+type ResourceInstanceObjectState struct {
+	RawKey                string
+	ComponentInstanceAddr string
+	ResourceInstanceAddr  string
+	DeposedKey            string          // DeposedKey is the key of a deposed object, empty for the current object.
+	ValueJSON             json.RawMessage // ValueJSON is the JSON representation of the object value.
+	SensitivePaths        []cty.Path      // SensitivePaths are the paths of the sensitive attributes of the value.
+	SchemaVersion         uint64
+	Status                tfstackdata1.StateResourceInstanceObjectV1_Status
+	Dependencies          []string // Dependencies are the addresses of the resources within the component instance the object depends on.
+	CreateBeforeDestroy   bool
+	ProviderConfigAddr    string
+	ProviderSpecificData  []byte
+}
+
+// DecodedValue is a decoded output value or input variable of a component instance.
+type DecodedValue struct {
+	Value          cty.Value
+	SensitivePaths []cty.Path // SensitivePaths are the paths of the sensitive parts of the value.
+}
+
+// UnrecognizedRawEntry describes a raw state entry that could not be decoded.
+type UnrecognizedRawEntry struct {
+	Key     string
+	TypeURL string
+	Reason  string
+}
+
+// StackAddr returns the address of the resource instance object within the stack, such as
+// component.app.aws_instance.web.
+func (o *ResourceInstanceObjectState) StackAddr() string {
+	return o.ComponentInstanceAddr + "." + o.ResourceInstanceAddr
+}
+
+// ComponentAddrs returns the sorted addresses of the component instances.
+func (m *StackStateModel) ComponentAddrs() []string {
+	return tfconfigutil.SortedKeys(m.Components)
+}
+
+// ResourceObjects returns every resource instance object of the state, sorted by address with the current object of
+// each resource instance before its deposed objects.
+func (m *StackStateModel) ResourceObjects() []*ResourceInstanceObjectState {
+	var objects []*ResourceInstanceObjectState
+	for _, componentAddr := range m.ComponentAddrs() {
+		objects = append(objects, m.Components[componentAddr].ResourceObjects()...)
+	}
+	return objects
+}
+
+// ResourceObjects returns the resource instance objects of the component instance, sorted by address with the
+// current object of each resource instance before its deposed objects.
+func (c *ComponentInstanceState) ResourceObjects() []*ResourceInstanceObjectState {
+	var objects []*ResourceInstanceObjectState
+	for _, resourceAddr := range tfconfigutil.SortedKeys(c.Resources) {
+		resource := c.Resources[resourceAddr]
+		if resource.Current != nil {
+			objects = append(objects, resource.Current)
+		}
+		for _, deposedKey := range tfconfigutil.SortedKeys(resource.Deposed) {
+			objects = append(objects, resource.Deposed[deposedKey])
+		}
+	}
+	return objects
+}
+
+// DecodeStackState decodes every raw entry of a stack state. Entries whose key or message type is not understood are
+// reported in the model rather than failing the decoding, so states written by newer Terraform versions can still be
+// inspected.
+func (s *stackStateUtility) DecodeStackState(state *tfstacksagent1.StackState) (*StackStateModel, error) {
+	if state == nil {
+		return nil, fmt.Errorf("no stack state to decode")
+	}
+
+	model := &StackStateModel{
+		FormatVersion: state.FormatVersion,
+		Components:    make(map[string]*ComponentInstanceState),
+	}
+	for _, key := range tfconfigutil.SortedKeys(state.GetRaw()) {
+		raw := state.Raw[key]
+		if raw == nil {
+			model.Unrecognized = append(model.Unrecognized, &UnrecognizedRawEntry{Key: key, Reason: "the entry has no value"})
+			continue
+		}
+
+		var err error
+		switch rawKeyPrefix(key) {
+		case componentInstanceKeyPrefix:
+			err = model.decodeComponentInstance(key, raw)
+		case resourceInstanceObjectKeyPrefix:
+			err = model.decodeResourceInstanceObject(key, raw)
+		default:
+			err = fmt.Errorf("unknown raw key type %q", rawKeyPrefix(key))
+		}
+		if err != nil {
+			model.Unrecognized = append(model.Unrecognized, &UnrecognizedRawEntry{Key: key, TypeURL: raw.TypeUrl, Reason: err.Error()})
+		}
+	}
+
+	return model, nil
+}
+
+// decodeComponentInstance decodes a StateComponentInstanceV1 entry.
+func (m *StackStateModel) decodeComponentInstance(key string, raw *anypb.Any) error {
+	msg := &tfstackdata1.StateComponentInstanceV1{}
+	if !raw.MessageIs(msg) {
+		return fmt.Errorf("unexpected message type %s for a component instance", raw.TypeUrl)
+	}
+	if err := raw.UnmarshalTo(msg); err != nil {
+		return fmt.Errorf("invalid component instance message: %w", err)
+	}
+
+	component := m.component(strings.TrimPrefix(key, componentInstanceKeyPrefix))
+	component.RawKey = key
+	component.DependencyAddrs = msg.GetDependencyAddrs()
+	component.DependentAddrs = msg.GetDependentAddrs()
+	component.OutputValues = m.decodeValues(key, "output value", msg.GetOutputValues())
+	component.InputVariables = m.decodeValues(key, "input variable", msg.GetInputVariables())
+	return nil
+}
+
+// decodeResourceInstanceObject decodes a StateResourceInstanceObjectV1 entry.
+func (m *StackStateModel) decodeResourceInstanceObject(key string, raw *anypb.Any) error {
+	msg := &tfstackdata1.StateResourceInstanceObjectV1{}
+	if !raw.MessageIs(msg) {
+		return fmt.Errorf("unexpected message type %s for a resource instance object", raw.TypeUrl)
+	}
+	parts := splitRawKey(strings.TrimPrefix(key, resourceInstanceObjectKeyPrefix))
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("invalid resource instance object key, expected the component instance, resource instance and deposed key")
+	}
+	if err := raw.UnmarshalTo(msg); err != nil {
+		return fmt.Errorf("invalid resource instance object message: %w", err)
+	}
+
+	object := &ResourceInstanceObjectState{
+		RawKey:                key,
+		ComponentInstanceAddr: parts[0],
+		ResourceInstanceAddr:  parts[1],
+		ValueJSON:             msg.GetValueJson(),
+		SchemaVersion:         msg.GetSchemaVersion(),
+		Status:                msg.GetStatus(),
+		Dependencies:          msg.GetDependencies(),
+		CreateBeforeDestroy:   msg.GetCreateBeforeDestroy(),
+		ProviderConfigAddr:    msg.GetProviderConfigAddr(),
+		ProviderSpecificData:  msg.GetProviderSpecificData(),
+	}
+	if parts[2] != currentObjectDeposedKey {
+		object.DeposedKey = parts[2]
+	}
+	paths, err := decodePaths(msg.GetSensitivePaths())
+	if err != nil {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("%s: invalid sensitive path: %s", key, err))
+	}
+	object.SensitivePaths = paths
+
+	component := m.component(object.ComponentInstanceAddr)
+	resource, ok := component.Resources[object.ResourceInstanceAddr]
+	if !ok {
+		resource = &ResourceInstanceState{Addr: object.ResourceInstanceAddr, Deposed: make(map[string]*ResourceInstanceObjectState)}
+		component.Resources[object.ResourceInstanceAddr] = resource
+	}
+	if object.DeposedKey == "" {
+		resource.Current = object
+	} else {
+		resource.Deposed[object.DeposedKey] = object
+	}
+	return nil
+}
+
+// component returns the state of a component instance, adding it to the model if needed.
+func (m *StackStateModel) component(addr string) *ComponentInstanceState {
+	component, ok := m.Components[addr]
+	if !ok {
+		component = &ComponentInstanceState{Addr: addr, Resources: make(map[string]*ResourceInstanceState)}
+		m.Components[addr] = component
+	}
+	return component
+}
+
+// decodeValues decodes the output values or input variables of a component instance, recording the values that
+// cannot be decoded as warnings.
+func (m *StackStateModel) decodeValues(key string, kind string, values map[string]*tfstackdata1.DynamicValue) map[string]*DecodedValue {
+	decoded := make(map[string]*DecodedValue)
+	for _, name := range tfconfigutil.SortedKeys(values) {
+		value, err := decodeMsgpackValue(values[name].GetValue().GetMsgpack(), cty.DynamicPseudoType)
+		if err != nil {
+			m.Warnings = append(m.Warnings, fmt.Sprintf("%s: invalid %s %s: %s", key, kind, name, err))
+			continue
+		}
+		paths, err := decodePaths(values[name].GetSensitivePaths())
+		if err != nil {
+			m.Warnings = append(m.Warnings, fmt.Sprintf("%s: invalid sensitive path of %s %s: %s", key, kind, name, err))
+		}
+		decoded[name] = &DecodedValue{Value: value, SensitivePaths: paths}
+	}
+	return decoded
+}
+
+// decodePaths converts attribute paths into cty paths.
+func decodePaths(paths []*planproto.Path) ([]cty.Path, error) {
+	var decoded []cty.Path
+	for _, path := range paths {
+		var steps cty.Path
+		for _, step := range path.GetSteps() {
+			switch selector := step.GetSelector().(type) {
+			case *planproto.Path_Step_AttributeName:
+				steps = steps.GetAttr(selector.AttributeName)
+			case *planproto.Path_Step_ElementKey:
+				key, err := decodeMsgpackKey(selector.ElementKey.GetMsgpack())
+				if err != nil {
+					return decoded, err
+				}
+				steps = steps.Index(key)
+			default:
+				return decoded, fmt.Errorf("path step without selector")
+			}
+		}
+		decoded = append(decoded, steps)
+	}
+	return decoded, nil
+}
+
+// rawKeyPrefix returns the type prefix of a raw state key.
+func rawKeyPrefix(key string) string {
+	if len(key) < rawKeyPrefixLength {
+		return key
+	}
+	return key[:rawKeyPrefixLength]
+}
+
+// splitRawKey splits the comma separated parts of a raw state key, ignoring the commas inside quoted instance keys.
+func splitRawKey(suffix string) []string {
+	var parts []string
+	var current strings.Builder
+	quoted, escaped := false, false
+	for _, c := range suffix {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	return append(parts, current.String())
+}
@@ -0,0 +1,422 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+// msgpackExt is a MessagePack extension value, which cty uses to encode unknown values.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackEntry is one key-value pair of a MessagePack map, kept in encoding order.
+type msgpackEntry struct {
+	Key   any
+	Value any
+}
+
+// msgpackReader decodes MessagePack data into plain Go values, without any knowledge of the encoded cty type.
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+// decodeMsgpackValue decodes a cty value from its MessagePack encoding, as Terraform stores dynamic values in stack
+// state. The values in stack state are encoded with the dynamic pseudo-type, so the encoding carries its own type.
+func decodeMsgpackValue(raw []byte, ty cty.Type) (cty.Value, error) {
+	if len(raw) == 0 {
+		return cty.NullVal(ty), nil
+	}
+	reader := &msgpackReader{data: raw}
+	decoded, err := reader.read()
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if reader.pos != len(raw) {
+		return cty.NilVal, fmt.Errorf("unexpected %d trailing bytes after MessagePack value", len(raw)-reader.pos)
+	}
+	return msgpackToCty(decoded, ty, nil)
+}
+
+// decodeMsgpackKey decodes a collection key of a sensitive path, which is encoded with its own type rather than the
+// dynamic pseudo-type.
+func decodeMsgpackKey(raw []byte) (cty.Value, error) {
+	reader := &msgpackReader{data: raw}
+	decoded, err := reader.read()
+	if err != nil {
+		return cty.NilVal, err
+	}
+	switch key := decoded.(type) {
+	case string:
+		return cty.StringVal(key), nil
+	case int64:
+		return cty.NumberIntVal(key), nil
+	case uint64:
+		return cty.NumberUIntVal(key), nil
+	case float64:
+		return cty.NumberFloatVal(key), nil
+	default:
+		return cty.NilVal, fmt.Errorf("unsupported path key of type %T", decoded)
+	}
+}
+
+// msgpackToCty converts a decoded MessagePack value into a cty value of the given type.
+func msgpackToCty(decoded any, ty cty.Type, path cty.Path) (cty.Value, error) {
+	switch decoded.(type) {
+	case nil:
+		return cty.NullVal(ty), nil
+	case msgpackExt:
+		return cty.UnknownVal(ty), nil
+	}
+
+	switch {
+	case ty == cty.DynamicPseudoType:
+		wrapper, ok := decoded.([]any)
+		if !ok || len(wrapper) != 2 {
+			return cty.NilVal, path.NewErrorf("dynamic value is not a type and value pair")
+		}
+		var typeJSON []byte
+		switch t := wrapper[0].(type) {
+		case []byte:
+			typeJSON = t
+		case string:
+			typeJSON = []byte(t)
+		default:
+			return cty.NilVal, path.NewErrorf("dynamic value has no type")
+		}
+		concrete, err := ctyjson.UnmarshalType(typeJSON)
+		if err != nil {
+			return cty.NilVal, path.NewErrorf("invalid dynamic value type: %s", err)
+		}
+		return msgpackToCty(wrapper[1], concrete, path)
+	case ty == cty.String:
+		if s, ok := decoded.(string); ok {
+			return cty.StringVal(s), nil
+		}
+	case ty == cty.Bool:
+		if b, ok := decoded.(bool); ok {
+			return cty.BoolVal(b), nil
+		}
+	case ty == cty.Number:
+		switch n := decoded.(type) {
+		case int64:
+			return cty.NumberIntVal(n), nil
+		case uint64:
+			return cty.NumberUIntVal(n), nil
+		case float64:
+			return cty.NumberFloatVal(n), nil
+		case string:
+			v, err := cty.ParseNumberVal(n)
+			if err != nil {
+				return cty.NilVal, path.NewError(err)
+			}
+			return v, nil
+		}
+	case ty.IsListType() || ty.IsSetType():
+		items, ok := decoded.([]any)
+		if !ok {
+			break
+		}
+		if len(items) == 0 {
+			if ty.IsListType() {
+				return cty.ListValEmpty(ty.ElementType()), nil
+			}
+			return cty.SetValEmpty(ty.ElementType()), nil
+		}
+		var elems []cty.Value
+		for i, item := range items {
+			elem, err := msgpackToCty(item, ty.ElementType(), path.IndexInt(i))
+			if err != nil {
+				return cty.NilVal, err
+			}
+			elems = append(elems, elem)
+		}
+		// elements of a dynamic element type are decoded on their own and may not share a type, which a list or
+		// set cannot hold
+		elems, ok = conformElements(elems)
+		if !ok {
+			return cty.TupleVal(elems), nil
+		}
+		if ty.IsListType() {
+			return cty.ListVal(elems), nil
+		}
+		return cty.SetVal(elems), nil
+	case ty.IsTupleType():
+		items, ok := decoded.([]any)
+		if !ok || len(items) != len(ty.TupleElementTypes()) {
+			break
+		}
+		var elems []cty.Value
+		for i, item := range items {
+			elem, err := msgpackToCty(item, ty.TupleElementType(i), path.IndexInt(i))
+			if err != nil {
+				return cty.NilVal, err
+			}
+			elems = append(elems, elem)
+		}
+		return cty.TupleVal(elems), nil
+	case ty.IsMapType() || ty.IsObjectType():
+		entries, ok := decoded.([]msgpackEntry)
+		if !ok {
+			break
+		}
+		attrs := make(map[string]cty.Value)
+		for _, entry := range entries {
+			name, ok := entry.Key.(string)
+			if !ok {
+				return cty.NilVal, path.NewErrorf("map key is not a string")
+			}
+			var elemTy cty.Type
+			switch {
+			case ty.IsMapType():
+				elemTy = ty.ElementType()
+			case ty.HasAttribute(name):
+				elemTy = ty.AttributeType(name)
+			default:
+				return cty.NilVal, path.NewErrorf("unexpected attribute %q", name)
+			}
+			attr, err := msgpackToCty(entry.Value, elemTy, path.GetAttr(name))
+			if err != nil {
+				return cty.NilVal, err
+			}
+			attrs[name] = attr
+		}
+		if ty.IsMapType() {
+			if len(attrs) == 0 {
+				return cty.MapValEmpty(ty.ElementType()), nil
+			}
+			names := tfconfigutil.SortedKeys(attrs)
+			elems := make([]cty.Value, len(names))
+			for i, name := range names {
+				elems[i] = attrs[name]
+			}
+			if elems, ok = conformElements(elems); !ok {
+				return cty.ObjectVal(attrs), nil
+			}
+			for i, name := range names {
+				attrs[name] = elems[i]
+			}
+			return cty.MapVal(attrs), nil
+		}
+		for name, attrTy := range ty.AttributeTypes() {
+			if _, ok := attrs[name]; !ok {
+				attrs[name] = cty.NullVal(attrTy)
+			}
+		}
+		return cty.ObjectVal(attrs), nil
+	}
+
+	return cty.NilVal, path.NewErrorf("cannot decode %T as %s", decoded, ty.FriendlyName())
+}
+
+// conformElements gives null and unknown elements of the dynamic pseudo-type the type the other elements share, so
+// they can form a collection. It reports false, returning the elements unchanged, if the other elements do not all
+// have the same type.
+func conformElements(elems []cty.Value) ([]cty.Value, bool) {
+	shared := cty.DynamicPseudoType
+	for _, elem := range elems {
+		switch ty := elem.Type(); {
+		case ty == cty.DynamicPseudoType:
+		case shared == cty.DynamicPseudoType:
+			shared = ty
+		case !ty.Equals(shared):
+			return elems, false
+		}
+	}
+	if shared == cty.DynamicPseudoType {
+		return elems, true
+	}
+
+	conformed := make([]cty.Value, len(elems))
+	for i, elem := range elems {
+		switch {
+		case elem.Type() != cty.DynamicPseudoType:
+			conformed[i] = elem
+		case elem.IsNull():
+			conformed[i] = cty.NullVal(shared)
+		default:
+			conformed[i] = cty.UnknownVal(shared)
+		}
+	}
+	return conformed, true
+}
+
+// read decodes the next MessagePack value.
+func (r *msgpackReader) read() (any, error) {
+	code, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code >= 0x80 && code <= 0x8f:
+		return r.readMap(int(code & 0x0f))
+	case code >= 0x90 && code <= 0x9f:
+		return r.readArray(int(code & 0x0f))
+	case code >= 0xa0 && code <= 0xbf:
+		b, err := r.bytes(int(code & 0x1f))
+		return string(b), err
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.length(code - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytes(n)
+		return append([]byte{}, b...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.length(code - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return r.readExt(n)
+	case 0xca:
+		b, err := r.bytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 0xcb:
+		b, err := r.bytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := r.bytes(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return bigEndianUint(b), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		b, err := r.bytes(1 << (code - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*len(b)
+		return int64(bigEndianUint(b)<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.readExt(1 << (code - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.length(code - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytes(n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := r.length(code - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return r.readArray(n)
+	case 0xde, 0xdf:
+		n, err := r.length(code - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return r.readMap(n)
+	}
+
+	return nil, fmt.Errorf("unsupported MessagePack code 0x%02x at offset %d", code, r.pos-1)
+}
+
+// readArray decodes the given number of array elements.
+func (r *msgpackReader) readArray(n int) ([]any, error) {
+	items := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		item, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// readMap decodes the given number of map entries.
+func (r *msgpackReader) readMap(n int) ([]msgpackEntry, error) {
+	entries := make([]msgpackEntry, 0, n)
+	for i := 0; i < n; i++ {
+		key, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, msgpackEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// readExt decodes an extension value with a payload of the given size.
+func (r *msgpackReader) readExt(n int) (msgpackExt, error) {
+	t, err := r.byte()
+	if err != nil {
+		return msgpackExt{}, err
+	}
+	b, err := r.bytes(n)
+	return msgpackExt{Type: int8(t), Data: b}, err
+}
+
+// length decodes a big endian length of 1, 2 or 4 bytes, selected by size 0, 1 or 2.
+func (r *msgpackReader) length(size byte) (int, error) {
+	b, err := r.bytes(1 << size)
+	if err != nil {
+		return 0, err
+	}
+	return int(bigEndianUint(b)), nil
+}
+
+// byte returns the next byte of the data.
+func (r *msgpackReader) byte() (byte, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// bytes returns the next n bytes of the data.
+func (r *msgpackReader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("unexpected end of MessagePack data at offset %d", r.pos)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// bigEndianUint decodes an unsigned big endian integer of up to 8 bytes.
+func bigEndianUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// msgpackStr encodes a short MessagePack string.
+func msgpackStr(s string) []byte {
+	if len(s) < 32 {
+		return append([]byte{0xa0 | byte(len(s))}, s...)
+	}
+	return append([]byte{0xd9, byte(len(s))}, s...)
+}
+
+// msgpackDynamic encodes a value with the dynamic pseudo-type, as a pair of its JSON type and its encoding.
+func msgpackDynamic(typeJSON string, value []byte) []byte {
+	return append(append([]byte{0x92}, msgpackStr(typeJSON)...), value...)
+}
+
+func TestDecodeMsgpackValue_DynamicCollections(t *testing.T) {
+	str, num, null := msgpackStr("a"), []byte{0x01}, []byte{0xc0}
+
+	tests := map[string]struct {
+		raw  []byte
+		want cty.Value
+	}{
+		"heterogeneous list": {
+			raw: msgpackDynamic(`["list","dynamic"]`, append(append([]byte{0x92},
+				msgpackDynamic(`"string"`, str)...), msgpackDynamic(`"number"`, num)...)),
+			want: cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.NumberIntVal(1)}),
+		},
+		"list with a dynamic null": {
+			raw: msgpackDynamic(`["list","dynamic"]`, append(append([]byte{0x92},
+				msgpackDynamic(`"string"`, str)...), null...)),
+			want: cty.ListVal([]cty.Value{cty.StringVal("a"), cty.NullVal(cty.String)}),
+		},
+		"heterogeneous set": {
+			raw: msgpackDynamic(`["set","dynamic"]`, append(append([]byte{0x92},
+				msgpackDynamic(`"string"`, str)...), msgpackDynamic(`"number"`, num)...)),
+			want: cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.NumberIntVal(1)}),
+		},
+		"heterogeneous map": {
+			raw: msgpackDynamic(`["map","dynamic"]`, append(append(append(append([]byte{0x82},
+				msgpackStr("x")...), msgpackDynamic(`"string"`, str)...), msgpackStr("y")...), msgpackDynamic(`"number"`, num)...)),
+			want: cty.ObjectVal(map[string]cty.Value{"x": cty.StringVal("a"), "y": cty.NumberIntVal(1)}),
+		},
+		"homogeneous map": {
+			raw: msgpackDynamic(`["map","dynamic"]`, append(append(append(append([]byte{0x82},
+				msgpackStr("x")...), msgpackDynamic(`"string"`, str)...), msgpackStr("y")...), null...)),
+			want: cty.MapVal(map[string]cty.Value{"x": cty.StringVal("a"), "y": cty.NullVal(cty.String)}),
+		},
+	}
+	for name, test := range tests {
+		got, err := decodeMsgpackValue(test.raw, cty.DynamicPseudoType)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if !got.RawEquals(test.want) {
+			t.Errorf("%s: got %#v, want %#v", name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstackdata1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+	"github.com/hashicorp/terraform-migrate-utility/stateops"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+)
+
+const (
+	instanceKeyExpression      = `\[(?:"(?:[^"\\]|\\.)*"|[0-9]+)\]`
+	resourceInstanceExpression = `^((?:module\.[A-Za-z_][A-Za-z0-9_-]*(?:` + instanceKeyExpression + `)?\.)*)(data\.)?([A-Za-z_][A-Za-z0-9_-]*)\.([A-Za-z_][A-Za-z0-9_-]*)(` + instanceKeyExpression + `)?$`
+	stackStateBackupFileExt    = `.backup`
+	stackStateLogFileExt       = `.log`
+	surgeryOperationMove       = `mv`
+	surgeryOperationRemove     = `rm`
+)
+
+// StackStateSurgeryRequest represents the request parameters for moving or removing a component instance or resource
+// instance in a stack state snapshot.
+type StackStateSurgeryRequest struct {
+	StatePath   string // StatePath is the path to the stack state snapshot, which is rewritten in place.
+	Source      string // Source is the address of the component instance or resource instance, such as component.app or component.app.aws_instance.web.
+	Destination string // Destination is the new address of a moved component instance or resource instance, ignored for removals.
+	BackupPath  string // BackupPath is an optional path for the backup of the snapshot, defaults to the state path with a timestamp and a .backup extension.
+	LogPath     string // LogPath is an optional path for the operation log, defaults to the state path with a .log extension.
+}
+
+// StackStateSurgeryResult describes one operation applied to a stack state snapshot, as recorded in the operation log.
+type StackStateSurgeryResult struct {
+	Operation   string            `json:"operation"`
+	Timestamp   string            `json:"timestamp"`
+	Source      string            `json:"source"`
+	Destination string            `json:"destination,omitempty"`
+	RenamedKeys map[string]string `json:"renamed_keys,omitempty"` // RenamedKeys maps each renamed raw key to its new key.
+	RemovedKeys []string          `json:"removed_keys,omitempty"` // RemovedKeys are the raw keys that were removed.
+	UpdatedKeys []string          `json:"updated_keys,omitempty"` // UpdatedKeys are the raw keys whose messages had their embedded addresses rewritten.
+	BackupPath  string            `json:"backup_path"`
+	LogPath     string            `json:"-"`
+}
+
+// MoveStackStateAddress moves a component instance with all its resources, or a single resource instance with its
+// deposed objects, to a new address in a stack state snapshot. The raw keys and the matching descriptions are
+// renamed, and the dependency addresses recorded in the other entries are rewritten when no instance of the old
+// configuration address remains. The snapshot is backed up before it is rewritten and the operation is appended to
+// the operation log.
+func (s *stackStateUtility) MoveStackStateAddress(request StackStateSurgeryRequest) (*StackStateSurgeryResult, error) {
+	if request.Destination == "" {
+		return nil, fmt.Errorf("the destination address must be set")
+	}
+	source, err := tfstateutil.ParseStackComponentAddress(request.Source)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := tfstateutil.ParseStackComponentAddress(request.Destination)
+	if err != nil {
+		return nil, err
+	}
+	if (source.Resource == "") != (destination.Resource == "") {
+		return nil, fmt.Errorf("cannot move %s to %s, a component instance can only be moved to a component instance and a resource instance to a resource instance", request.Source, request.Destination)
+	}
+
+	state, model, err := s.readStackStateForSurgery(request.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	result := &StackStateSurgeryResult{
+		Operation:   surgeryOperationMove,
+		Source:      request.Source,
+		Destination: request.Destination,
+		RenamedKeys: make(map[string]string),
+	}
+
+	if source.Resource == "" {
+		err = moveComponentInstance(state, model, source, destination, result)
+	} else {
+		err = moveResourceInstance(state, model, source, destination, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	renameDescriptions(state, result.RenamedKeys)
+
+	if err := commitStackStateSurgery(request, state, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RemoveStackStateAddress removes a component instance with all its resources, or a single resource instance with its
+// deposed objects, from a stack state snapshot together with the matching descriptions. The dependency addresses
+// recorded in the other entries are removed when no instance of the removed configuration address remains. The
+// snapshot is backed up before it is rewritten and the operation is appended to the operation log.
+func (s *stackStateUtility) RemoveStackStateAddress(request StackStateSurgeryRequest) (*StackStateSurgeryResult, error) {
+	source, err := tfstateutil.ParseStackComponentAddress(request.Source)
+	if err != nil {
+		return nil, err
+	}
+	state, model, err := s.readStackStateForSurgery(request.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	result := &StackStateSurgeryResult{Operation: surgeryOperationRemove, Source: request.Source}
+
+	component, ok := model.Components[source.String()]
+	if !ok {
+		return nil, fmt.Errorf("no component instance %s in stack state %s", source.String(), request.StatePath)
+	}
+	if source.Resource == "" {
+		if component.RawKey != "" {
+			result.RemovedKeys = append(result.RemovedKeys, component.RawKey)
+		}
+		for _, resource := range component.Resources {
+			result.RemovedKeys = append(result.RemovedKeys, resourceObjectKeys(resource)...)
+		}
+	} else {
+		resource, ok := component.Resources[source.Resource]
+		if !ok {
+			return nil, fmt.Errorf("no resource instance %s in stack state %s", request.Source, request.StatePath)
+		}
+		result.RemovedKeys = resourceObjectKeys(resource)
+	}
+	slices.Sort(result.RemovedKeys)
+
+	for _, key := range result.RemovedKeys {
+		delete(state.Raw, key)
+	}
+	for key, description := range state.Descriptions {
+		if slices.Contains(result.RemovedKeys, key) || slices.Contains(result.RemovedKeys, descriptionRawKey(description)) {
+			delete(state.Descriptions, key)
+		}
+	}
+
+	// the entries that depended on the removed address record its configuration address, which only goes away if no
+	// other instance of the configuration remains
+	if source.Resource == "" {
+		config := source.ConfigAddr()
+		if !hasComponentInstanceOf(model, config, source.String()) {
+			err = updateComponentDependencies(state, result, func(msg *tfstackdata1.StateComponentInstanceV1) bool {
+				var dependencies, dependents bool
+				msg.DependencyAddrs, dependencies = removeAddr(msg.DependencyAddrs, config)
+				msg.DependentAddrs, dependents = removeAddr(msg.DependentAddrs, config)
+				return dependencies || dependents
+			})
+		}
+	} else {
+		_, _, config, parseErr := parseResourceInstanceAddr(source.Resource)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		if !hasResourceInstanceOf(component, config, source.Resource) {
+			err = updateResourceDependencies(state, source.String(), result, func(msg *tfstackdata1.StateResourceInstanceObjectV1) bool {
+				var removed bool
+				msg.Dependencies, removed = removeAddr(msg.Dependencies, config)
+				return removed
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := commitStackStateSurgery(request, state, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readStackStateForSurgery reads and decodes a stack state snapshot, refusing states with unrecognized entries since
+// their embedded addresses cannot be rewritten.
+func (s *stackStateUtility) readStackStateForSurgery(path string) (*tfstacksagent1.StackState, *StackStateModel, error) {
+	state, err := stateops.ReadStackStateSnapshot(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	model, err := s.DecodeStackState(state)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode stack state %s: %w", path, err)
+	}
+	if len(model.Unrecognized) > 0 {
+		return nil, nil, fmt.Errorf("stack state %s has %d unrecognized raw entries, such as %s, which cannot be rewritten safely",
+			path, len(model.Unrecognized), model.Unrecognized[0].Key)
+	}
+	if state.Descriptions == nil {
+		state.Descriptions = make(map[string]*stacks.AppliedChange_ChangeDescription)
+	}
+	return state, model, nil
+}
+
+// moveComponentInstance renames the raw keys of a component instance and all its resource instance objects.
+func moveComponentInstance(state *tfstacksagent1.StackState, model *StackStateModel, source *tfstateutil.StackComponentAddress, destination *tfstateutil.StackComponentAddress, result *StackStateSurgeryResult) error {
+	component, ok := model.Components[source.String()]
+	if !ok {
+		return fmt.Errorf("no component instance %s in the stack state", source.String())
+	}
+	if _, ok := model.Components[destination.String()]; ok {
+		return fmt.Errorf("the component instance %s is already in the stack state", destination.String())
+	}
+
+	if component.RawKey != "" {
+		result.RenamedKeys[component.RawKey] = componentInstanceKeyPrefix + destination.String()
+	}
+	for _, resource := range component.Resources {
+		for _, key := range resourceObjectKeys(resource) {
+			parts := splitRawKey(strings.TrimPrefix(key, resourceInstanceObjectKeyPrefix))
+			result.RenamedKeys[key] = resourceObjectKey(destination.String(), parts[1], parts[2])
+		}
+	}
+	renameRawKeys(state, result.RenamedKeys)
+
+	// the components that depend on the moved one record its configuration address, which only changes if no other
+	// instance of the old configuration remains
+	oldConfig, newConfig := source.ConfigAddr(), destination.ConfigAddr()
+	if oldConfig == newConfig || hasComponentInstanceOf(model, oldConfig, source.String()) {
+		return nil
+	}
+	return updateComponentDependencies(state, result, func(msg *tfstackdata1.StateComponentInstanceV1) bool {
+		dependencies := replaceAddr(msg.DependencyAddrs, oldConfig, newConfig)
+		dependents := replaceAddr(msg.DependentAddrs, oldConfig, newConfig)
+		return dependencies || dependents
+	})
+}
+
+// moveResourceInstance renames the raw keys of the objects of a resource instance. Dependencies are only recorded
+// within a component instance, so a resource instance that depends on other resources, or that the other resources
+// of its component instance depend on, cannot be moved into another component instance.
+func moveResourceInstance(state *tfstacksagent1.StackState, model *StackStateModel, source *tfstateutil.StackComponentAddress, destination *tfstateutil.StackComponentAddress, result *StackStateSurgeryResult) error {
+	sourceComponent, ok := model.Components[source.String()]
+	if !ok {
+		return fmt.Errorf("no component instance %s in the stack state", source.String())
+	}
+	resource, ok := sourceComponent.Resources[source.Resource]
+	if !ok {
+		return fmt.Errorf("no resource instance %s.%s in the stack state", source.String(), source.Resource)
+	}
+	destinationComponent, ok := model.Components[destination.String()]
+	if !ok {
+		return fmt.Errorf("no component instance %s in the stack state to move the resource into", destination.String())
+	}
+	if _, ok := destinationComponent.Resources[destination.Resource]; ok {
+		return fmt.Errorf("the resource instance %s.%s is already in the stack state", destination.String(), destination.Resource)
+	}
+
+	sourceMode, sourceType, sourceConfig, err := parseResourceInstanceAddr(source.Resource)
+	if err != nil {
+		return err
+	}
+	destinationMode, destinationType, destinationConfig, err := parseResourceInstanceAddr(destination.Resource)
+	if err != nil {
+		return err
+	}
+	if sourceMode != destinationMode || sourceType != destinationType {
+		return fmt.Errorf("cannot move %s to %s, a resource instance can only be moved to a resource of the same mode and type", source.Resource, destination.Resource)
+	}
+
+	// the resources of the same component instance that depend on the moved one record its configuration address,
+	// which only changes if no other instance of the old configuration remains
+	dependentsRemain := hasResourceInstanceOf(sourceComponent, sourceConfig, source.Resource)
+	if source.String() != destination.String() {
+		for _, object := range sourceComponent.ResourceObjects() {
+			if object.ResourceInstanceAddr == source.Resource && len(object.Dependencies) > 0 {
+				return fmt.Errorf("cannot move %s to %s, the resource instance depends on %s, which is not part of the destination component instance",
+					source.String()+"."+source.Resource, destination.String()+"."+destination.Resource, strings.Join(object.Dependencies, ", "))
+			}
+			if object.ResourceInstanceAddr != source.Resource && !dependentsRemain && slices.Contains(object.Dependencies, sourceConfig) {
+				return fmt.Errorf("cannot move %s to %s, the resource instance %s depends on it and would be left with a dependency on a resource outside its component instance",
+					source.String()+"."+source.Resource, destination.String()+"."+destination.Resource, object.StackAddr())
+			}
+		}
+	}
+
+	for _, key := range resourceObjectKeys(resource) {
+		parts := splitRawKey(strings.TrimPrefix(key, resourceInstanceObjectKeyPrefix))
+		result.RenamedKeys[key] = resourceObjectKey(destination.String(), destination.Resource, parts[2])
+	}
+	renameRawKeys(state, result.RenamedKeys)
+
+	if source.String() != destination.String() || sourceConfig == destinationConfig || dependentsRemain {
+		return nil
+	}
+	return updateResourceDependencies(state, source.String(), result, func(msg *tfstackdata1.StateResourceInstanceObjectV1) bool {
+		return replaceAddr(msg.Dependencies, sourceConfig, destinationConfig)
+	})
+}
+
+// updateComponentDependencies applies an update to the dependency addresses of every component instance entry,
+// recording the entries that changed.
+func updateComponentDependencies(state *tfstacksagent1.StackState, result *StackStateSurgeryResult, update func(*tfstackdata1.StateComponentInstanceV1) bool) error {
+	for _, key := range tfconfigutil.SortedKeys(state.Raw) {
+		if rawKeyPrefix(key) != componentInstanceKeyPrefix {
+			continue
+		}
+		updated, err := updateRawMessage(state.Raw[key], &tfstackdata1.StateComponentInstanceV1{}, update)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", key, err)
+		}
+		if updated != nil {
+			state.Raw[key] = updated
+			result.UpdatedKeys = append(result.UpdatedKeys, key)
+		}
+	}
+	return nil
+}
+
+// updateResourceDependencies applies an update to the dependencies of every resource instance object of a component
+// instance, recording the entries that changed.
+func updateResourceDependencies(state *tfstacksagent1.StackState, componentAddr string, result *StackStateSurgeryResult, update func(*tfstackdata1.StateResourceInstanceObjectV1) bool) error {
+	prefix := resourceInstanceObjectKeyPrefix + componentAddr + ","
+	for _, key := range tfconfigutil.SortedKeys(state.Raw) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		updated, err := updateRawMessage(state.Raw[key], &tfstackdata1.StateResourceInstanceObjectV1{}, update)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", key, err)
+		}
+		if updated != nil {
+			state.Raw[key] = updated
+			result.UpdatedKeys = append(result.UpdatedKeys, key)
+		}
+	}
+	return nil
+}
+
+// commitStackStateSurgery backs up the snapshot, writes the updated state and appends the operation to the log.
+func commitStackStateSurgery(request StackStateSurgeryRequest, state *tfstacksagent1.StackState, result *StackStateSurgeryResult) error {
+	now := time.Now().UTC()
+	result.Timestamp = now.Format(time.RFC3339)
+	result.BackupPath = request.BackupPath
+	if result.BackupPath == "" {
+		result.BackupPath = request.StatePath + "." + strconv.FormatInt(now.UnixNano(), 10) + stackStateBackupFileExt
+	}
+	result.LogPath = request.LogPath
+	if result.LogPath == "" {
+		result.LogPath = request.StatePath + stackStateLogFileExt
+	}
+
+	original, err := os.ReadFile(request.StatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", request.StatePath, err)
+	}
+	if err := os.WriteFile(result.BackupPath, original, 0o644); err != nil {
+		return fmt.Errorf("failed to write backup %s: %w", result.BackupPath, err)
+	}
+	if err := stateops.WriteStackStateSnapshot(request.StatePath, state); err != nil {
+		return err
+	}
+
+	entry, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode operation log entry: %w", err)
+	}
+	log, err := os.OpenFile(result.LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open operation log %s: %w", result.LogPath, err)
+	}
+	defer log.Close()
+	if _, err := log.Write(append(entry, '\n')); err != nil {
+		return fmt.Errorf("failed to write operation log %s: %w", result.LogPath, err)
+	}
+	return nil
+}
+
+// renameRawKeys moves the raw entries to their new keys.
+func renameRawKeys(state *tfstacksagent1.StackState, renamed map[string]string) {
+	moved := make(map[string]*anypb.Any)
+	for oldKey, newKey := range renamed {
+		moved[newKey] = state.Raw[oldKey]
+		delete(state.Raw, oldKey)
+	}
+	for key, value := range moved {
+		state.Raw[key] = value
+	}
+}
+
+// renameDescriptions updates the descriptions of the renamed raw entries, rewriting their keys and the addresses they
+// embed.
+func renameDescriptions(state *tfstacksagent1.StackState, renamed map[string]string) {
+	updated := make(map[string]*stacks.AppliedChange_ChangeDescription)
+	for key, description := range state.Descriptions {
+		newRawKey, ok := renamed[descriptionRawKey(description)]
+		if !ok {
+			newRawKey, ok = renamed[key]
+		}
+		if !ok {
+			continue
+		}
+
+		switch d := description.Description.(type) {
+		case *stacks.AppliedChange_ChangeDescription_ResourceInstance:
+			if d.ResourceInstance.Addr != nil {
+				parts := splitRawKey(strings.TrimPrefix(newRawKey, resourceInstanceObjectKeyPrefix))
+				d.ResourceInstance.Addr.ComponentInstanceAddr = parts[0]
+				d.ResourceInstance.Addr.ResourceInstanceAddr = parts[1]
+			}
+		case *stacks.AppliedChange_ChangeDescription_ComponentInstance:
+			addr := strings.TrimPrefix(newRawKey, componentInstanceKeyPrefix)
+			d.ComponentInstance.ComponentInstanceAddr = addr
+			if parsed, err := tfstateutil.ParseStackComponentAddress(addr); err == nil {
+				d.ComponentInstance.ComponentAddr = parsed.ConfigAddr()
+			}
+		}
+
+		delete(state.Descriptions, key)
+		if newKey, ok := renamed[key]; ok {
+			key = newKey
+			description.Key = newKey
+		}
+		updated[key] = description
+	}
+	for key, description := range updated {
+		state.Descriptions[key] = description
+	}
+}
+
+// descriptionRawKey returns the raw key of the entry a description describes, or an empty string for descriptions
+// that do not describe a component instance or resource instance object.
+func descriptionRawKey(description *stacks.AppliedChange_ChangeDescription) string {
+	switch d := description.Description.(type) {
+	case *stacks.AppliedChange_ChangeDescription_ResourceInstance:
+		addr := d.ResourceInstance.GetAddr()
+		if addr == nil {
+			return ""
+		}
+		deposedKey := addr.DeposedKey
+		if deposedKey == "" {
+			deposedKey = currentObjectDeposedKey
+		}
+		return resourceObjectKey(addr.ComponentInstanceAddr, addr.ResourceInstanceAddr, deposedKey)
+	case *stacks.AppliedChange_ChangeDescription_ComponentInstance:
+		return componentInstanceKeyPrefix + d.ComponentInstance.ComponentInstanceAddr
+	default:
+		return ""
+	}
+}
+
+// updateRawMessage decodes a raw entry, applies the update and encodes it again with its original type URL. It
+// returns nil if the update did not change the message.
+func updateRawMessage[M interface {
+	*tfstackdata1.StateComponentInstanceV1 | *tfstackdata1.StateResourceInstanceObjectV1
+	proto.Message
+}](raw *anypb.Any, msg M, update func(M) bool) (*anypb.Any, error) {
+	if err := raw.UnmarshalTo(msg); err != nil {
+		return nil, err
+	}
+	if !update(msg) {
+		return nil, nil
+	}
+	updated, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	updated.TypeUrl = raw.TypeUrl
+	return updated, nil
+}
+
+// replaceAddr replaces every occurrence of an address in a list, reporting whether any was replaced.
+func replaceAddr(addrs []string, oldAddr string, newAddr string) bool {
+	replaced := false
+	for i, addr := range addrs {
+		if addr == oldAddr {
+			addrs[i] = newAddr
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+// removeAddr removes every occurrence of an address from a list, reporting whether any was removed.
+func removeAddr(addrs []string, addr string) ([]string, bool) {
+	remaining := slices.DeleteFunc(addrs, func(a string) bool { return a == addr })
+	return remaining, len(remaining) != len(addrs)
+}
+
+// hasResourceInstanceOf reports whether the component instance holds an instance of the configured resource other
+// than the given one.
+func hasResourceInstanceOf(component *ComponentInstanceState, configAddr string, except string) bool {
+	for addr := range component.Resources {
+		if addr == except {
+			continue
+		}
+		if _, _, config, err := parseResourceInstanceAddr(addr); err == nil && config == configAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// hasComponentInstanceOf reports whether the model holds an instance of the configured component other than the
+// given one.
+func hasComponentInstanceOf(model *StackStateModel, configAddr string, except string) bool {
+	for addr := range model.Components {
+		if addr == except {
+			continue
+		}
+		if parsed, err := tfstateutil.ParseStackComponentAddress(addr); err == nil && parsed.ConfigAddr() == configAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// parseResourceInstanceAddr parses a resource instance address within a component, returning its mode, type and
+// configuration address without instance keys.
+func parseResourceInstanceAddr(addr string) (string, string, string, error) {
+	matches := regexp.MustCompile(resourceInstanceExpression).FindStringSubmatch(addr)
+	if matches == nil {
+		return "", "", "", fmt.Errorf("invalid resource instance address %q", addr)
+	}
+	mode := "managed"
+	if matches[2] != "" {
+		mode = "data"
+	}
+	return mode, matches[3], regexp.MustCompile(instanceKeyExpression).ReplaceAllString(addr, ""), nil
+}
+
+// resourceObjectKeys returns the raw keys of the current and deposed objects of a resource instance.
+func resourceObjectKeys(resource *ResourceInstanceState) []string {
+	var keys []string
+	if resource.Current != nil {
+		keys = append(keys, resource.Current.RawKey)
+	}
+	for _, deposedKey := range tfconfigutil.SortedKeys(resource.Deposed) {
+		keys = append(keys, resource.Deposed[deposedKey].RawKey)
+	}
+	return keys
+}
+
+// resourceObjectKey returns the raw key of a resource instance object.
+func resourceObjectKey(componentAddr string, resourceAddr string, deposedKey string) string {
+	return resourceInstanceObjectKeyPrefix + componentAddr + "," + resourceAddr + "," + deposedKey
+}
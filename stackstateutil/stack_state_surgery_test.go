@@ -0,0 +1,293 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstackdata1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+	"github.com/hashicorp/terraform-migrate-utility/stateops"
+)
+
+const (
+	surgeryTestVpcKey    = `RSRCcomponent.network,aws_vpc.main,cur`
+	surgeryTestSubnetKey = `RSRCcomponent.network,aws_subnet.a,cur`
+)
+
+// writeSurgeryTestState writes a stack state in which the app component depends on the network component and the
+// subnet of the network component depends on its VPC.
+func writeSurgeryTestState(t *testing.T) string {
+	t.Helper()
+
+	raw := make(map[string]*anypb.Any)
+	for key, msg := range map[string]proto.Message{
+		"CMPTcomponent.network":                  &tfstackdata1.StateComponentInstanceV1{DependentAddrs: []string{"component.app"}},
+		"CMPTcomponent.app":                      &tfstackdata1.StateComponentInstanceV1{DependencyAddrs: []string{"component.network"}},
+		surgeryTestVpcKey:                        &tfstackdata1.StateResourceInstanceObjectV1{ValueJson: []byte(`{"id":"vpc-1"}`)},
+		surgeryTestSubnetKey:                     &tfstackdata1.StateResourceInstanceObjectV1{ValueJson: []byte(`{"id":"subnet-1"}`), Dependencies: []string{"aws_vpc.main"}},
+		"RSRCcomponent.app,aws_instance.web,cur": &tfstackdata1.StateResourceInstanceObjectV1{ValueJson: []byte(`{"id":"i-1"}`)},
+	} {
+		value, err := anypb.New(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[key] = value
+	}
+
+	state := &tfstacksagent1.StackState{
+		FormatVersion: 1,
+		Raw:           raw,
+		Descriptions: map[string]*stacks.AppliedChange_ChangeDescription{
+			surgeryTestVpcKey: {
+				Key: surgeryTestVpcKey,
+				Description: &stacks.AppliedChange_ChangeDescription_ResourceInstance{
+					ResourceInstance: &stacks.AppliedChange_ResourceInstance{
+						Addr: &stacks.ResourceInstanceObjectInStackAddr{
+							ComponentInstanceAddr: "component.network",
+							ResourceInstanceAddr:  "aws_vpc.main",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "stack-state.json")
+	if err := stateops.WriteStackStateSnapshot(path, state); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readSurgeryTestState(t *testing.T, path string) *tfstacksagent1.StackState {
+	t.Helper()
+
+	state, err := stateops.ReadStackStateSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func loadSurgeryTestModel(t *testing.T, path string) *StackStateModel {
+	t.Helper()
+
+	model, err := NewStackStateUtility(context.Background()).LoadStackState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+func readSurgeryLog(t *testing.T, path string) []*StackStateSurgeryResult {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []*StackStateSurgeryResult
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &StackStateSurgeryResult{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			t.Fatalf("invalid log entry %s: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestMoveStackStateAddress_ResourceRoundTrip(t *testing.T) {
+	path := writeSurgeryTestState(t)
+	original := readSurgeryTestState(t, path)
+	originalBytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	util := NewStackStateUtility(context.Background())
+
+	result, err := util.MoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath:   path,
+		Source:      "component.network.aws_vpc.main",
+		Destination: "component.network.aws_vpc.primary",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	backup, err := os.ReadFile(result.BackupPath)
+	if err != nil || string(backup) != string(originalBytes) {
+		t.Errorf("the backup %s does not hold the original state: %v", result.BackupPath, err)
+	}
+	if !slices.Equal(result.UpdatedKeys, []string{surgeryTestSubnetKey}) {
+		t.Errorf("expected the subnet to be updated, got %v", result.UpdatedKeys)
+	}
+	network := loadSurgeryTestModel(t, path).Components["component.network"]
+	if network.Resources["aws_vpc.primary"] == nil || network.Resources["aws_vpc.main"] != nil {
+		t.Fatalf("the VPC was not moved, got %v", network.Resources)
+	}
+	if got := network.Resources["aws_subnet.a"].Current.Dependencies; !slices.Equal(got, []string{"aws_vpc.primary"}) {
+		t.Errorf("expected the subnet to depend on the moved VPC, got %v", got)
+	}
+	moved := readSurgeryTestState(t, path)
+	description := moved.Descriptions["RSRCcomponent.network,aws_vpc.primary,cur"]
+	if description.GetResourceInstance().GetAddr().GetResourceInstanceAddr() != "aws_vpc.primary" {
+		t.Errorf("the description was not moved, got %v", moved.Descriptions)
+	}
+
+	if _, err := util.MoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath:   path,
+		Source:      "component.network.aws_vpc.primary",
+		Destination: "component.network.aws_vpc.main",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored := readSurgeryTestState(t, path); !proto.Equal(restored, original) {
+		t.Errorf("moving the VPC back did not restore the state")
+	}
+
+	entries := readSurgeryLog(t, result.LogPath)
+	if len(entries) != 2 {
+		t.Fatalf("expected a log entry per operation, got %d", len(entries))
+	}
+	if entries[0].Operation != surgeryOperationMove || entries[0].Source != "component.network.aws_vpc.main" ||
+		entries[0].RenamedKeys[surgeryTestVpcKey] != "RSRCcomponent.network,aws_vpc.primary,cur" || entries[0].BackupPath != result.BackupPath {
+		t.Errorf("unexpected log entry %+v", entries[0])
+	}
+}
+
+func TestMoveStackStateAddress_ComponentRoundTrip(t *testing.T) {
+	path := writeSurgeryTestState(t)
+	original := readSurgeryTestState(t, path)
+	util := NewStackStateUtility(context.Background())
+
+	if _, err := util.MoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath:   path,
+		Source:      "component.network",
+		Destination: "component.net",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	model := loadSurgeryTestModel(t, path)
+	if model.Components["component.network"] != nil || len(model.Components["component.net"].Resources) != 2 {
+		t.Fatalf("the component was not moved with its resources, got %v", model.ComponentAddrs())
+	}
+	if got := model.Components["component.app"].DependencyAddrs; !slices.Equal(got, []string{"component.net"}) {
+		t.Errorf("expected the app to depend on the moved component, got %v", got)
+	}
+
+	if _, err := util.MoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath:   path,
+		Source:      "component.net",
+		Destination: "component.network",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored := readSurgeryTestState(t, path); !proto.Equal(restored, original) {
+		t.Errorf("moving the component back did not restore the state")
+	}
+}
+
+func TestMoveStackStateAddress_RefusesCrossComponentDependencies(t *testing.T) {
+	path := writeSurgeryTestState(t)
+	original := readSurgeryTestState(t, path)
+	util := NewStackStateUtility(context.Background())
+
+	for source, destination := range map[string]string{
+		"component.network.aws_subnet.a": "component.app.aws_subnet.a",
+		"component.network.aws_vpc.main": "component.app.aws_vpc.main",
+	} {
+		backupPath := filepath.Join(t.TempDir(), "state.backup")
+		_, err := util.MoveStackStateAddress(StackStateSurgeryRequest{
+			StatePath:   path,
+			Source:      source,
+			Destination: destination,
+			BackupPath:  backupPath,
+		})
+		if err == nil {
+			t.Errorf("expected moving %s to %s to be refused", source, destination)
+		}
+		if _, err := os.Stat(backupPath); !os.IsNotExist(err) {
+			t.Errorf("a backup was written for the refused move of %s", source)
+		}
+	}
+	if state := readSurgeryTestState(t, path); !proto.Equal(state, original) {
+		t.Errorf("the refused moves changed the state")
+	}
+
+	if _, err := util.MoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath:   path,
+		Source:      "component.app.aws_instance.web",
+		Destination: "component.network.aws_instance.web",
+	}); err != nil {
+		t.Errorf("unexpected error moving a resource without dependencies: %v", err)
+	}
+}
+
+func TestRemoveStackStateAddress_Resource(t *testing.T) {
+	path := writeSurgeryTestState(t)
+
+	result, err := NewStackStateUtility(context.Background()).RemoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath: path,
+		Source:    "component.network.aws_vpc.main",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(result.RemovedKeys, []string{surgeryTestVpcKey}) || !slices.Equal(result.UpdatedKeys, []string{surgeryTestSubnetKey}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	state := readSurgeryTestState(t, path)
+	if state.Raw[surgeryTestVpcKey] != nil || state.Descriptions[surgeryTestVpcKey] != nil {
+		t.Errorf("the VPC or its description is still in the state")
+	}
+	network := loadSurgeryTestModel(t, path).Components["component.network"]
+	if got := network.Resources["aws_subnet.a"].Current.Dependencies; len(got) > 0 {
+		t.Errorf("expected the subnet to have no dependencies left, got %v", got)
+	}
+
+	entries := readSurgeryLog(t, result.LogPath)
+	if len(entries) != 1 || entries[0].Operation != surgeryOperationRemove || !slices.Equal(entries[0].RemovedKeys, result.RemovedKeys) {
+		t.Errorf("unexpected log entries %+v", entries)
+	}
+}
+
+func TestRemoveStackStateAddress_Component(t *testing.T) {
+	path := writeSurgeryTestState(t)
+
+	result, err := NewStackStateUtility(context.Background()).RemoveStackStateAddress(StackStateSurgeryRequest{
+		StatePath: path,
+		Source:    "component.network",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"CMPTcomponent.network", surgeryTestSubnetKey, surgeryTestVpcKey}
+	if !slices.Equal(result.RemovedKeys, want) {
+		t.Errorf("got removed keys %v, want %v", result.RemovedKeys, want)
+	}
+
+	model := loadSurgeryTestModel(t, path)
+	if model.Components["component.network"] != nil {
+		t.Fatal("the component is still in the state")
+	}
+	if got := model.Components["component.app"].DependencyAddrs; len(got) > 0 {
+		t.Errorf("expected the app to have no dependencies left, got %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package stackstateutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+	"github.com/hashicorp/terraform-migrate-utility/stateops"
+)
+
+type stackStateUtility struct {
+	ctx context.Context
+}
+
+// StackStateUtility defines the interface for utility functions that work offline on migrated stack states.
+type StackStateUtility interface {
+	DecodeStackState(state *tfstacksagent1.StackState) (*StackStateModel, error)
+	DiffStackStates(oldPath string, newPath string) (*StackStateDiff, error)
+	ExportWorkspaceState(request StackStateExportRequest) (*StackStateExportResult, error)
+	LintStackState(path string) (*StackStateLintReport, error)
+	ListStackState(path string, w io.Writer) error
+	LoadStackState(path string) (*StackStateModel, error)
+	MoveStackStateAddress(request StackStateSurgeryRequest) (*StackStateSurgeryResult, error)
+	RemoveStackStateAddress(request StackStateSurgeryRequest) (*StackStateSurgeryResult, error)
+	ShowStackOutputs(path string, w io.Writer) error
+	ShowStackResource(path string, addr string, w io.Writer) error
+}
+
+// NewStackStateUtility creates a new instance of stackStateUtility with the provided context.
+func NewStackStateUtility(ctx context.Context) StackStateUtility {
+	return &stackStateUtility{
+		ctx: ctx,
+	}
+}
+
+// LoadStackState reads a stack state snapshot and decodes its raw entries.
+func (s *stackStateUtility) LoadStackState(path string) (*StackStateModel, error) {
+	state, err := stateops.ReadStackStateSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	model, err := s.DecodeStackState(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stack state %s: %w", path, err)
+	}
+	return model, nil
+}
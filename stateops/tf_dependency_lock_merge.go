@@ -0,0 +1,264 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/dependencies"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+// LockMergePolicy decides which version of a provider is kept when the merged lock files lock different versions.
+type LockMergePolicy string
+
+const (
+	LockMergePolicyNewest    LockMergePolicy = "newest"
+	LockMergePolicyOldest    LockMergePolicy = "oldest"
+	LockMergePolicyMustAgree LockMergePolicy = "must_agree"
+)
+
+// WorkspaceDependencyLocks is the opened dependency lock file of one workspace.
+type WorkspaceDependencyLocks struct {
+	Workspace             string // Workspace is the name of the workspace, used in the conflict report.
+	DependencyLocksHandle int64  // DependencyLocksHandle is the handle of the opened dependency lock file of the workspace.
+	LockFilePath          string // LockFilePath is the optional path to the lock file of the workspace, read for the version constraints it records.
+}
+
+// LockMergeRequest represents the request parameters for merging the dependency lock files of several workspaces
+// into the lock file of one stack. The dependency lock files must be opened by the caller.
+type LockMergeRequest struct {
+	Workspaces   []WorkspaceDependencyLocks // Workspaces are the workspaces whose lock files are merged.
+	Policy       LockMergePolicy            // Policy decides which version is kept for providers locked at different versions, defaults to must_agree.
+	LockFilePath string                     // LockFilePath is an optional path to write the merged lock file to, it is only written if the merge has no errors.
+}
+
+// ProviderLockConflict describes a provider the workspaces lock at different versions.
+type ProviderLockConflict struct {
+	Source   string
+	Versions map[string][]string // Versions maps each locked version to the workspaces that lock it.
+	Rejected map[string][]string // Rejected maps each locked version to the workspaces whose version constraints do not allow it.
+	Selected string              // Selected is the version kept by the policy, or empty if the policy requires the versions to agree or no version satisfies every workspace.
+}
+
+// LockMergeReport is the result of merging the dependency lock files of several workspaces.
+type LockMergeReport struct {
+	Selections   []*terraform1.ProviderPackage // Selections are the merged provider selections, sorted by source address.
+	Conflicts    []*ProviderLockConflict       // Conflicts lists the providers locked at different versions.
+	LockFilePath string                        // LockFilePath is the path the merged lock file was written to, if any.
+}
+
+// HasErrors reports whether any conflict could not be resolved by the policy.
+func (r *LockMergeReport) HasErrors() bool {
+	for _, conflict := range r.Conflicts {
+		if conflict.Selected == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeDependencyLocks reads the provider selections of every workspace lock file and merges them into one set,
+// keeping one version per provider according to the policy and the union of the hashes recorded for that version.
+// The version constraints recorded in the lock files given by path restrict the versions the policy can select
+// and are combined into the constraints of the merged lock file.
+func (tf *tfStateOperations) MergeDependencyLocks(request LockMergeRequest) (*LockMergeReport, error) {
+	if len(request.Workspaces) == 0 {
+		return nil, fmt.Errorf("no dependency lock files to merge")
+	}
+
+	locks := make(map[string][]*terraform1.ProviderPackage)
+	constraints := make(map[string]map[string]string)
+	for _, workspace := range request.Workspaces {
+		if _, ok := locks[workspace.Workspace]; ok {
+			return nil, fmt.Errorf("the workspace %q is listed more than once", workspace.Workspace)
+		}
+		providers, err := tf.GetLockedProviderDependencies(workspace.DependencyLocksHandle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the dependency locks of workspace %s: %w", workspace.Workspace, err)
+		}
+		locks[workspace.Workspace] = providers
+
+		if workspace.LockFilePath != "" {
+			locked, err := tfconfigutil.LoadDependencyLockFile(hclparse.NewParser(), workspace.LockFilePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the version constraints of workspace %s: %w", workspace.Workspace, err)
+			}
+			constraints[workspace.Workspace] = make(map[string]string)
+			for _, provider := range locked {
+				constraints[workspace.Workspace][tfconfigutil.NormalizeProviderSource(provider.Source)] = provider.Constraints
+			}
+		}
+	}
+
+	selections, conflicts, err := MergeProviderSelections(locks, constraints, request.Policy)
+	if err != nil {
+		return nil, err
+	}
+	report := &LockMergeReport{Selections: selections, Conflicts: conflicts}
+
+	if request.LockFilePath != "" && !report.HasErrors() {
+		var locked []*tfconfigutil.LockedProvider
+		for _, selection := range selections {
+			locked = append(locked, &tfconfigutil.LockedProvider{
+				Source:      selection.SourceAddr,
+				Version:     selection.Version,
+				Constraints: mergeVersionConstraints(constraints, selection.SourceAddr),
+				Hashes:      selection.Hashes,
+			})
+		}
+		if err := tfconfigutil.WriteDependencyLockFile(request.LockFilePath, locked); err != nil {
+			return nil, err
+		}
+		report.LockFilePath = request.LockFilePath
+	}
+
+	return report, nil
+}
+
+// GetLockedProviderDependencies returns the provider selections of opened dependency locks.
+func (tf *tfStateOperations) GetLockedProviderDependencies(dependencyLocksHandle int64) ([]*terraform1.ProviderPackage, error) {
+	response, err := tf.client.Dependencies().GetLockedProviderDependencies(tf.ctx, &dependencies.GetLockedProviderDependencies_Request{
+		DependencyLocksHandle: dependencyLocksHandle,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.SelectedProviders, nil
+}
+
+// MergeProviderSelections merges the provider selections of several workspaces, keyed by workspace name. Providers
+// locked at the same version by every workspace are merged, those locked at different versions are reported as
+// conflicts and resolved by the policy, which only selects a version the version constraints of every workspace
+// allow. The constraints are keyed by workspace name and provider source, workspaces without constraints allow
+// every version. A conflict the policy does not resolve leaves the provider out of the selections.
+func MergeProviderSelections(locks map[string][]*terraform1.ProviderPackage, constraints map[string]map[string]string, policy LockMergePolicy) ([]*terraform1.ProviderPackage, []*ProviderLockConflict, error) {
+	if policy == "" {
+		policy = LockMergePolicyMustAgree
+	}
+	if policy != LockMergePolicyNewest && policy != LockMergePolicyOldest && policy != LockMergePolicyMustAgree {
+		return nil, nil, fmt.Errorf("unknown lock merge policy %q", policy)
+	}
+
+	// versions maps each provider to each of its locked versions and the packages that lock it
+	versions := make(map[string]map[string][]*terraform1.ProviderPackage)
+	owners := make(map[string]map[string][]string)
+	for _, workspace := range tfconfigutil.SortedKeys(locks) {
+		for _, pkg := range locks[workspace] {
+			source := tfconfigutil.NormalizeProviderSource(pkg.SourceAddr)
+			if versions[source] == nil {
+				versions[source] = make(map[string][]*terraform1.ProviderPackage)
+				owners[source] = make(map[string][]string)
+			}
+			versions[source][pkg.Version] = append(versions[source][pkg.Version], pkg)
+			owners[source][pkg.Version] = append(owners[source][pkg.Version], workspace)
+		}
+	}
+
+	var selections []*terraform1.ProviderPackage
+	var conflicts []*ProviderLockConflict
+	for _, source := range tfconfigutil.SortedKeys(versions) {
+		locked := tfconfigutil.SortedKeys(versions[source])
+		if len(locked) > 1 {
+			sorted, err := sortVersions(locked)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid version of provider %s: %w", source, err)
+			}
+			conflict := &ProviderLockConflict{Source: source, Versions: owners[source], Rejected: make(map[string][]string)}
+			allowed, err := allowedVersions(sorted, constraints, source, conflict.Rejected)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(allowed) > 0 {
+				switch policy {
+				case LockMergePolicyNewest:
+					conflict.Selected = allowed[len(allowed)-1]
+				case LockMergePolicyOldest:
+					conflict.Selected = allowed[0]
+				}
+			}
+			conflicts = append(conflicts, conflict)
+			if conflict.Selected == "" {
+				continue
+			}
+			locked = []string{conflict.Selected}
+		}
+
+		selection := &terraform1.ProviderPackage{SourceAddr: source, Version: locked[0]}
+		for _, pkg := range versions[source][locked[0]] {
+			for _, hash := range pkg.Hashes {
+				if !slices.Contains(selection.Hashes, hash) {
+					selection.Hashes = append(selection.Hashes, hash)
+				}
+			}
+		}
+		sort.Strings(selection.Hashes)
+		selections = append(selections, selection)
+	}
+
+	return selections, conflicts, nil
+}
+
+// allowedVersions returns the versions the version constraints of every workspace allow, in the given order, and
+// records the workspaces that reject each of the other versions.
+func allowedVersions(versions []string, constraints map[string]map[string]string, source string, rejected map[string][]string) ([]string, error) {
+	var allowed []string
+	for _, version := range versions {
+		v, err := tfconfigutil.ParseVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of provider %s: %w", source, err)
+		}
+		for _, workspace := range tfconfigutil.SortedKeys(constraints) {
+			parsed, err := tfconfigutil.ParseVersionConstraints(constraints[workspace][source])
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraints of provider %s in workspace %s: %w", source, workspace, err)
+			}
+			if !parsed.Allows(v) {
+				rejected[version] = append(rejected[version], workspace)
+			}
+		}
+		if len(rejected[version]) == 0 {
+			allowed = append(allowed, version)
+		}
+	}
+	return allowed, nil
+}
+
+// mergeVersionConstraints combines the distinct version constraints the workspaces record for a provider, in the
+// form used by the dependency lock file.
+func mergeVersionConstraints(constraints map[string]map[string]string, source string) string {
+	var merged []string
+	for _, workspace := range tfconfigutil.SortedKeys(constraints) {
+		for _, part := range strings.Split(constraints[workspace][source], ",") {
+			part = strings.TrimSpace(part)
+			if part != "" && !slices.Contains(merged, part) {
+				merged = append(merged, part)
+			}
+		}
+	}
+	return strings.Join(merged, ", ")
+}
+
+// sortVersions sorts version numbers from the oldest to the newest.
+func sortVersions(versions []string) ([]string, error) {
+	parsed := make(map[string]tfconfigutil.Version, len(versions))
+	for _, version := range versions {
+		v, err := tfconfigutil.ParseVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		parsed[version] = v
+	}
+
+	sorted := append([]string{}, versions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return parsed[sorted[i]].Compare(parsed[sorted[j]]) < 0
+	})
+	return sorted, nil
+}
@@ -0,0 +1,167 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/dependencies"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+)
+
+// DependencyLockSynthesisRequest represents the request parameters for creating dependency locks for a workspace
+// that has no dependency lock file. The provider cache must be opened by the caller.
+type DependencyLockSynthesisRequest struct {
+	TerraformConfigFilesAbsPath string // TerraformConfigFilesAbsPath is the absolute path to the directory containing the root module.
+	StateFilePath               string // StateFilePath is an optional path to the state file, whose providers are required as well.
+	ProviderCacheHandle         int64  // ProviderCacheHandle is the handle of the opened provider cache the versions are selected from.
+	LockFilePath                string // LockFilePath is an optional path to write the synthesized dependency lock file to.
+}
+
+// DependencyLockSynthesisResult is the outcome of creating dependency locks from the cached providers.
+type DependencyLockSynthesisResult struct {
+	DependencyLocksHandle int64                                       // DependencyLocksHandle is the handle of the created dependency locks.
+	Close                 func() error                                // Close closes the created dependency locks.
+	Selections            []*terraform1.ProviderPackage               // Selections are the provider packages that were locked, sorted by source address.
+	Requirements          map[string]*tfstateutil.ProviderRequirement // Requirements are the providers required by the configuration and state.
+	LockFilePath          string                                      // LockFilePath is the path the lock file was written to, if any.
+}
+
+// SynthesizeDependencyLocks derives the provider selections of a workspace from the providers its state and
+// configuration require and the providers available in the provider cache, selecting the newest cached version
+// that satisfies the version constraints of every module. The selections are used to create dependency locks,
+// whose handle can be used in place of one opened from a lock file, and are optionally written as a lock file.
+func (tf *tfStateOperations) SynthesizeDependencyLocks(request DependencyLockSynthesisRequest) (*DependencyLockSynthesisResult, error) {
+	requirements, err := tfstateutil.NewTfWorkspaceStateUtility(tf.ctx).ProviderRequirements(request.TerraformConfigFilesAbsPath, request.StateFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(requirements) == 0 {
+		return nil, fmt.Errorf("the workspace does not require any providers")
+	}
+
+	cached, err := tf.GetCachedProviders(request.ProviderCacheHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	selections, err := selectProviderPackages(requirements, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, closeLocks, err := tf.CreateDependencyLocks(selections)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DependencyLockSynthesisResult{
+		DependencyLocksHandle: handle,
+		Close:                 closeLocks,
+		Selections:            selections,
+		Requirements:          requirements,
+	}
+
+	if request.LockFilePath != "" {
+		var locked []*tfconfigutil.LockedProvider
+		for _, selection := range selections {
+			locked = append(locked, &tfconfigutil.LockedProvider{
+				Source:      selection.SourceAddr,
+				Version:     selection.Version,
+				Constraints: requirements[selection.SourceAddr].ConstraintString(),
+				Hashes:      selection.Hashes,
+			})
+		}
+		if err := tfconfigutil.WriteDependencyLockFile(request.LockFilePath, locked); err != nil {
+			_ = closeLocks()
+			return nil, err
+		}
+		result.LockFilePath = request.LockFilePath
+	}
+
+	return result, nil
+}
+
+// CreateDependencyLocks creates dependency locks from the given provider selections and returns a handle to them.
+func (tf *tfStateOperations) CreateDependencyLocks(selections []*terraform1.ProviderPackage) (int64, func() error, error) {
+	response, err := tf.client.Dependencies().CreateDependencyLocks(tf.ctx, &dependencies.CreateDependencyLocks_Request{
+		ProviderSelections: selections,
+	})
+	if err != nil {
+		return -1, nil, err
+	}
+
+	return response.DependencyLocksHandle, func() error {
+		_, err := tf.client.Dependencies().CloseDependencyLocks(context.Background(),
+			&dependencies.CloseDependencyLocks_Request{
+				DependencyLocksHandle: response.DependencyLocksHandle,
+			})
+		return err
+	}, nil
+}
+
+// GetCachedProviders returns the provider packages available in an opened provider cache.
+func (tf *tfStateOperations) GetCachedProviders(providerCacheHandle int64) ([]*terraform1.ProviderPackage, error) {
+	response, err := tf.client.Dependencies().GetCachedProviders(tf.ctx, &dependencies.GetCachedProviders_Request{
+		ProviderCacheHandle: providerCacheHandle,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached providers: %w", err)
+	}
+	return response.AvailableProviders, nil
+}
+
+// selectProviderPackages selects the newest cached package of every required provider that satisfies its constraints.
+func selectProviderPackages(requirements map[string]*tfstateutil.ProviderRequirement, cached []*terraform1.ProviderPackage) ([]*terraform1.ProviderPackage, error) {
+	bySource := make(map[string][]*terraform1.ProviderPackage)
+	for _, pkg := range cached {
+		source := tfconfigutil.NormalizeProviderSource(pkg.SourceAddr)
+		bySource[source] = append(bySource[source], pkg)
+	}
+
+	var selections []*terraform1.ProviderPackage
+	var missing []string
+	for _, source := range tfconfigutil.SortedKeys(requirements) {
+		requirement := requirements[source]
+		constraints, err := tfconfigutil.ParseVersionConstraints(requirement.ConstraintString())
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraints for provider %s: %w", source, err)
+		}
+
+		var selected *terraform1.ProviderPackage
+		var selectedVersion tfconfigutil.Version
+		for _, pkg := range bySource[source] {
+			version, err := tfconfigutil.ParseVersion(pkg.Version)
+			if err != nil || !constraints.Allows(version) {
+				continue
+			}
+			if selected == nil || version.Compare(selectedVersion) > 0 {
+				selected, selectedVersion = pkg, version
+			}
+		}
+
+		if selected == nil {
+			if constraint := requirement.ConstraintString(); constraint != "" {
+				missing = append(missing, fmt.Sprintf("%s (%s)", source, constraint))
+			} else {
+				missing = append(missing, source)
+			}
+			continue
+		}
+		selections = append(selections, &terraform1.ProviderPackage{
+			SourceAddr: source,
+			Version:    selected.Version,
+			Hashes:     selected.Hashes,
+		})
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the provider cache has no version of the providers %s that satisfies their constraints", strings.Join(missing, ", "))
+	}
+
+	return selections, nil
+}
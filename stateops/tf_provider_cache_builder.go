@@ -0,0 +1,218 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/dependencies"
+)
+
+// ProviderCacheEventKind identifies the kind of event reported while building a provider cache.
+type ProviderCacheEventKind string
+
+const (
+	ProviderCacheEventPending          ProviderCacheEventKind = "pending"
+	ProviderCacheEventAlreadyInstalled ProviderCacheEventKind = "already_installed"
+	ProviderCacheEventBuiltIn          ProviderCacheEventKind = "built_in"
+	ProviderCacheEventQueryBegin       ProviderCacheEventKind = "query_begin"
+	ProviderCacheEventQuerySuccess     ProviderCacheEventKind = "query_success"
+	ProviderCacheEventQueryWarnings    ProviderCacheEventKind = "query_warnings"
+	ProviderCacheEventFetchBegin       ProviderCacheEventKind = "fetch_begin"
+	ProviderCacheEventFetchComplete    ProviderCacheEventKind = "fetch_complete"
+	ProviderCacheEventDiagnostic       ProviderCacheEventKind = "diagnostic"
+)
+
+// ProviderInstallMethod is one of the methods used to install providers into the cache. Exactly one of Direct,
+// LocalMirrorDir and NetworkMirrorURL must be set.
+type ProviderInstallMethod struct {
+	Direct           bool     // Direct installs providers from their origin registries.
+	LocalMirrorDir   string   // LocalMirrorDir installs providers from a local filesystem mirror.
+	NetworkMirrorURL string   // NetworkMirrorURL installs providers from a network mirror.
+	Include          []string // Include limits the method to the providers matching these source address patterns.
+	Exclude          []string // Exclude excludes the providers matching these source address patterns from the method.
+}
+
+// ProviderCacheBuildRequest represents the request parameters for building a provider plugin cache from dependency
+// locks. The dependency locks must be opened by the caller.
+type ProviderCacheBuildRequest struct {
+	CacheDir              string                          // CacheDir is the directory to build the provider cache in.
+	DependencyLocksHandle int64                           // DependencyLocksHandle is the handle of the dependency locks selecting the provider versions.
+	InstallMethods        []ProviderInstallMethod         // InstallMethods are the methods used to install the providers, defaults to direct installation.
+	OverridePlatform      string                          // OverridePlatform is an optional platform to install the providers for, such as linux_amd64.
+	Progress              func(event *ProviderCacheEvent) // Progress is an optional callback receiving every event of the build.
+}
+
+// ProviderCacheEvent is an event reported while building a provider cache.
+type ProviderCacheEvent struct {
+	Kind            ProviderCacheEventKind
+	Provider        string                                                               // Provider is the source address of the provider the event is about, or the comma separated expected providers of a pending event.
+	Version         string                                                               // Version is the provider version, or the version constraints of a query_begin event.
+	Location        string                                                               // Location is where a fetch_begin event fetches the package from.
+	AuthResult      dependencies.BuildProviderPluginCache_Event_FetchComplete_AuthResult // AuthResult is how a fetch_complete event authenticated the package.
+	KeyIDForDisplay string                                                               // KeyIDForDisplay identifies the signing key of a fetch_complete event, for display only.
+	Warnings        []string                                                             // Warnings are the warnings of a query_warnings event.
+	Diagnostic      *terraform1.Diagnostic                                               // Diagnostic is the diagnostic of a diagnostic event.
+}
+
+// ProviderCacheBuildResult is the outcome of building and opening a provider cache.
+type ProviderCacheBuildResult struct {
+	ProviderCacheHandle int64                    // ProviderCacheHandle is the handle of the opened provider cache.
+	Close               func() error             // Close closes the opened provider cache.
+	Diagnostics         []*terraform1.Diagnostic // Diagnostics are the diagnostics emitted while building the cache.
+	Fetched             []*ProviderCacheEvent    // Fetched are the fetch_complete events of the packages that were installed.
+}
+
+// BuildProviderCache installs the providers selected by the dependency locks into a provider plugin cache, in the
+// same way terraform init populates .terraform/providers, and opens the resulting cache. Every event of the build
+// is reported to the progress callback. The cache is not opened if the build emits error diagnostics.
+func (tf *tfStateOperations) BuildProviderCache(request ProviderCacheBuildRequest) (*ProviderCacheBuildResult, error) {
+	if request.CacheDir == "" {
+		return nil, fmt.Errorf("the provider cache directory must be set")
+	}
+
+	methods := request.InstallMethods
+	if len(methods) == 0 {
+		methods = []ProviderInstallMethod{{Direct: true}}
+	}
+	var installMethods []*dependencies.BuildProviderPluginCache_Request_InstallMethod
+	for i, method := range methods {
+		installMethod, err := method.toProto()
+		if err != nil {
+			return nil, fmt.Errorf("invalid install method %d: %w", i, err)
+		}
+		installMethods = append(installMethods, installMethod)
+	}
+
+	events, err := tf.client.Dependencies().BuildProviderPluginCache(tf.ctx, &dependencies.BuildProviderPluginCache_Request{
+		CacheDir:              request.CacheDir,
+		DependencyLocksHandle: request.DependencyLocksHandle,
+		InstallationMethods:   installMethods,
+		OverridePlatform:      request.OverridePlatform,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build provider cache: %w", err)
+	}
+
+	result := &ProviderCacheBuildResult{ProviderCacheHandle: -1}
+	var errs []string
+	for {
+		item, err := events.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to receive provider cache events: %w", err)
+		}
+
+		event := providerCacheEvent(item)
+		if event == nil {
+			continue
+		}
+		switch event.Kind {
+		case ProviderCacheEventDiagnostic:
+			result.Diagnostics = append(result.Diagnostics, event.Diagnostic)
+			if event.Diagnostic.Severity == terraform1.Diagnostic_ERROR {
+				errs = append(errs, event.Diagnostic.Summary)
+			}
+		case ProviderCacheEventFetchComplete:
+			result.Fetched = append(result.Fetched, event)
+		}
+		if request.Progress != nil {
+			request.Progress(event)
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("failed to build provider cache: %s", strings.Join(errs, "; "))
+	}
+
+	response, err := tf.client.Dependencies().OpenProviderPluginCache(tf.ctx, &dependencies.OpenProviderPluginCache_Request{
+		CacheDir:         request.CacheDir,
+		OverridePlatform: request.OverridePlatform,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to open provider cache %s: %w", request.CacheDir, err)
+	}
+	result.ProviderCacheHandle = response.ProviderCacheHandle
+	result.Close = func() error {
+		_, err := tf.client.Dependencies().CloseProviderPluginCache(context.Background(),
+			&dependencies.CloseProviderPluginCache_Request{
+				ProviderCacheHandle: response.ProviderCacheHandle,
+			})
+		return err
+	}
+
+	return result, nil
+}
+
+// toProto converts the install method into its RPC form.
+func (m ProviderInstallMethod) toProto() (*dependencies.BuildProviderPluginCache_Request_InstallMethod, error) {
+	installMethod := &dependencies.BuildProviderPluginCache_Request_InstallMethod{
+		Include: m.Include,
+		Exclude: m.Exclude,
+	}
+
+	sources := 0
+	if m.Direct {
+		installMethod.Source = &dependencies.BuildProviderPluginCache_Request_InstallMethod_Direct{Direct: true}
+		sources++
+	}
+	if m.LocalMirrorDir != "" {
+		installMethod.Source = &dependencies.BuildProviderPluginCache_Request_InstallMethod_LocalMirrorDir{LocalMirrorDir: m.LocalMirrorDir}
+		sources++
+	}
+	if m.NetworkMirrorURL != "" {
+		installMethod.Source = &dependencies.BuildProviderPluginCache_Request_InstallMethod_NetworkMirrorUrl{NetworkMirrorUrl: m.NetworkMirrorURL}
+		sources++
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of direct, local mirror directory and network mirror URL must be set")
+	}
+
+	return installMethod, nil
+}
+
+// providerCacheEvent converts an event of the provider cache build, it returns nil for unknown events.
+func providerCacheEvent(item *dependencies.BuildProviderPluginCache_Event) *ProviderCacheEvent {
+	switch e := item.Event.(type) {
+	case *dependencies.BuildProviderPluginCache_Event_Pending_:
+		var expected []string
+		for _, constraints := range e.Pending.Expected {
+			expected = append(expected, constraints.SourceAddr)
+		}
+		return &ProviderCacheEvent{Kind: ProviderCacheEventPending, Provider: strings.Join(expected, ", ")}
+	case *dependencies.BuildProviderPluginCache_Event_AlreadyInstalled:
+		return &ProviderCacheEvent{Kind: ProviderCacheEventAlreadyInstalled, Provider: e.AlreadyInstalled.SourceAddr, Version: e.AlreadyInstalled.Version}
+	case *dependencies.BuildProviderPluginCache_Event_BuiltIn:
+		return &ProviderCacheEvent{Kind: ProviderCacheEventBuiltIn, Provider: e.BuiltIn.SourceAddr, Version: e.BuiltIn.Version}
+	case *dependencies.BuildProviderPluginCache_Event_QueryBegin:
+		return &ProviderCacheEvent{Kind: ProviderCacheEventQueryBegin, Provider: e.QueryBegin.SourceAddr, Version: e.QueryBegin.Versions}
+	case *dependencies.BuildProviderPluginCache_Event_QuerySuccess:
+		return &ProviderCacheEvent{Kind: ProviderCacheEventQuerySuccess, Provider: e.QuerySuccess.SourceAddr, Version: e.QuerySuccess.Version}
+	case *dependencies.BuildProviderPluginCache_Event_QueryWarnings:
+		return &ProviderCacheEvent{Kind: ProviderCacheEventQueryWarnings, Provider: e.QueryWarnings.SourceAddr, Warnings: e.QueryWarnings.Warnings}
+	case *dependencies.BuildProviderPluginCache_Event_FetchBegin_:
+		return &ProviderCacheEvent{
+			Kind:     ProviderCacheEventFetchBegin,
+			Provider: e.FetchBegin.GetProviderVersion().GetSourceAddr(),
+			Version:  e.FetchBegin.GetProviderVersion().GetVersion(),
+			Location: e.FetchBegin.Location,
+		}
+	case *dependencies.BuildProviderPluginCache_Event_FetchComplete_:
+		return &ProviderCacheEvent{
+			Kind:            ProviderCacheEventFetchComplete,
+			Provider:        e.FetchComplete.GetProviderVersion().GetSourceAddr(),
+			Version:         e.FetchComplete.GetProviderVersion().GetVersion(),
+			AuthResult:      e.FetchComplete.AuthResult,
+			KeyIDForDisplay: e.FetchComplete.KeyIdForDisplay,
+		}
+	case *dependencies.BuildProviderPluginCache_Event_Diagnostic:
+		return &ProviderCacheEvent{Kind: ProviderCacheEventDiagnostic, Diagnostic: e.Diagnostic}
+	default:
+		return nil
+	}
+}
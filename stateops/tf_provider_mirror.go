@@ -0,0 +1,194 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/packages"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	providerPlatformExpression = `^[a-z0-9]+_[a-z0-9]+$`
+)
+
+// ProviderMirrorRequest represents the request parameters for mirroring the providers selected by a dependency
+// lock file, so they can be installed on machines without access to the provider registries.
+type ProviderMirrorRequest struct {
+	LockFilePath string   // LockFilePath is the path to the dependency lock file selecting the provider versions.
+	Platforms    []string // Platforms are the platforms to mirror each provider for, such as linux_amd64.
+	MirrorDir    string   // MirrorDir is the directory to write the mirror to, laid out as a Terraform filesystem mirror.
+}
+
+// ProviderMirrorPlatformResult is the outcome of mirroring one provider for one platform.
+type ProviderMirrorPlatformResult struct {
+	Platform    string
+	Hashes      []string                 // Hashes are the hashes of the fetched package.
+	Verified    bool                     // Verified reports whether the package matches one of the hashes of the lock file.
+	Diagnostics []*terraform1.Diagnostic // Diagnostics are the diagnostics of fetching and verifying the package.
+}
+
+// ProviderMirrorResult is the outcome of mirroring one provider for all platforms.
+type ProviderMirrorResult struct {
+	Source      string
+	Version     string
+	Platforms   []*ProviderMirrorPlatformResult
+	Diagnostics []*terraform1.Diagnostic // Diagnostics are the diagnostics that concern the provider on every platform.
+}
+
+// ProviderMirrorReport is the report of mirroring the providers of a dependency lock file.
+type ProviderMirrorReport struct {
+	MirrorDir string
+	Providers []*ProviderMirrorResult
+}
+
+// HasErrors reports whether any provider could not be mirrored or verified for any platform.
+func (r *ProviderMirrorReport) HasErrors() bool {
+	for _, provider := range r.Providers {
+		if hasErrorDiagnostics(provider.Diagnostics) {
+			return true
+		}
+		for _, platform := range provider.Platforms {
+			if hasErrorDiagnostics(platform.Diagnostics) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MirrorProviders fetches every provider version selected by the lock file for every platform into a directory
+// laid out as a Terraform filesystem mirror, which can be used as the local_mirror_dir install method when building
+// a provider cache. The locked version must still be offered by the registry, and each fetched package is verified
+// against the hashes of the lock file. A provider or platform that fails does not stop the others, its diagnostics
+// are recorded in the report instead.
+func (tf *tfStateOperations) MirrorProviders(request ProviderMirrorRequest) (*ProviderMirrorReport, error) {
+	if request.MirrorDir == "" {
+		return nil, fmt.Errorf("the mirror directory must be set")
+	}
+	if len(request.Platforms) == 0 {
+		return nil, fmt.Errorf("at least one platform must be set")
+	}
+	platformRegex := regexp.MustCompile(providerPlatformExpression)
+	for _, platform := range request.Platforms {
+		if !platformRegex.MatchString(platform) {
+			return nil, fmt.Errorf("invalid platform %q, expected the form os_arch such as linux_amd64", platform)
+		}
+	}
+
+	locked, err := tfconfigutil.LoadDependencyLockFile(hclparse.NewParser(), request.LockFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(request.MirrorDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", request.MirrorDir, err)
+	}
+
+	report := &ProviderMirrorReport{MirrorDir: request.MirrorDir}
+	for _, source := range tfconfigutil.SortedKeys(locked) {
+		report.Providers = append(report.Providers, tf.mirrorProvider(locked[source], request))
+	}
+
+	return report, nil
+}
+
+// mirrorProvider fetches a single locked provider for all the requested platforms.
+func (tf *tfStateOperations) mirrorProvider(provider *tfconfigutil.LockedProvider, request ProviderMirrorRequest) *ProviderMirrorResult {
+	result := &ProviderMirrorResult{Source: provider.Source, Version: provider.Version}
+
+	versions, err := tf.client.Packages().ProviderPackageVersions(tf.ctx, &packages.ProviderPackageVersions_Request{
+		SourceAddr: provider.Source,
+	})
+	if err != nil {
+		result.Diagnostics = append(result.Diagnostics, errorDiagnostic("Failed to list provider versions", err.Error()))
+		return result
+	}
+	result.Diagnostics = append(result.Diagnostics, versions.Diagnostics...)
+	if hasErrorDiagnostics(versions.Diagnostics) {
+		return result
+	}
+	if !slices.Contains(versions.Versions, provider.Version) {
+		result.Diagnostics = append(result.Diagnostics, errorDiagnostic("Locked provider version is not available",
+			fmt.Sprintf("The registry does not offer version %s of provider %s selected by %s.", provider.Version, provider.Source, request.LockFilePath)))
+		return result
+	}
+
+	response, err := tf.client.Packages().FetchProviderPackage(tf.ctx, &packages.FetchProviderPackage_Request{
+		CacheDir:   request.MirrorDir,
+		SourceAddr: provider.Source,
+		Version:    provider.Version,
+		Platforms:  request.Platforms,
+		Hashes:     provider.Hashes,
+	})
+	if err != nil {
+		result.Diagnostics = append(result.Diagnostics, errorDiagnostic("Failed to fetch provider package", err.Error()))
+		return result
+	}
+	result.Diagnostics = append(result.Diagnostics, response.Diagnostics...)
+
+	for i, platform := range request.Platforms {
+		platformResult := &ProviderMirrorPlatformResult{Platform: platform}
+		result.Platforms = append(result.Platforms, platformResult)
+		if i >= len(response.Results) {
+			platformResult.Diagnostics = append(platformResult.Diagnostics, errorDiagnostic("Missing provider package result",
+				fmt.Sprintf("No result was returned for provider %s on platform %s.", provider.Source, platform)))
+			continue
+		}
+
+		fetched := response.Results[i]
+		platformResult.Diagnostics = append(platformResult.Diagnostics, fetched.Diagnostics...)
+		if hasErrorDiagnostics(fetched.Diagnostics) || fetched.GetProvider() == nil {
+			continue
+		}
+		platformResult.Hashes = fetched.GetProvider().GetHashes()
+		platformResult.Verified = verifyProviderHashes(provider.Hashes, platformResult.Hashes)
+
+		switch {
+		case len(provider.Hashes) == 0:
+			platformResult.Diagnostics = append(platformResult.Diagnostics, warningDiagnostic("Provider package not verified",
+				fmt.Sprintf("The lock file records no hashes for provider %s, the package for %s was mirrored without verification.", provider.Source, platform)))
+		case !platformResult.Verified:
+			platformResult.Diagnostics = append(platformResult.Diagnostics, errorDiagnostic("Provider package does not match the lock file",
+				fmt.Sprintf("The package of provider %s %s for %s matches none of the hashes in %s.", provider.Source, provider.Version, platform, request.LockFilePath)))
+		}
+	}
+
+	return result
+}
+
+// verifyProviderHashes reports whether any hash of the fetched package is one of the locked hashes.
+func verifyProviderHashes(locked []string, fetched []string) bool {
+	for _, hash := range fetched {
+		if slices.Contains(locked, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasErrorDiagnostics reports whether any of the diagnostics is an error.
+func hasErrorDiagnostics(diagnostics []*terraform1.Diagnostic) bool {
+	for _, diag := range diagnostics {
+		if diag.Severity == terraform1.Diagnostic_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// errorDiagnostic returns an error diagnostic raised by the migration utility itself.
+func errorDiagnostic(summary string, detail string) *terraform1.Diagnostic {
+	return &terraform1.Diagnostic{Severity: terraform1.Diagnostic_ERROR, Summary: summary, Detail: detail}
+}
+
+// warningDiagnostic returns a warning diagnostic raised by the migration utility itself.
+func warningDiagnostic(summary string, detail string) *terraform1.Diagnostic {
+	return &terraform1.Diagnostic{Severity: terraform1.Diagnostic_WARNING, Summary: summary, Detail: detail}
+}
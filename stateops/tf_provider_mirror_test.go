@@ -0,0 +1,168 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/packages"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	mirrorTestSource = "registry.terraform.io/hashicorp/random"
+	mirrorTestHash   = "h1:locked="
+)
+
+// stubRpcClient serves the Packages client of a test, every other client is left unset.
+type stubRpcClient struct {
+	rpcapi.Client
+	packages *stubPackagesClient
+}
+
+func (c *stubRpcClient) Packages() packages.PackagesClient {
+	return c.packages
+}
+
+// stubPackagesClient answers provider package requests from fixed versions and per platform hashes.
+type stubPackagesClient struct {
+	packages.PackagesClient
+	versions []string
+	hashes   map[string][]string // hashes maps each platform the registry returns a result for to the hashes of its package.
+	fetched  *packages.FetchProviderPackage_Request
+}
+
+func (c *stubPackagesClient) ProviderPackageVersions(_ context.Context, _ *packages.ProviderPackageVersions_Request, _ ...grpc.CallOption) (*packages.ProviderPackageVersions_Response, error) {
+	return &packages.ProviderPackageVersions_Response{Versions: c.versions}, nil
+}
+
+func (c *stubPackagesClient) FetchProviderPackage(_ context.Context, request *packages.FetchProviderPackage_Request, _ ...grpc.CallOption) (*packages.FetchProviderPackage_Response, error) {
+	c.fetched = request
+	response := &packages.FetchProviderPackage_Response{}
+	for _, platform := range request.Platforms {
+		hashes, ok := c.hashes[platform]
+		if !ok {
+			break
+		}
+		response.Results = append(response.Results, &packages.FetchProviderPackage_PlatformResult{
+			Provider: &terraform1.ProviderPackage{SourceAddr: request.SourceAddr, Version: request.Version, Hashes: hashes},
+		})
+	}
+	return response, nil
+}
+
+func mirrorProvidersWithStub(t *testing.T, stub *stubPackagesClient, platforms ...string) *ProviderMirrorReport {
+	t.Helper()
+
+	dir := t.TempDir()
+	lockFilePath := filepath.Join(dir, tfconfigutil.DependencyLockFileName)
+	err := tfconfigutil.WriteDependencyLockFile(lockFilePath, []*tfconfigutil.LockedProvider{{
+		Source:  mirrorTestSource,
+		Version: "3.6.0",
+		Hashes:  []string{mirrorTestHash},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := NewTFStateOperations(context.Background(), &stubRpcClient{packages: stub})
+	report, err := ops.MirrorProviders(ProviderMirrorRequest{
+		LockFilePath: lockFilePath,
+		Platforms:    platforms,
+		MirrorDir:    filepath.Join(dir, "mirror"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Providers) != 1 {
+		t.Fatalf("expected one provider, got %d", len(report.Providers))
+	}
+	return report
+}
+
+func hasDiagnostic(diagnostics []*terraform1.Diagnostic, summary string) bool {
+	for _, diag := range diagnostics {
+		if diag.Summary == summary {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMirrorProviders_Verified(t *testing.T) {
+	stub := &stubPackagesClient{
+		versions: []string{"3.5.1", "3.6.0"},
+		hashes:   map[string][]string{"linux_amd64": {"zh:other=", mirrorTestHash}},
+	}
+	report := mirrorProvidersWithStub(t, stub, "linux_amd64")
+
+	if report.HasErrors() {
+		t.Fatalf("unexpected errors: %+v", report.Providers[0])
+	}
+	platforms := report.Providers[0].Platforms
+	if len(platforms) != 1 || !platforms[0].Verified {
+		t.Fatalf("expected a verified package, got %+v", platforms)
+	}
+	if stub.fetched.Version != "3.6.0" || stub.fetched.CacheDir != report.MirrorDir || len(stub.fetched.Hashes) != 1 {
+		t.Errorf("unexpected fetch request %v", stub.fetched)
+	}
+}
+
+func TestMirrorProviders_HashMismatch(t *testing.T) {
+	stub := &stubPackagesClient{
+		versions: []string{"3.6.0"},
+		hashes:   map[string][]string{"linux_amd64": {"h1:tampered="}},
+	}
+	report := mirrorProvidersWithStub(t, stub, "linux_amd64")
+
+	if !report.HasErrors() {
+		t.Fatal("expected the hash mismatch to be an error")
+	}
+	platform := report.Providers[0].Platforms[0]
+	if platform.Verified || !hasDiagnostic(platform.Diagnostics, "Provider package does not match the lock file") {
+		t.Errorf("expected an unverified package with a mismatch diagnostic, got %+v", platform)
+	}
+}
+
+func TestMirrorProviders_MissingPlatformResult(t *testing.T) {
+	stub := &stubPackagesClient{
+		versions: []string{"3.6.0"},
+		hashes:   map[string][]string{"linux_amd64": {mirrorTestHash}},
+	}
+	report := mirrorProvidersWithStub(t, stub, "linux_amd64", "darwin_arm64")
+
+	if !report.HasErrors() {
+		t.Fatal("expected the missing platform result to be an error")
+	}
+	platforms := report.Providers[0].Platforms
+	if len(platforms) != 2 {
+		t.Fatalf("expected a result per platform, got %d", len(platforms))
+	}
+	if !platforms[0].Verified || len(platforms[0].Diagnostics) > 0 {
+		t.Errorf("expected linux_amd64 to be verified, got %+v", platforms[0])
+	}
+	if platforms[1].Verified || !hasDiagnostic(platforms[1].Diagnostics, "Missing provider package result") {
+		t.Errorf("expected darwin_arm64 to be reported missing, got %+v", platforms[1])
+	}
+}
+
+func TestMirrorProviders_MissingVersion(t *testing.T) {
+	stub := &stubPackagesClient{
+		versions: []string{"3.5.1"},
+	}
+	report := mirrorProvidersWithStub(t, stub, "linux_amd64")
+
+	provider := report.Providers[0]
+	if !hasDiagnostic(provider.Diagnostics, "Locked provider version is not available") {
+		t.Errorf("expected the missing version to be reported, got %+v", provider.Diagnostics)
+	}
+	if len(provider.Platforms) > 0 || stub.fetched != nil {
+		t.Errorf("expected nothing to be fetched, got %+v", provider.Platforms)
+	}
+}
@@ -0,0 +1,619 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/packages"
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	sourceBundleManifestFileName = `terraform-sources.json`
+	sourceBundleFormatVersion    = 1
+	defaultStackSourceAddr       = `git::https://stacks.invalid/stack.git`
+	stackConfigFileExt           = `.tfcomponent.hcl`
+	defaultModuleRegistryHost    = `registry.terraform.io`
+	registrySourceExpression     = `^(?:([0-9A-Za-z.-]+\.[0-9A-Za-z-]+)/)?([0-9A-Za-z_-]+)/([0-9A-Za-z_-]+)/([0-9a-z]+)$`
+	githubShorthandPrefix        = `github.com/`
+)
+
+// SourceBundleRequest represents the request parameters for packing a stack configuration and all the modules it
+// uses into a source bundle, so it can be opened without initialising it first.
+type SourceBundleRequest struct {
+	StackConfigDir  string // StackConfigDir is the directory containing the stack configuration files.
+	BundleDir       string // BundleDir is the directory to write the source bundle to, it must be empty or not exist.
+	StackSourceAddr string // StackSourceAddr is the remote source address the stack configuration is packed under, defaults to a placeholder address.
+}
+
+// SourceBundleModule describes a module source that was resolved into the bundle.
+type SourceBundleModule struct {
+	Source   string // Source is the source address as written in the configuration.
+	Version  string // Version is the version selected for a registry module.
+	Package  string // Package is the remote package the source was fetched from.
+	LocalDir string // LocalDir is the directory of the package within the bundle.
+}
+
+// SourceBundleResult is the outcome of building a source bundle.
+type SourceBundleResult struct {
+	BundleDir       string
+	StackSourceAddr string                // StackSourceAddr is the source address to open the stack configuration with, using OpenStacksConfiguration.
+	Modules         []*SourceBundleModule // Modules are the remote and registry module sources resolved into the bundle.
+}
+
+// sourceBundleManifest is the terraform-sources.json manifest of a source bundle.
+type sourceBundleManifest struct {
+	FormatVersion int                          `json:"terraform_source_bundle"`
+	Packages      []*sourceBundlePackage       `json:"packages,omitempty"`
+	Registry      []*sourceBundleRegistryEntry `json:"registry,omitempty"`
+}
+
+// sourceBundlePackage is a remote package of a source bundle manifest.
+type sourceBundlePackage struct {
+	Source string `json:"source"`
+	Local  string `json:"local"`
+}
+
+// sourceBundleRegistryEntry records the versions of a registry module a source bundle holds.
+type sourceBundleRegistryEntry struct {
+	Source   string                                  `json:"source"`
+	Versions map[string]*sourceBundleRegistryVersion `json:"versions"`
+}
+
+// sourceBundleRegistryVersion records the remote package a registry module version resolved to.
+type sourceBundleRegistryVersion struct {
+	Source string `json:"source"`
+}
+
+// sourceBundler holds the state of a source bundle while it is being built.
+type sourceBundler struct {
+	tf        *tfStateOperations
+	parser    *hclparse.Parser
+	bundleDir string
+	packages  map[string]string              // packages maps each remote package to its directory within the bundle.
+	registry  map[string]map[string]string   // registry maps each registry module and version to its remote source.
+	modules   map[string]*SourceBundleModule // modules maps each resolved source and version to its description.
+	visited   map[string]bool                // visited records the module directories that were already walked.
+	versions  map[string][]string            // versions caches the available versions of each registry module.
+}
+
+// BuildSourceBundle packs a stack configuration into a source bundle with a terraform-sources.json manifest. The
+// stack configuration directory is packed as a package of its own, together with the directories its local
+// component, stack and module sources refer to, so they are included as they are. The package holds the closest
+// directory that contains all of them and the returned source address points at the stack configuration within. Registry module sources are resolved to the newest version that satisfies their version constraints
+// and fetched with every remote source, recursing into the module calls of the fetched modules, so the bundle holds
+// everything the stack configuration needs. Local sources must stay within the package they are declared in.
+func (tf *tfStateOperations) BuildSourceBundle(request SourceBundleRequest) (*SourceBundleResult, error) {
+	if request.StackConfigDir == "" || request.BundleDir == "" {
+		return nil, fmt.Errorf("the stack configuration and bundle directories must be set")
+	}
+	if entries, err := os.ReadDir(request.BundleDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("the bundle directory %s is not empty", request.BundleDir)
+	}
+	if err := os.MkdirAll(request.BundleDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", request.BundleDir, err)
+	}
+
+	stackSourceAddr := request.StackSourceAddr
+	if stackSourceAddr == "" {
+		stackSourceAddr = defaultStackSourceAddr
+	}
+	stackPackage, stackSubdir := splitPackageSubdir(stackSourceAddr)
+
+	b := &sourceBundler{
+		tf:        tf,
+		parser:    hclparse.NewParser(),
+		bundleDir: request.BundleDir,
+		packages:  make(map[string]string),
+		registry:  make(map[string]map[string]string),
+		modules:   make(map[string]*SourceBundleModule),
+		visited:   make(map[string]bool),
+		versions:  make(map[string][]string),
+	}
+
+	// local sources may refer to directories next to the stack configuration, so the package holds the closest
+	// directory that contains all of them
+	configDir, err := filepath.Abs(request.StackConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory %s: %w", request.StackConfigDir, err)
+	}
+	localRoot, err := b.localPackageRoot(configDir, configDir, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	configSubdir, err := filepath.Rel(localRoot, configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory %s: %w", request.StackConfigDir, err)
+	}
+
+	stackLocal := packageLocalDir(stackPackage)
+	b.packages[stackPackage] = stackLocal
+	packageRoot := filepath.Join(request.BundleDir, stackLocal)
+	copyRoot := filepath.Join(packageRoot, filepath.FromSlash(stackSubdir))
+	bundleDir, err := filepath.Abs(request.BundleDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory %s: %w", request.BundleDir, err)
+	}
+	if err := copyDir(localRoot, copyRoot, bundleDir); err != nil {
+		return nil, err
+	}
+	stackDir := filepath.Join(copyRoot, configSubdir)
+	if configSubdir != "." {
+		stackSourceAddr = joinPackageSubdir(stackPackage, strings.Trim(stackSubdir+"/"+filepath.ToSlash(configSubdir), "/"))
+	}
+
+	if err := b.walkStack(stackDir, packageRoot); err != nil {
+		return nil, err
+	}
+	if err := b.writeManifest(); err != nil {
+		return nil, err
+	}
+
+	result := &SourceBundleResult{BundleDir: request.BundleDir, StackSourceAddr: stackSourceAddr}
+	for _, key := range tfconfigutil.SortedKeys(b.modules) {
+		result.Modules = append(result.Modules, b.modules[key])
+	}
+	return result, nil
+}
+
+// walkStack resolves the sources of the components and embedded stacks of the stack in the given directory.
+func (b *sourceBundler) walkStack(dir string, packageRoot string) error {
+	if b.visited[dir] {
+		return nil
+	}
+	b.visited[dir] = true
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+stackConfigFileExt))
+	if err != nil {
+		return fmt.Errorf("error while fetching stack files from path %s, err: %w", dir, err)
+	}
+
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "component", LabelNames: []string{"name"}},
+			{Type: "stack", LabelNames: []string{"name"}},
+		},
+	}
+	sourceSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "source"}, {Name: "version"}},
+	}
+
+	for _, filePath := range files {
+		file, diags := b.parser.ParseHCLFile(filePath)
+		if diags.HasErrors() {
+			return fmt.Errorf("failed to parse HCL file %s, err: %v", filePath, diags.Error())
+		}
+		content, _, diags := file.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		for _, block := range content.Blocks {
+			attrs, _, _ := block.Body.PartialContent(sourceSchema)
+			source, version := "", ""
+			if attr, ok := attrs.Attributes["source"]; ok {
+				source = literalString(attr.Expr)
+			}
+			if attr, ok := attrs.Attributes["version"]; ok {
+				version = literalString(attr.Expr)
+			}
+			if source == "" {
+				return fmt.Errorf("the %s %s in %s must have a literal source", block.Type, block.Labels[0], filePath)
+			}
+
+			sourceDir, sourceRoot, err := b.resolve(source, version, dir, packageRoot)
+			if err != nil {
+				return fmt.Errorf("failed to resolve the source of %s %s: %w", block.Type, block.Labels[0], err)
+			}
+			if block.Type == "stack" {
+				err = b.walkStack(sourceDir, sourceRoot)
+			} else {
+				err = b.walkModule(sourceDir, sourceRoot)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// localPackageRoot returns the closest directory that contains the given directory and every directory reachable
+// from it through local sources, following the local sources of stacks and modules before the bundle is built.
+func (b *sourceBundler) localPackageRoot(dir string, root string, visited map[string]bool) (string, error) {
+	if visited[dir] {
+		return root, nil
+	}
+	visited[dir] = true
+	root = commonDir(root, dir)
+
+	sources, err := b.localSources(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, source := range sources {
+		if root, err = b.localPackageRoot(filepath.Join(dir, filepath.FromSlash(source)), root, visited); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
+
+// localSources returns the local sources of the components and embedded stacks of the stack configuration files
+// in the given directory, or of the module calls of the module in it if there are none.
+func (b *sourceBundler) localSources(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+stackConfigFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching stack files from path %s, err: %w", dir, err)
+	}
+
+	var sources []string
+	if len(files) == 0 {
+		module, err := tfconfigutil.LoadModule(b.parser, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range tfconfigutil.SortedKeys(module.ModuleCalls) {
+			if source := module.ModuleCalls[name].Source; tfconfigutil.IsLocalModuleSource(source) {
+				sources = append(sources, source)
+			}
+		}
+		return sources, nil
+	}
+
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "component", LabelNames: []string{"name"}},
+			{Type: "stack", LabelNames: []string{"name"}},
+		},
+	}
+	sourceSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "source"}},
+	}
+	for _, filePath := range files {
+		file, diags := b.parser.ParseHCLFile(filePath)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse HCL file %s, err: %v", filePath, diags.Error())
+		}
+		content, _, diags := file.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range content.Blocks {
+			attrs, _, _ := block.Body.PartialContent(sourceSchema)
+			if attr, ok := attrs.Attributes["source"]; ok {
+				if source := literalString(attr.Expr); tfconfigutil.IsLocalModuleSource(source) {
+					sources = append(sources, source)
+				}
+			}
+		}
+	}
+	return sources, nil
+}
+
+// walkModule resolves the sources of the module calls of the module in the given directory.
+func (b *sourceBundler) walkModule(dir string, packageRoot string) error {
+	if b.visited[dir] {
+		return nil
+	}
+	b.visited[dir] = true
+
+	module, err := tfconfigutil.LoadModule(b.parser, dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range tfconfigutil.SortedKeys(module.ModuleCalls) {
+		moduleCall := module.ModuleCalls[name]
+		childDir, childRoot, err := b.resolve(moduleCall.Source, moduleCall.Version, dir, packageRoot)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the source of module %s in %s: %w", name, dir, err)
+		}
+		if err := b.walkModule(childDir, childRoot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the directory within the bundle a source address refers to and the root of the package that
+// holds it, fetching the package if the source is remote.
+func (b *sourceBundler) resolve(source string, version string, dir string, packageRoot string) (string, string, error) {
+	if tfconfigutil.IsLocalModuleSource(source) {
+		resolved := filepath.Join(dir, filepath.FromSlash(source))
+		if rel, err := filepath.Rel(packageRoot, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", "", fmt.Errorf("the local source %s leaves the package it is declared in", source)
+		}
+		return resolved, packageRoot, nil
+	}
+
+	addr, subdir := splitPackageSubdir(source)
+	if registryAddr, ok := normalizeRegistrySource(addr); ok {
+		remote, err := b.resolveRegistry(source, registryAddr, version)
+		if err != nil {
+			return "", "", err
+		}
+		remotePackage, remoteSubdir := splitPackageSubdir(remote)
+		local, err := b.fetch(remotePackage)
+		if err != nil {
+			return "", "", err
+		}
+		root := filepath.Join(b.bundleDir, local)
+		return filepath.Join(root, filepath.FromSlash(remoteSubdir), filepath.FromSlash(subdir)), root, nil
+	}
+
+	if version != "" {
+		return "", "", fmt.Errorf("the source %s is not a registry module and cannot have a version constraint", source)
+	}
+	if strings.HasPrefix(addr, githubShorthandPrefix) {
+		addr = "git::https://" + strings.TrimSuffix(addr, ".git") + ".git"
+	}
+	local, err := b.fetch(addr)
+	if err != nil {
+		return "", "", err
+	}
+	b.modules[source] = &SourceBundleModule{Source: source, Package: addr, LocalDir: local}
+	root := filepath.Join(b.bundleDir, local)
+	return filepath.Join(root, filepath.FromSlash(subdir)), root, nil
+}
+
+// resolveRegistry selects the newest version of a registry module that satisfies the constraints and returns the
+// remote source address it is published at.
+func (b *sourceBundler) resolveRegistry(source string, registryAddr string, constraint string) (string, error) {
+	constraints, err := tfconfigutil.ParseVersionConstraints(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint for module %s: %w", source, err)
+	}
+
+	if _, ok := b.versions[registryAddr]; !ok {
+		response, err := b.tf.client.Packages().ModulePackageVersions(b.tf.ctx, &packages.ModulePackageVersions_Request{
+			SourceAddr: registryAddr,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list versions of module %s: %w", registryAddr, err)
+		}
+		if hasErrorDiagnostics(response.Diagnostics) {
+			return "", fmt.Errorf("failed to list versions of module %s: %s", registryAddr, diagnosticSummaries(response.Diagnostics))
+		}
+		b.versions[registryAddr] = response.Versions
+	}
+
+	version := ""
+	var selected tfconfigutil.Version
+	for _, raw := range b.versions[registryAddr] {
+		v, err := tfconfigutil.ParseVersion(raw)
+		if err != nil || !constraints.Allows(v) {
+			continue
+		}
+		if version == "" || v.Compare(selected) > 0 {
+			version, selected = raw, v
+		}
+	}
+	if version == "" {
+		return "", fmt.Errorf("no version of module %s satisfies the constraint %q", registryAddr, constraint)
+	}
+
+	if remote, ok := b.registry[registryAddr][version]; ok {
+		return remote, nil
+	}
+	response, err := b.tf.client.Packages().ModulePackageSourceAddr(b.tf.ctx, &packages.ModulePackageSourceAddr_Request{
+		SourceAddr: registryAddr,
+		Version:    version,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve module %s %s: %w", registryAddr, version, err)
+	}
+	if hasErrorDiagnostics(response.Diagnostics) {
+		return "", fmt.Errorf("failed to resolve module %s %s: %s", registryAddr, version, diagnosticSummaries(response.Diagnostics))
+	}
+
+	if b.registry[registryAddr] == nil {
+		b.registry[registryAddr] = make(map[string]string)
+	}
+	b.registry[registryAddr][version] = response.Url
+	remotePackage, _ := splitPackageSubdir(response.Url)
+	b.modules[registryAddr+"@"+version] = &SourceBundleModule{
+		Source:   source,
+		Version:  version,
+		Package:  remotePackage,
+		LocalDir: packageLocalDir(remotePackage),
+	}
+	return response.Url, nil
+}
+
+// fetch fetches a remote package into the bundle once and returns its directory within the bundle.
+func (b *sourceBundler) fetch(remotePackage string) (string, error) {
+	if local, ok := b.packages[remotePackage]; ok {
+		return local, nil
+	}
+
+	local := packageLocalDir(remotePackage)
+	response, err := b.tf.client.Packages().FetchModulePackage(b.tf.ctx, &packages.FetchModulePackage_Request{
+		CacheDir: filepath.Join(b.bundleDir, local),
+		Url:      remotePackage,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch module package %s: %w", remotePackage, err)
+	}
+	if hasErrorDiagnostics(response.Diagnostics) {
+		return "", fmt.Errorf("failed to fetch module package %s: %s", remotePackage, diagnosticSummaries(response.Diagnostics))
+	}
+
+	b.packages[remotePackage] = local
+	return local, nil
+}
+
+// writeManifest writes the terraform-sources.json manifest of the bundle.
+func (b *sourceBundler) writeManifest() error {
+	manifest := &sourceBundleManifest{FormatVersion: sourceBundleFormatVersion}
+	for _, source := range tfconfigutil.SortedKeys(b.packages) {
+		manifest.Packages = append(manifest.Packages, &sourceBundlePackage{Source: source, Local: b.packages[source]})
+	}
+	for _, source := range tfconfigutil.SortedKeys(b.registry) {
+		entry := &sourceBundleRegistryEntry{Source: source, Versions: make(map[string]*sourceBundleRegistryVersion)}
+		for version, remote := range b.registry[source] {
+			entry.Versions[version] = &sourceBundleRegistryVersion{Source: remote}
+		}
+		manifest.Registry = append(manifest.Registry, entry)
+	}
+
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode source bundle manifest: %w", err)
+	}
+	path := filepath.Join(b.bundleDir, sourceBundleManifestFileName)
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
+
+// splitPackageSubdir splits a remote source address into its package and the subdirectory within the package,
+// for example `git::https://example.com/repo.git?ref=v1` and `modules/vpc` for
+// `git::https://example.com/repo.git//modules/vpc?ref=v1`.
+func splitPackageSubdir(source string) (string, string) {
+	start := 0
+	if i := strings.Index(source, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(source[start:], "//")
+	if i < 0 {
+		return source, ""
+	}
+	i += start
+
+	subdir := source[i+2:]
+	query := ""
+	if q := strings.Index(subdir, "?"); q >= 0 {
+		subdir, query = subdir[:q], subdir[q:]
+	}
+	return source[:i] + query, strings.Trim(subdir, "/")
+}
+
+// commonDir returns the closest directory that contains both of the given absolute directories.
+func commonDir(a string, b string) string {
+	for {
+		if rel, err := filepath.Rel(a, b); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return a
+		}
+		parent := filepath.Dir(a)
+		if parent == a {
+			return a
+		}
+		a = parent
+	}
+}
+
+// joinPackageSubdir returns the source address of a subdirectory of a remote package, keeping the query string of
+// the package address at the end.
+func joinPackageSubdir(remotePackage string, subdir string) string {
+	if subdir == "" {
+		return remotePackage
+	}
+	addr, query, _ := strings.Cut(remotePackage, "?")
+	if query != "" {
+		query = "?" + query
+	}
+	return addr + "//" + subdir + query
+}
+
+// normalizeRegistrySource returns the fully qualified form of a module registry address, such as
+// `registry.terraform.io/hashicorp/consul/aws`, and whether the source is a registry address at all.
+func normalizeRegistrySource(source string) (string, bool) {
+	if strings.Contains(source, "::") || strings.Contains(source, "://") || strings.HasPrefix(source, githubShorthandPrefix) {
+		return "", false
+	}
+	matches := regexp.MustCompile(registrySourceExpression).FindStringSubmatch(source)
+	if matches == nil {
+		return "", false
+	}
+	host := matches[1]
+	if host == "" {
+		host = defaultModuleRegistryHost
+	}
+	return strings.ToLower(host) + "/" + matches[2] + "/" + matches[3] + "/" + matches[4], true
+}
+
+// packageLocalDir returns the directory name of a remote package within the bundle.
+func packageLocalDir(remotePackage string) string {
+	sum := sha256.Sum256([]byte(remotePackage))
+	return hex.EncodeToString(sum[:16])
+}
+
+// literalString returns the value of a literal string expression, or the empty string.
+func literalString(expr hcl.Expression) string {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || !value.Type().Equals(cty.String) {
+		return ""
+	}
+	return value.AsString()
+}
+
+// diagnosticSummaries joins the summaries of the error diagnostics.
+func diagnosticSummaries(diagnostics []*terraform1.Diagnostic) string {
+	var summaries []string
+	for _, diag := range diagnostics {
+		summaries = append(summaries, diag.Summary)
+	}
+	sort.Strings(summaries)
+	return strings.Join(summaries, "; ")
+}
+
+// copyDir copies the files of a directory recursively, skipping the .terraform and .git directories and the
+// excluded directory, so a bundle written within the copied directory is not copied into itself.
+func copyDir(src string, dst string, exclude string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && path == exclude {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			if entry.Name() == ".terraform" || entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0o755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return fmt.Errorf("failed to write file %s: %w", target, err)
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to write file %s: %w", target, err)
+		}
+		return out.Close()
+	})
+}
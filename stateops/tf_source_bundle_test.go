@@ -0,0 +1,95 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeBundleTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildSourceBundle_LocalSourcesOutsideStackDir(t *testing.T) {
+	dir := t.TempDir()
+	writeBundleTestFiles(t, dir, map[string]string{
+		"stack/components.tfcomponent.hcl": `
+component "network" {
+  source = "../modules/network"
+}
+`,
+		"modules/network/main.tf": `
+module "subnets" {
+  source = "../subnets"
+}
+`,
+		"modules/subnets/main.tf": `
+output "ids" {
+  value = []
+}
+`,
+	})
+
+	bundleDir := filepath.Join(dir, "bundle")
+	result, err := NewTFStateOperations(context.Background(), nil).BuildSourceBundle(SourceBundleRequest{
+		StackConfigDir: filepath.Join(dir, "stack"),
+		BundleDir:      bundleDir,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := defaultStackSourceAddr + "//stack"; result.StackSourceAddr != want {
+		t.Errorf("got stack source address %s, want %s", result.StackSourceAddr, want)
+	}
+	packageRoot := filepath.Join(bundleDir, packageLocalDir(defaultStackSourceAddr))
+	for _, name := range []string{"stack/components.tfcomponent.hcl", "modules/network/main.tf", "modules/subnets/main.tf"} {
+		if _, err := os.Stat(filepath.Join(packageRoot, filepath.FromSlash(name))); err != nil {
+			t.Errorf("the bundle does not hold %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(packageRoot, "bundle")); !os.IsNotExist(err) {
+		t.Errorf("the bundle was copied into itself")
+	}
+}
+
+func TestBuildSourceBundle_LocalSourcesWithinStackDir(t *testing.T) {
+	dir := t.TempDir()
+	writeBundleTestFiles(t, dir, map[string]string{
+		"components.tfcomponent.hcl": `
+component "network" {
+  source = "./modules/network"
+}
+`,
+		"modules/network/main.tf": `
+output "id" {
+  value = "network"
+}
+`,
+	})
+
+	result, err := NewTFStateOperations(context.Background(), nil).BuildSourceBundle(SourceBundleRequest{
+		StackConfigDir:  dir,
+		BundleDir:       filepath.Join(t.TempDir(), "bundle"),
+		StackSourceAddr: "git::https://example.com/stacks.git//network?ref=v1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "git::https://example.com/stacks.git//network?ref=v1"; result.StackSourceAddr != want {
+		t.Errorf("got stack source address %s, want %s", result.StackSourceAddr, want)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+)
+
+// StackComponent is a component of an opened stack configuration, found in the root stack or an embedded stack.
+type StackComponent struct {
+	Addr           string                                              // Addr is the configuration address of the component, for example `stack.net.component.vpc`.
+	SourceAddr     string                                              // SourceAddr is the source address of the component module.
+	Instances      stacks.FindStackConfigurationComponents_Instances   // Instances is how the component is instantiated.
+	StackInstances []stacks.FindStackConfigurationComponents_Instances // StackInstances is how each embedded stack on the way to the component is instantiated, outermost first.
+}
+
+// FindStackComponents lists the components of an opened stack configuration, recursing into its embedded stacks.
+// The components are sorted by address.
+func (tf *tfStateOperations) FindStackComponents(stackConfigHandle int64) ([]*StackComponent, error) {
+	response, err := tf.client.Stacks().FindStackConfigurationComponents(tf.ctx,
+		&stacks.FindStackConfigurationComponents_Request{
+			StackConfigHandle: stackConfigHandle,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stack configuration components: %w", err)
+	}
+
+	var components []*StackComponent
+	collectStackComponents(response.GetConfig(), "", nil, &components)
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Addr < components[j].Addr
+	})
+	return components, nil
+}
+
+// StackComponentAddrs returns the configuration addresses of the components, in the form expected by
+// tfstateutil.ValidateComponentTargets.
+func StackComponentAddrs(components []*StackComponent) []string {
+	addrs := make([]string, 0, len(components))
+	for _, component := range components {
+		addrs = append(addrs, component.Addr)
+	}
+	return addrs
+}
+
+// collectStackComponents appends the components of the stack configuration and its embedded stacks to the list.
+func collectStackComponents(config *stacks.FindStackConfigurationComponents_StackConfig, prefix string, stackInstances []stacks.FindStackConfigurationComponents_Instances, components *[]*StackComponent) {
+	for name, component := range config.GetComponents() {
+		*components = append(*components, &StackComponent{
+			Addr:           prefix + "component." + name,
+			SourceAddr:     component.GetSourceAddr(),
+			Instances:      component.GetInstances(),
+			StackInstances: stackInstances,
+		})
+	}
+	for name, stack := range config.GetEmbeddedStacks() {
+		instances := append(append([]stacks.FindStackConfigurationComponents_Instances{}, stackInstances...), stack.GetInstances())
+		collectStackComponents(stack.GetConfig(), prefix+"stack."+name+".", instances, components)
+	}
+}
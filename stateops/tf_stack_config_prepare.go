@@ -0,0 +1,124 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/dependencies"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+)
+
+const (
+	stackConfigFormatVersion = 1
+)
+
+// StackConfigPrepareRequest represents the request parameters for capturing the providers of a stack configuration
+// and their schemas. The dependency locks and the provider cache must be opened by the caller, and the cache must
+// hold every locked provider.
+type StackConfigPrepareRequest struct {
+	DependencyLocksHandle int64  // DependencyLocksHandle is the handle of the dependency locks selecting the providers.
+	ProviderCacheHandle   int64  // ProviderCacheHandle is the handle of the provider cache the schemas are loaded from.
+	OutputPath            string // OutputPath is an optional path to write the prepared stack configuration to.
+}
+
+// PrepareStackConfig records the locked providers and their schemas in a StackConfig, in the same form the prepare
+// step of a stack run passes to the later plan and apply steps. The docstrings are stripped from the schemas, as
+// only the machine-readable type information is of interest.
+func (tf *tfStateOperations) PrepareStackConfig(request StackConfigPrepareRequest) (*tfstacksagent1.StackConfig, error) {
+	providers, err := tf.GetLockedProviderDependencies(request.DependencyLocksHandle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locked providers: %w", err)
+	}
+
+	config := &tfstacksagent1.StackConfig{
+		FormatVersion:   stackConfigFormatVersion,
+		ProviderPlugins: providers,
+		ProviderSchemas: make(map[string]*dependencies.ProviderSchema),
+	}
+	for _, provider := range providers {
+		response, err := tf.client.Dependencies().GetProviderSchema(tf.ctx, &dependencies.GetProviderSchema_Request{
+			ProviderAddr:        provider.SourceAddr,
+			ProviderVersion:     provider.Version,
+			ProviderCacheHandle: request.ProviderCacheHandle,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get schema of provider %s %s: %w", provider.SourceAddr, provider.Version, err)
+		}
+
+		schema := response.GetSchema()
+		if schema == nil {
+			return nil, fmt.Errorf("no schema returned for provider %s %s", provider.SourceAddr, provider.Version)
+		}
+		stripDocStrings(schema.ProtoReflect())
+		config.ProviderSchemas[provider.SourceAddr] = schema
+	}
+
+	if request.OutputPath != "" {
+		if err := WriteStackConfig(request.OutputPath, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// WriteStackConfig writes a prepared stack configuration as JSON to the given path.
+func WriteStackConfig(path string, config *tfstacksagent1.StackConfig) error {
+	raw, err := protojson.MarshalOptions{Multiline: true}.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode stack configuration: %w", err)
+	}
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadStackConfig reads a prepared stack configuration written by WriteStackConfig.
+func ReadStackConfig(path string) (*tfstacksagent1.StackConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	config := &tfstacksagent1.StackConfig{}
+	if err := protojson.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to decode stack configuration %s: %w", path, err)
+	}
+	if config.FormatVersion != stackConfigFormatVersion {
+		return nil, fmt.Errorf("unsupported stack configuration format version %d in %s", config.FormatVersion, path)
+	}
+	return config, nil
+}
+
+// stripDocStrings clears every docstring field of a schema message and of all the messages nested in it.
+func stripDocStrings(message protoreflect.Message) {
+	docStringName := (&dependencies.Schema_DocString{}).ProtoReflect().Descriptor().FullName()
+
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case field.IsMap():
+			if field.MapValue().Kind() == protoreflect.MessageKind {
+				value.Map().Range(func(_ protoreflect.MapKey, entry protoreflect.Value) bool {
+					stripDocStrings(entry.Message())
+					return true
+				})
+			}
+		case field.Kind() != protoreflect.MessageKind:
+		case field.Message().FullName() == docStringName:
+			message.Clear(field)
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				stripDocStrings(list.Get(i).Message())
+			}
+		default:
+			stripDocStrings(value.Message())
+		}
+		return true
+	})
+}
@@ -0,0 +1,269 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+
+	// the raw stack state values are encoded as tfstackdata1 messages, which must be registered to write snapshots
+	_ "github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstackdata1"
+)
+
+// StackStateFormatVersion is the format version of the stack states written by the migration, and the only version
+// the stack state utilities read.
+const StackStateFormatVersion = 1
+
+const (
+	deploymentSnapshotFileExt = `.tfstackstate.json`
+)
+
+// WorkspaceDeployment is a workspace state that is migrated into one deployment of a stack.
+type WorkspaceDeployment struct {
+	Deployment    string // Deployment is the name of the deployment the workspace becomes.
+	StateFilePath string // StateFilePath is the path to the workspace state file, used if RawStateData is empty.
+	RawStateData  []byte // RawStateData is the raw Terraform state data of the workspace.
+}
+
+// DeploymentMigrationRequest represents the request parameters for migrating several workspaces of the same
+// configuration into the deployments of one stack. The stack configuration, dependency locks and provider cache
+// are shared by all deployments and must be opened by the caller.
+type DeploymentMigrationRequest struct {
+	Workspaces                 []WorkspaceDeployment // Workspaces are the workspaces to migrate, one per deployment.
+	StackConfigHandle          int64                 // StackConfigHandle is the handle of the opened stack configuration.
+	DependencyLocksHandle      int64                 // DependencyLocksHandle is the handle of the opened dependency lock file.
+	ProviderCacheHandle        int64                 // ProviderCacheHandle is the handle of the opened provider cache.
+	AbsoluteResourceAddressMap map[string]string     // AbsoluteResourceAddressMap is a map of absolute resource addresses to stack addresses, applied to every workspace.
+	ModuleAddressMap           map[string]string     // ModuleAddressMap is a map of module addresses to stack addresses, applied to every workspace.
+	OutputDir                  string                // OutputDir is an optional directory to write a state snapshot per deployment to.
+}
+
+// DeploymentMigrationResult is the outcome of migrating one workspace into its deployment.
+type DeploymentMigrationResult struct {
+	Deployment   string
+	StackState   *tfstacksagent1.StackState // StackState is the migrated state of the deployment.
+	Diagnostics  []*terraform1.Diagnostic   // Diagnostics are the diagnostics emitted while migrating the workspace.
+	Resources    []string                   // Resources are the addresses of the managed resources in the workspace state.
+	SnapshotPath string                     // SnapshotPath is the path the state snapshot was written to, if any.
+	Err          error                      // Err is set if the workspace could not be migrated.
+}
+
+// ResourceSetDivergence describes a resource that only exists in the state of some of the workspaces.
+type ResourceSetDivergence struct {
+	Resource    string
+	PresentIn   []string // PresentIn lists the deployments whose workspace state contains the resource.
+	MissingFrom []string // MissingFrom lists the deployments whose workspace state does not contain the resource.
+}
+
+// DeploymentMigrationReport is the consolidated report of a batch migration.
+type DeploymentMigrationReport struct {
+	Deployments []*DeploymentMigrationResult
+	Divergences []*ResourceSetDivergence // Divergences lists the resources that are not present in every workspace.
+}
+
+// HasErrors reports whether any deployment failed to migrate or emitted error diagnostics.
+func (r *DeploymentMigrationReport) HasErrors() bool {
+	for _, deployment := range r.Deployments {
+		if deployment.Err != nil {
+			return true
+		}
+		for _, diag := range deployment.Diagnostics {
+			if diag.Severity == terraform1.Diagnostic_ERROR {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MigrateWorkspacesAsDeployments migrates each workspace state with the same mapping into a separate deployment
+// state of one stack. A workspace that fails to migrate does not stop the others, its error is recorded in its
+// result instead. The report also lists the resources that diverge between the workspaces, as those are usually
+// a sign that the workspaces are not deployments of the same configuration.
+func (tf *tfStateOperations) MigrateWorkspacesAsDeployments(request DeploymentMigrationRequest) (*DeploymentMigrationReport, error) {
+	if len(request.Workspaces) == 0 {
+		return nil, fmt.Errorf("no workspaces to migrate")
+	}
+
+	seen := make(map[string]bool)
+	for _, workspace := range request.Workspaces {
+		if workspace.Deployment == "" {
+			return nil, fmt.Errorf("every workspace must be assigned to a deployment")
+		}
+		if seen[workspace.Deployment] {
+			return nil, fmt.Errorf("the deployment %q is assigned to more than one workspace", workspace.Deployment)
+		}
+		seen[workspace.Deployment] = true
+	}
+
+	if request.OutputDir != "" {
+		if err := os.MkdirAll(request.OutputDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", request.OutputDir, err)
+		}
+	}
+
+	report := &DeploymentMigrationReport{}
+	for _, workspace := range request.Workspaces {
+		result := tf.migrateDeployment(workspace, request)
+		report.Deployments = append(report.Deployments, result)
+	}
+	report.Divergences = resourceSetDivergences(report.Deployments)
+
+	return report, nil
+}
+
+// migrateDeployment migrates a single workspace and writes its snapshot.
+func (tf *tfStateOperations) migrateDeployment(workspace WorkspaceDeployment, request DeploymentMigrationRequest) *DeploymentMigrationResult {
+	result := &DeploymentMigrationResult{Deployment: workspace.Deployment}
+
+	raw, err := readRawState(workspace.RawStateData, workspace.StateFilePath)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	state, err := tfstateutil.ParseWorkspaceState(raw)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Resources = []string{}
+	for _, resource := range state.Resources {
+		if resource.Mode == "managed" {
+			result.Resources = append(result.Resources, resource.Addr())
+		}
+	}
+	sort.Strings(result.Resources)
+
+	result.StackState, result.Diagnostics, result.Err = tf.migrateRawState(raw, request.StackConfigHandle, request.DependencyLocksHandle, request.ProviderCacheHandle,
+		request.AbsoluteResourceAddressMap, request.ModuleAddressMap)
+	if result.Err != nil || request.OutputDir == "" {
+		return result
+	}
+
+	path := filepath.Join(request.OutputDir, workspace.Deployment+deploymentSnapshotFileExt)
+	if err := WriteStackStateSnapshot(path, result.StackState); err != nil {
+		result.Err = err
+		return result
+	}
+	result.SnapshotPath = path
+
+	return result
+}
+
+// ReceiveStackState collects the stack state and the diagnostics from the events of a state migration.
+func ReceiveStackState(events stacks.Stacks_MigrateTerraformStateClient) (*tfstacksagent1.StackState, []*terraform1.Diagnostic, error) {
+	stackState := &tfstacksagent1.StackState{
+		FormatVersion: StackStateFormatVersion,
+		Raw:           make(map[string]*anypb.Any),
+		Descriptions:  make(map[string]*stacks.AppliedChange_ChangeDescription),
+	}
+
+	var diagnostics []*terraform1.Diagnostic
+	for {
+		item, err := events.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, diagnostics, fmt.Errorf("failed to receive migration events: %w", err)
+		}
+
+		switch result := item.Result.(type) {
+		case *stacks.MigrateTerraformState_Event_AppliedChange:
+			// raw entries without a value and deleted descriptions remove the key from the state
+			for _, raw := range result.AppliedChange.Raw {
+				if raw.Value == nil {
+					delete(stackState.Raw, raw.Key)
+					continue
+				}
+				stackState.Raw[raw.Key] = raw.Value
+			}
+			for _, change := range result.AppliedChange.Descriptions {
+				if _, ok := change.Description.(*stacks.AppliedChange_ChangeDescription_Deleted); ok {
+					delete(stackState.Descriptions, change.Key)
+					continue
+				}
+				stackState.Descriptions[change.Key] = change
+			}
+		case *stacks.MigrateTerraformState_Event_Diagnostic:
+			diagnostics = append(diagnostics, result.Diagnostic)
+		}
+	}
+
+	return stackState, diagnostics, nil
+}
+
+// WriteStackStateSnapshot writes a stack state as JSON to the given path.
+func WriteStackStateSnapshot(path string, stackState *tfstacksagent1.StackState) error {
+	raw, err := protojson.MarshalOptions{Multiline: true}.Marshal(stackState)
+	if err != nil {
+		return fmt.Errorf("failed to encode stack state: %w", err)
+	}
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadStackStateSnapshot reads a stack state written by WriteStackStateSnapshot.
+func ReadStackStateSnapshot(path string) (*tfstacksagent1.StackState, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	stackState := &tfstacksagent1.StackState{}
+	if err := protojson.Unmarshal(raw, stackState); err != nil {
+		return nil, fmt.Errorf("failed to decode stack state %s: %w", path, err)
+	}
+	return stackState, nil
+}
+
+// resourceSetDivergences compares the resources of the workspaces whose state could be read.
+func resourceSetDivergences(results []*DeploymentMigrationResult) []*ResourceSetDivergence {
+	var deployments []string
+	presence := make(map[string]map[string]bool)
+	for _, result := range results {
+		if result.Resources == nil {
+			continue
+		}
+		deployments = append(deployments, result.Deployment)
+		for _, resource := range result.Resources {
+			if presence[resource] == nil {
+				presence[resource] = make(map[string]bool)
+			}
+			presence[resource][result.Deployment] = true
+		}
+	}
+
+	var divergences []*ResourceSetDivergence
+	for resource, present := range presence {
+		if len(present) == len(deployments) {
+			continue
+		}
+		divergence := &ResourceSetDivergence{Resource: resource}
+		for _, deployment := range deployments {
+			if present[deployment] {
+				divergence.PresentIn = append(divergence.PresentIn, deployment)
+			} else {
+				divergence.MissingFrom = append(divergence.MissingFrom, deployment)
+			}
+		}
+		divergences = append(divergences, divergence)
+	}
+
+	sort.Slice(divergences, func(i, j int) bool {
+		return divergences[i].Resource < divergences[j].Resource
+	})
+	return divergences
+}
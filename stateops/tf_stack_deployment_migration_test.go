@@ -0,0 +1,72 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"io"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+)
+
+// stubMigrationEvents replays fixed migration events, every other method of the stream is left unset.
+type stubMigrationEvents struct {
+	stacks.Stacks_MigrateTerraformStateClient
+	events []*stacks.MigrateTerraformState_Event
+}
+
+func (s *stubMigrationEvents) Recv() (*stacks.MigrateTerraformState_Event, error) {
+	if len(s.events) == 0 {
+		return nil, io.EOF
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event, nil
+}
+
+func appliedChangeEvent(raw []*stacks.AppliedChange_RawChange, descriptions ...*stacks.AppliedChange_ChangeDescription) *stacks.MigrateTerraformState_Event {
+	return &stacks.MigrateTerraformState_Event{
+		Result: &stacks.MigrateTerraformState_Event_AppliedChange{
+			AppliedChange: &stacks.AppliedChange{Raw: raw, Descriptions: descriptions},
+		},
+	}
+}
+
+func TestReceiveStackState_DeletesKeys(t *testing.T) {
+	value, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	described := &stacks.AppliedChange_ChangeDescription{
+		Key:         "kept",
+		Description: &stacks.AppliedChange_ChangeDescription_ComponentInstance{ComponentInstance: &stacks.AppliedChange_ComponentInstance{}},
+	}
+	deleted := func(key string) *stacks.AppliedChange_ChangeDescription {
+		return &stacks.AppliedChange_ChangeDescription{
+			Key:         key,
+			Description: &stacks.AppliedChange_ChangeDescription_Deleted{Deleted: &stacks.AppliedChange_Nothing{}},
+		}
+	}
+
+	state, _, err := ReceiveStackState(&stubMigrationEvents{events: []*stacks.MigrateTerraformState_Event{
+		appliedChangeEvent(
+			[]*stacks.AppliedChange_RawChange{{Key: "kept", Value: value}, {Key: "replaced", Value: value}},
+			described,
+			&stacks.AppliedChange_ChangeDescription{Key: "replaced", Description: described.Description},
+		),
+		appliedChangeEvent([]*stacks.AppliedChange_RawChange{{Key: "replaced"}, {Key: "never-written"}}, deleted("replaced"), deleted("never-written")),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(state.Raw) != 1 || state.Raw["kept"] == nil {
+		t.Errorf("expected only the kept raw entry, got %v", state.Raw)
+	}
+	if len(state.Descriptions) != 1 || state.Descriptions["kept"] == nil {
+		t.Errorf("expected only the kept description, got %v", state.Descriptions)
+	}
+}
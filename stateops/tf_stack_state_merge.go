@@ -0,0 +1,232 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0.
+package stateops
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
+	"github.com/hashicorp/terraform-migrate-utility/tfstateutil"
+)
+
+// WorkspaceComponent is a workspace state that is migrated as a whole into one component of a merged stack.
+type WorkspaceComponent struct {
+	Component     string // Component is the name of the component the workspace becomes.
+	StateFilePath string // StateFilePath is the path to the workspace state file, used if RawStateData is empty.
+	RawStateData  []byte // RawStateData is the raw Terraform state data of the workspace.
+}
+
+// ComponentMergeRequest represents the request parameters for migrating the states of several workspaces into
+// the components of one stack and merging them into a single stack state. The stack configuration, dependency
+// locks and provider cache must be opened by the caller.
+type ComponentMergeRequest struct {
+	Workspaces            []WorkspaceComponent // Workspaces are the workspaces to migrate, one per component.
+	StackConfigHandle     int64                // StackConfigHandle is the handle of the opened stack configuration.
+	DependencyLocksHandle int64                // DependencyLocksHandle is the handle of the opened dependency lock file.
+	ProviderCacheHandle   int64                // ProviderCacheHandle is the handle of the opened provider cache.
+	OutputPath            string               // OutputPath is an optional path to write the merged stack state to, it is only written if the merge has no conflicts.
+}
+
+// ComponentMigrationResult is the outcome of migrating one workspace into its component.
+type ComponentMigrationResult struct {
+	Component   string
+	StackState  *tfstacksagent1.StackState // StackState is the migrated state of the workspace alone.
+	Diagnostics []*terraform1.Diagnostic   // Diagnostics are the diagnostics emitted while migrating the workspace.
+	Err         error                      // Err is set if the workspace could not be migrated.
+}
+
+// RawKeyConflict describes a raw stack state key that several migrated workspaces produced with different values,
+// or with different change descriptions.
+type RawKeyConflict struct {
+	Key         string
+	Components  []string // Components lists the components whose migrated state holds the key.
+	Description bool     // Description reports whether the change descriptions differ rather than the raw values.
+}
+
+// ComponentMergeReport is the report of migrating several workspaces into one stack state.
+type ComponentMergeReport struct {
+	Components []*ComponentMigrationResult
+	StackState *tfstacksagent1.StackState // StackState is the merged state of all the workspaces that were migrated.
+	Conflicts  []*RawKeyConflict          // Conflicts lists the raw keys the merged state holds the value or description of the first component for.
+	OutputPath string                     // OutputPath is the path the merged state was written to, if any.
+}
+
+// HasErrors reports whether any workspace failed to migrate, emitted error diagnostics or conflicts with another.
+func (r *ComponentMergeReport) HasErrors() bool {
+	if len(r.Conflicts) > 0 {
+		return true
+	}
+	for _, component := range r.Components {
+		if component.Err != nil {
+			return true
+		}
+		for _, diag := range component.Diagnostics {
+			if diag.Severity == terraform1.Diagnostic_ERROR {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MigrateWorkspacesAsComponents migrates each workspace state as a whole into its own component, keeping the
+// addresses of the resources within the component, and merges the results into a single stack state.
+// A workspace that fails to migrate does not stop the others, its error is recorded in its result instead.
+func (tf *tfStateOperations) MigrateWorkspacesAsComponents(request ComponentMergeRequest) (*ComponentMergeReport, error) {
+	if len(request.Workspaces) == 0 {
+		return nil, fmt.Errorf("no workspaces to migrate")
+	}
+
+	seen := make(map[string]bool)
+	for _, workspace := range request.Workspaces {
+		if workspace.Component == "" {
+			return nil, fmt.Errorf("every workspace must be assigned to a component")
+		}
+		if seen[workspace.Component] {
+			return nil, fmt.Errorf("the component %q is assigned to more than one workspace", workspace.Component)
+		}
+		seen[workspace.Component] = true
+	}
+
+	report := &ComponentMergeReport{}
+	states := make(map[string]*tfstacksagent1.StackState)
+	for _, workspace := range request.Workspaces {
+		result := &ComponentMigrationResult{Component: workspace.Component}
+		report.Components = append(report.Components, result)
+
+		raw, err := readRawState(workspace.RawStateData, workspace.StateFilePath)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+		state, err := tfstateutil.ParseWorkspaceState(raw)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+
+		result.StackState, result.Diagnostics, result.Err = tf.migrateRawState(raw, request.StackConfigHandle, request.DependencyLocksHandle, request.ProviderCacheHandle,
+			wholeWorkspaceResourceMap(state, workspace.Component), nil)
+		if result.Err == nil {
+			states[workspace.Component] = result.StackState
+		}
+	}
+
+	report.StackState, report.Conflicts = MergeStackStates(states)
+
+	if request.OutputPath != "" && len(report.Conflicts) == 0 {
+		if err := WriteStackStateSnapshot(request.OutputPath, report.StackState); err != nil {
+			return nil, err
+		}
+		report.OutputPath = request.OutputPath
+	}
+
+	return report, nil
+}
+
+// MergeStackStates merges the stack states migrated for separate components into one. A raw key held by several
+// states with equal values is merged, one held with different values is reported as a conflict and keeps the value
+// of the first component in lexical order. Change descriptions are merged and reported the same way.
+func MergeStackStates(states map[string]*tfstacksagent1.StackState) (*tfstacksagent1.StackState, []*RawKeyConflict) {
+	merged := &tfstacksagent1.StackState{
+		FormatVersion: StackStateFormatVersion,
+		Raw:           make(map[string]*anypb.Any),
+		Descriptions:  make(map[string]*stacks.AppliedChange_ChangeDescription),
+	}
+
+	owners := make(map[string][]string)
+	conflicting := make(map[string]bool)
+	describers := make(map[string][]string)
+	conflictingDescriptions := make(map[string]bool)
+	components := make([]string, 0, len(states))
+	for component := range states {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	for _, component := range components {
+		state := states[component]
+		for key, value := range state.GetRaw() {
+			if existing, ok := merged.Raw[key]; ok && !proto.Equal(existing, value) {
+				conflicting[key] = true
+			} else if !ok {
+				merged.Raw[key] = value
+			}
+			owners[key] = append(owners[key], component)
+		}
+		for key, description := range state.GetDescriptions() {
+			if existing, ok := merged.Descriptions[key]; ok && !proto.Equal(existing, description) {
+				conflictingDescriptions[key] = true
+			} else if !ok {
+				merged.Descriptions[key] = description
+			}
+			describers[key] = append(describers[key], component)
+		}
+	}
+
+	var conflicts []*RawKeyConflict
+	for key := range conflicting {
+		conflicts = append(conflicts, &RawKeyConflict{Key: key, Components: owners[key]})
+	}
+	for key := range conflictingDescriptions {
+		conflicts = append(conflicts, &RawKeyConflict{Key: key, Components: describers[key], Description: true})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Key != conflicts[j].Key {
+			return conflicts[i].Key < conflicts[j].Key
+		}
+		return !conflicts[i].Description && conflicts[j].Description
+	})
+
+	return merged, conflicts
+}
+
+// wholeWorkspaceResourceMap maps every managed resource instance of a workspace state into the given component,
+// keeping its address.
+func wholeWorkspaceResourceMap(state *tfstateutil.WorkspaceState, component string) map[string]string {
+	resources := make(map[string]string)
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		for _, instance := range resource.Instances {
+			resources[resource.InstanceAddr(instance)] = "component." + component
+		}
+	}
+	return resources
+}
+
+// readRawState returns the raw state data, reading it from the state file if it was not provided.
+func readRawState(raw []byte, stateFilePath string) ([]byte, error) {
+	if len(raw) > 0 {
+		return raw, nil
+	}
+	raw, err := os.ReadFile(stateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %w", stateFilePath, err)
+	}
+	return raw, nil
+}
+
+// migrateRawState opens a raw Terraform state, migrates it with the given mapping and collects the resulting stack state.
+func (tf *tfStateOperations) migrateRawState(raw []byte, stackConfigHandle int64, dependencyLocksHandle int64, providerCacheHandle int64, resources map[string]string, modules map[string]string) (*tfstacksagent1.StackState, []*terraform1.Diagnostic, error) {
+	stateHandle, closeState, err := tf.OpenTerraformStateRaw(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open Terraform state: %w", err)
+	}
+	defer closeState()
+
+	events, err := tf.MigrateTFState(stateHandle, stackConfigHandle, dependencyLocksHandle, providerCacheHandle, resources, modules)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate Terraform state: %w", err)
+	}
+
+	return ReceiveStackState(events)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1"
 	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/dependencies"
 	"github.com/hashicorp/terraform-migrate-utility/rpcapi/terraform1/stacks"
+	"github.com/hashicorp/terraform-migrate-utility/rpcapi/tfstacksagent1"
 )
 
 // Order of execution:
@@ -36,11 +37,23 @@ type WorkspaceToStackStateConversionRequest struct {
 
 type TFStateOperations interface {
 	OpenSourceBundle(dotTFModulesPath string) (int64, func() error, error)
+	BuildSourceBundle(request SourceBundleRequest) (*SourceBundleResult, error)
 	OpenStacksConfiguration(sourceBundleHandle int64, stackConfigPath string) (int64, func() error, error)
 	OpenDependencyLockFile(handle int64, dotTFLockFile string) (int64, func() error, error)
 	OpenProviderCache(dotTFProvidersPath string) (int64, func() error, error)
+	BuildProviderCache(request ProviderCacheBuildRequest) (*ProviderCacheBuildResult, error)
+	MirrorProviders(request ProviderMirrorRequest) (*ProviderMirrorReport, error)
+	PrepareStackConfig(request StackConfigPrepareRequest) (*tfstacksagent1.StackConfig, error)
+	CreateDependencyLocks(selections []*terraform1.ProviderPackage) (int64, func() error, error)
+	GetCachedProviders(providerCacheHandle int64) ([]*terraform1.ProviderPackage, error)
+	GetLockedProviderDependencies(dependencyLocksHandle int64) ([]*terraform1.ProviderPackage, error)
+	MergeDependencyLocks(request LockMergeRequest) (*LockMergeReport, error)
+	SynthesizeDependencyLocks(request DependencyLockSynthesisRequest) (*DependencyLockSynthesisResult, error)
 	OpenTerraformStateRaw(tfStateFileRaw []byte) (int64, func() error, error)
 	OpenTerraformStateByPath(tfStateFilePath string) (int64, func() error, error)
+	FindStackComponents(stackConfigHandle int64) ([]*StackComponent, error)
+	MigrateWorkspacesAsComponents(request ComponentMergeRequest) (*ComponentMergeReport, error)
+	MigrateWorkspacesAsDeployments(request DeploymentMigrationRequest) (*DeploymentMigrationReport, error)
 	MigrateTFState(tfStateHandle int64, stackConfigHandle int64, dependencyLocksHandle int64, providerCacheHandle int64, resources map[string]string, modules map[string]string) (stacks.Stacks_MigrateTerraformStateClient, error)
 }
 
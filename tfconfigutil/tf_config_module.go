@@ -0,0 +1,865 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	terraformConfigFileExt     = `.tf`
+	terraformJSONConfigFileExt = `.tf.json`
+	defaultProviderRegistry    = `registry.terraform.io`
+	defaultProviderNamespace   = `hashicorp`
+	builtinProviderSource      = `terraform.io/builtin/terraform`
+)
+
+// ResourceMode distinguishes managed resources from data resources.
+type ResourceMode string
+
+const (
+	ManagedResourceMode ResourceMode = "managed"
+	DataResourceMode    ResourceMode = "data"
+)
+
+// Module represents the top-level declarations of a single classic Terraform module directory.
+// Only the constructs needed by the migration utilities are decoded, everything else is left in the raw files.
+type Module struct {
+	Dir   string
+	Files map[string]*hcl.File
+
+	Backend           *Backend
+	RequiredProviders map[string]*RequiredProvider
+	ProviderConfigs   map[string]*ProviderConfig
+	Variables         map[string]*Variable
+	Outputs           map[string]*Output
+	Locals            map[string]*Local
+	ModuleCalls       map[string]*ModuleCall
+	ManagedResources  map[string]*Resource
+	DataResources     map[string]*Resource
+	Moved             []*Moved
+}
+
+// Backend represents the backend or cloud block of a root module.
+type Backend struct {
+	Type      string
+	DeclRange hcl.Range
+}
+
+// RequiredProvider represents a single entry of the required_providers block.
+type RequiredProvider struct {
+	Name                 string
+	Source               string
+	Requirement          string
+	ConfigurationAliases []string
+	DeclRange            hcl.Range
+}
+
+// ProviderConfig represents a provider block.
+type ProviderConfig struct {
+	Name      string
+	Alias     string
+	Config    hcl.Body
+	DeclRange hcl.Range
+}
+
+// Variable represents a variable block.
+type Variable struct {
+	Name        string
+	Description string
+	Type        hcl.Expression
+	Default     hcl.Expression
+	Sensitive   bool
+	Ephemeral   bool
+	Nullable    *bool
+	DeclRange   hcl.Range
+}
+
+// Output represents an output block.
+type Output struct {
+	Name        string
+	Description string
+	Expr        hcl.Expression
+	Sensitive   bool
+	Ephemeral   bool
+	DeclRange   hcl.Range
+}
+
+// Local represents a single entry of a locals block.
+type Local struct {
+	Name      string
+	Expr      hcl.Expression
+	DeclRange hcl.Range
+}
+
+// ModuleCall represents a module block.
+type ModuleCall struct {
+	Name      string
+	Source    string
+	Version   string
+	Count     hcl.Expression
+	ForEach   hcl.Expression
+	Providers []*PassedProvider
+	Inputs    hcl.Attributes
+	DependsOn []hcl.Traversal
+	DeclRange hcl.Range
+}
+
+// PassedProvider represents a single entry of the providers argument of a module block.
+// InChild is the provider config address as seen by the child module ("aws" or "aws.west")
+// and InParent is the provider config address in the calling module.
+type PassedProvider struct {
+	InChild  string
+	InParent string
+	Range    hcl.Range
+}
+
+// Resource represents a resource or data block.
+type Resource struct {
+	Mode         ResourceMode
+	Type         string
+	Name         string
+	ProviderRef  string
+	Count        hcl.Expression
+	ForEach      hcl.Expression
+	Provisioners []*Provisioner
+	DependsOn    []hcl.Traversal
+	Config       hcl.Body
+	DeclRange    hcl.Range
+}
+
+// Provisioner represents a provisioner block nested inside a resource block.
+type Provisioner struct {
+	Type      string
+	DeclRange hcl.Range
+}
+
+// Moved represents a moved block.
+type Moved struct {
+	From      hcl.Traversal
+	To        hcl.Traversal
+	DeclRange hcl.Range
+}
+
+var (
+	moduleFileSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "terraform"},
+			{Type: "provider", LabelNames: []string{"name"}},
+			{Type: "variable", LabelNames: []string{"name"}},
+			{Type: "output", LabelNames: []string{"name"}},
+			{Type: "locals"},
+			{Type: "module", LabelNames: []string{"name"}},
+			{Type: "resource", LabelNames: []string{"type", "name"}},
+			{Type: "data", LabelNames: []string{"type", "name"}},
+			{Type: "moved"},
+		},
+	}
+
+	terraformBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "backend", LabelNames: []string{"type"}},
+			{Type: "cloud"},
+			{Type: "required_providers"},
+		},
+	}
+
+	providerBlockSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "alias"},
+			{Name: "version"},
+		},
+	}
+
+	variableBlockSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "description"},
+			{Name: "type"},
+			{Name: "default"},
+			{Name: "sensitive"},
+			{Name: "ephemeral"},
+			{Name: "nullable"},
+		},
+	}
+
+	outputBlockSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "description"},
+			{Name: "value", Required: true},
+			{Name: "sensitive"},
+			{Name: "ephemeral"},
+			{Name: "depends_on"},
+		},
+	}
+
+	moduleBlockSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "source", Required: true},
+			{Name: "version"},
+			{Name: "count"},
+			{Name: "for_each"},
+			{Name: "providers"},
+			{Name: "depends_on"},
+		},
+	}
+
+	resourceBlockSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "count"},
+			{Name: "for_each"},
+			{Name: "provider"},
+			{Name: "depends_on"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "provisioner", LabelNames: []string{"type"}},
+			{Type: "lifecycle"},
+			{Type: "connection"},
+		},
+	}
+
+	movedBlockSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "from", Required: true},
+			{Name: "to", Required: true},
+		},
+	}
+)
+
+// LoadModule parses all the Terraform configuration files in the given directory and decodes
+// the top-level declarations into a Module. Override files are not merged and are ignored.
+func LoadModule(parser *hclparse.Parser, dir string) (*Module, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("path %s does not exist", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error accessing path %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("path %s is not a directory", dir)
+	}
+
+	configFiles, err := configFilesInDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configFiles) == 0 {
+		return nil, fmt.Errorf("no terraform configuration files found in the directory %s", dir)
+	}
+
+	module := &Module{
+		Dir:               dir,
+		Files:             make(map[string]*hcl.File),
+		RequiredProviders: make(map[string]*RequiredProvider),
+		ProviderConfigs:   make(map[string]*ProviderConfig),
+		Variables:         make(map[string]*Variable),
+		Outputs:           make(map[string]*Output),
+		Locals:            make(map[string]*Local),
+		ModuleCalls:       make(map[string]*ModuleCall),
+		ManagedResources:  make(map[string]*Resource),
+		DataResources:     make(map[string]*Resource),
+	}
+
+	for _, filePath := range configFiles {
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(filePath, terraformJSONConfigFileExt) {
+			file, diags = parser.ParseJSONFile(filePath)
+		} else {
+			file, diags = parser.ParseHCLFile(filePath)
+		}
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse HCL file %s, err: %v", filePath, diags.Error())
+		}
+
+		// check if the file is nil or has no body
+		if file == nil || file.Body == nil {
+			continue
+		}
+
+		module.Files[filePath] = file
+		if err := module.decodeFile(file); err != nil {
+			return nil, fmt.Errorf("failed to decode HCL file %s, err: %v", filePath, err)
+		}
+	}
+
+	return module, nil
+}
+
+// configFilesInDir returns the sorted list of primary configuration files in the given directory.
+func configFilesInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading directory %s, err: %w", dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if !strings.HasSuffix(name, terraformConfigFileExt) && !strings.HasSuffix(name, terraformJSONConfigFileExt) {
+			continue
+		}
+
+		// override files and editor swap files are not part of the primary configuration
+		baseName := strings.TrimSuffix(strings.TrimSuffix(name, terraformJSONConfigFileExt), terraformConfigFileExt)
+		if baseName == "override" || strings.HasSuffix(baseName, "_override") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") {
+			continue
+		}
+
+		files = append(files, filepath.Join(dir, name))
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// decodeFile decodes the top-level blocks of a single configuration file into the module.
+func (m *Module) decodeFile(file *hcl.File) error {
+	content, _, diags := file.Body.PartialContent(moduleFileSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, block := range content.Blocks {
+		var err error
+		switch block.Type {
+		case "terraform":
+			err = m.decodeTerraformBlock(block)
+		case "provider":
+			err = m.decodeProviderBlock(block)
+		case "variable":
+			err = m.decodeVariableBlock(block)
+		case "output":
+			err = m.decodeOutputBlock(block)
+		case "locals":
+			err = m.decodeLocalsBlock(block)
+		case "module":
+			err = m.decodeModuleBlock(block)
+		case "resource":
+			err = m.decodeResourceBlock(block, ManagedResourceMode)
+		case "data":
+			err = m.decodeResourceBlock(block, DataResourceMode)
+		case "moved":
+			err = m.decodeMovedBlock(block)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Module) decodeTerraformBlock(block *hcl.Block) error {
+	content, _, diags := block.Body.PartialContent(terraformBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, nested := range content.Blocks {
+		switch nested.Type {
+		case "backend":
+			m.Backend = &Backend{Type: nested.Labels[0], DeclRange: nested.DefRange}
+		case "cloud":
+			m.Backend = &Backend{Type: "cloud", DeclRange: nested.DefRange}
+		case "required_providers":
+			if err := m.decodeRequiredProviders(nested); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Module) decodeRequiredProviders(block *hcl.Block) error {
+	attrs, diags := block.Body.JustAttributes()
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for name, attr := range attrs {
+		requiredProvider := &RequiredProvider{
+			Name:      name,
+			DeclRange: attr.Range,
+		}
+
+		// the legacy syntax only sets the version constraint as a string
+		value, valueDiags := attr.Expr.Value(nil)
+		if !valueDiags.HasErrors() && value.Type() == cty.String && value.IsKnown() && !value.IsNull() {
+			requiredProvider.Requirement = value.AsString()
+			m.RequiredProviders[name] = requiredProvider
+			continue
+		}
+
+		pairs, pairDiags := hcl.ExprMap(attr.Expr)
+		if pairDiags.HasErrors() {
+			return pairDiags
+		}
+
+		for _, pair := range pairs {
+			key := hcl.ExprAsKeyword(pair.Key)
+			switch key {
+			case "source", "version":
+				v, vDiags := pair.Value.Value(nil)
+				if vDiags.HasErrors() {
+					return vDiags
+				}
+				if v.Type() != cty.String || v.IsNull() {
+					return fmt.Errorf("required provider %s has an invalid %s value", name, key)
+				}
+				if key == "source" {
+					requiredProvider.Source = v.AsString()
+				} else {
+					requiredProvider.Requirement = v.AsString()
+				}
+			case "configuration_aliases":
+				exprs, listDiags := hcl.ExprList(pair.Value)
+				if listDiags.HasErrors() {
+					return listDiags
+				}
+				for _, expr := range exprs {
+					traversal, tDiags := hcl.AbsTraversalForExpr(expr)
+					if tDiags.HasErrors() {
+						return tDiags
+					}
+					requiredProvider.ConfigurationAliases = append(requiredProvider.ConfigurationAliases, TraversalString(traversal))
+				}
+			}
+		}
+
+		m.RequiredProviders[name] = requiredProvider
+	}
+
+	return nil
+}
+
+func (m *Module) decodeProviderBlock(block *hcl.Block) error {
+	content, remain, diags := block.Body.PartialContent(providerBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	providerConfig := &ProviderConfig{
+		Name:      block.Labels[0],
+		Config:    remain,
+		DeclRange: block.DefRange,
+	}
+
+	if attr, ok := content.Attributes["alias"]; ok {
+		alias := hcl.ExprAsKeyword(attr.Expr)
+		if alias == "" {
+			value, valueDiags := attr.Expr.Value(nil)
+			if valueDiags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+				return fmt.Errorf("provider %s has an invalid alias", providerConfig.Name)
+			}
+			alias = value.AsString()
+		}
+		providerConfig.Alias = alias
+	}
+
+	m.ProviderConfigs[providerConfig.Addr()] = providerConfig
+	return nil
+}
+
+func (m *Module) decodeVariableBlock(block *hcl.Block) error {
+	content, _, diags := block.Body.PartialContent(variableBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	variable := &Variable{
+		Name:      block.Labels[0],
+		DeclRange: block.DefRange,
+	}
+
+	if attr, ok := content.Attributes["description"]; ok {
+		variable.Description = staticString(attr.Expr)
+	}
+	if attr, ok := content.Attributes["type"]; ok {
+		variable.Type = attr.Expr
+	}
+	if attr, ok := content.Attributes["default"]; ok {
+		variable.Default = attr.Expr
+	}
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		variable.Sensitive = staticBool(attr.Expr)
+	}
+	if attr, ok := content.Attributes["ephemeral"]; ok {
+		variable.Ephemeral = staticBool(attr.Expr)
+	}
+	if attr, ok := content.Attributes["nullable"]; ok {
+		nullable := staticBool(attr.Expr)
+		variable.Nullable = &nullable
+	}
+
+	m.Variables[variable.Name] = variable
+	return nil
+}
+
+func (m *Module) decodeOutputBlock(block *hcl.Block) error {
+	content, _, diags := block.Body.PartialContent(outputBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	output := &Output{
+		Name:      block.Labels[0],
+		Expr:      content.Attributes["value"].Expr,
+		DeclRange: block.DefRange,
+	}
+
+	if attr, ok := content.Attributes["description"]; ok {
+		output.Description = staticString(attr.Expr)
+	}
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		output.Sensitive = staticBool(attr.Expr)
+	}
+	if attr, ok := content.Attributes["ephemeral"]; ok {
+		output.Ephemeral = staticBool(attr.Expr)
+	}
+
+	m.Outputs[output.Name] = output
+	return nil
+}
+
+func (m *Module) decodeLocalsBlock(block *hcl.Block) error {
+	attrs, diags := block.Body.JustAttributes()
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for name, attr := range attrs {
+		m.Locals[name] = &Local{
+			Name:      name,
+			Expr:      attr.Expr,
+			DeclRange: attr.Range,
+		}
+	}
+
+	return nil
+}
+
+func (m *Module) decodeModuleBlock(block *hcl.Block) error {
+	content, remain, diags := block.Body.PartialContent(moduleBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	moduleCall := &ModuleCall{
+		Name:      block.Labels[0],
+		Source:    staticString(content.Attributes["source"].Expr),
+		DeclRange: block.DefRange,
+	}
+
+	if attr, ok := content.Attributes["version"]; ok {
+		moduleCall.Version = staticString(attr.Expr)
+	}
+	if attr, ok := content.Attributes["count"]; ok {
+		moduleCall.Count = attr.Expr
+	}
+	if attr, ok := content.Attributes["for_each"]; ok {
+		moduleCall.ForEach = attr.Expr
+	}
+	if attr, ok := content.Attributes["depends_on"]; ok {
+		dependsOn, err := traversalList(attr.Expr)
+		if err != nil {
+			return err
+		}
+		moduleCall.DependsOn = dependsOn
+	}
+	if attr, ok := content.Attributes["providers"]; ok {
+		pairs, pairDiags := hcl.ExprMap(attr.Expr)
+		if pairDiags.HasErrors() {
+			return pairDiags
+		}
+		for _, pair := range pairs {
+			inChild, kDiags := hcl.AbsTraversalForExpr(pair.Key)
+			if kDiags.HasErrors() {
+				return kDiags
+			}
+			inParent, vDiags := hcl.AbsTraversalForExpr(pair.Value)
+			if vDiags.HasErrors() {
+				return vDiags
+			}
+			moduleCall.Providers = append(moduleCall.Providers, &PassedProvider{
+				InChild:  TraversalString(inChild),
+				InParent: TraversalString(inParent),
+				Range:    hcl.RangeBetween(pair.Key.Range(), pair.Value.Range()),
+			})
+		}
+	}
+
+	inputs, inputDiags := remain.JustAttributes()
+	if inputDiags.HasErrors() {
+		return inputDiags
+	}
+	moduleCall.Inputs = inputs
+
+	m.ModuleCalls[moduleCall.Name] = moduleCall
+	return nil
+}
+
+func (m *Module) decodeResourceBlock(block *hcl.Block, mode ResourceMode) error {
+	content, remain, diags := block.Body.PartialContent(resourceBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	resource := &Resource{
+		Mode:      mode,
+		Type:      block.Labels[0],
+		Name:      block.Labels[1],
+		Config:    remain,
+		DeclRange: block.DefRange,
+	}
+
+	if attr, ok := content.Attributes["count"]; ok {
+		resource.Count = attr.Expr
+	}
+	if attr, ok := content.Attributes["for_each"]; ok {
+		resource.ForEach = attr.Expr
+	}
+	if attr, ok := content.Attributes["provider"]; ok {
+		traversal, tDiags := hcl.AbsTraversalForExpr(attr.Expr)
+		if tDiags.HasErrors() {
+			return tDiags
+		}
+		resource.ProviderRef = TraversalString(traversal)
+	}
+	if attr, ok := content.Attributes["depends_on"]; ok {
+		dependsOn, err := traversalList(attr.Expr)
+		if err != nil {
+			return err
+		}
+		resource.DependsOn = dependsOn
+	}
+
+	for _, nested := range content.Blocks {
+		if nested.Type == "provisioner" {
+			resource.Provisioners = append(resource.Provisioners, &Provisioner{
+				Type:      nested.Labels[0],
+				DeclRange: nested.DefRange,
+			})
+		}
+	}
+
+	if mode == DataResourceMode {
+		m.DataResources[resource.Addr()] = resource
+	} else {
+		m.ManagedResources[resource.Addr()] = resource
+	}
+	return nil
+}
+
+func (m *Module) decodeMovedBlock(block *hcl.Block) error {
+	content, _, diags := block.Body.PartialContent(movedBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	from, fromDiags := hcl.AbsTraversalForExpr(content.Attributes["from"].Expr)
+	if fromDiags.HasErrors() {
+		return fromDiags
+	}
+	to, toDiags := hcl.AbsTraversalForExpr(content.Attributes["to"].Expr)
+	if toDiags.HasErrors() {
+		return toDiags
+	}
+
+	m.Moved = append(m.Moved, &Moved{
+		From:      from,
+		To:        to,
+		DeclRange: block.DefRange,
+	})
+	return nil
+}
+
+// Addr returns the provider configuration address as used in references, for example "aws" or "aws.east".
+func (p *ProviderConfig) Addr() string {
+	if p.Alias == "" {
+		return p.Name
+	}
+	return p.Name + "." + p.Alias
+}
+
+// Addr returns the resource address relative to its module, for example "aws_instance.web" or "data.aws_ami.ubuntu".
+func (r *Resource) Addr() string {
+	if r.Mode == DataResourceMode {
+		return fmt.Sprintf("data.%s.%s", r.Type, r.Name)
+	}
+	return fmt.Sprintf("%s.%s", r.Type, r.Name)
+}
+
+// ProviderConfigAddr returns the provider configuration address used by the resource.
+// When no provider argument is set, the default configuration of the provider implied by the resource type is returned.
+func (r *Resource) ProviderConfigAddr() string {
+	if r.ProviderRef != "" {
+		return r.ProviderRef
+	}
+	return ImpliedProviderName(r.Type)
+}
+
+// ProviderLocalName returns the local name of the provider used by the resource.
+func (r *Resource) ProviderLocalName() string {
+	name, _, _ := strings.Cut(r.ProviderConfigAddr(), ".")
+	return name
+}
+
+// ProviderSource returns the fully qualified source address for the provider with the given local name.
+// Providers not listed in required_providers default to the hashicorp namespace of the public registry.
+func (m *Module) ProviderSource(localName string) string {
+	if localName == "terraform" {
+		return builtinProviderSource
+	}
+	if requiredProvider, ok := m.RequiredProviders[localName]; ok && requiredProvider.Source != "" {
+		return NormalizeProviderSource(requiredProvider.Source)
+	}
+	return NormalizeProviderSource(localName)
+}
+
+// ProviderLocalNames returns the sorted local names of all the providers the module refers to,
+// whether through required_providers, provider blocks or resources.
+func (m *Module) ProviderLocalNames() []string {
+	names := make(map[string]struct{})
+	for name := range m.RequiredProviders {
+		names[name] = struct{}{}
+	}
+	for _, providerConfig := range m.ProviderConfigs {
+		names[providerConfig.Name] = struct{}{}
+	}
+	for _, resource := range m.ManagedResources {
+		names[resource.ProviderLocalName()] = struct{}{}
+	}
+	for _, resource := range m.DataResources {
+		names[resource.ProviderLocalName()] = struct{}{}
+	}
+
+	return SortedKeys(names)
+}
+
+// ImpliedProviderName returns the provider local name implied by a resource type, for example "aws" for "aws_instance".
+func ImpliedProviderName(resourceType string) string {
+	name, _, _ := strings.Cut(resourceType, "_")
+	return name
+}
+
+// NormalizeProviderSource returns the fully qualified form of a provider source address,
+// for example "registry.terraform.io/hashicorp/aws" for "aws" or "hashicorp/aws".
+func NormalizeProviderSource(source string) string {
+	parts := strings.Split(strings.ToLower(source), "/")
+	switch len(parts) {
+	case 1:
+		return fmt.Sprintf("%s/%s/%s", defaultProviderRegistry, defaultProviderNamespace, parts[0])
+	case 2:
+		return fmt.Sprintf("%s/%s/%s", defaultProviderRegistry, parts[0], parts[1])
+	default:
+		return strings.Join(parts, "/")
+	}
+}
+
+// IsBuiltinProviderSource reports whether the given fully qualified provider source is built into Terraform.
+func IsBuiltinProviderSource(source string) bool {
+	return source == builtinProviderSource
+}
+
+// IsLocalModuleSource reports whether the module source address refers to a local directory.
+func IsLocalModuleSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+}
+
+// TraversalString renders a traversal back into its source form, for example `module.foo["a"].bar`.
+func TraversalString(traversal hcl.Traversal) string {
+	var sb strings.Builder
+	for i, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			sb.WriteString(s.Name)
+		case hcl.TraverseAttr:
+			if i > 0 {
+				sb.WriteString(".")
+			}
+			sb.WriteString(s.Name)
+		case hcl.TraverseIndex:
+			sb.WriteString(IndexKeyString(s.Key))
+		case hcl.TraverseSplat:
+			sb.WriteString("[*]")
+		}
+	}
+	return sb.String()
+}
+
+// IndexKeyString renders an instance key as it appears in an address, for example `[0]` or `["a"]`.
+func IndexKeyString(key cty.Value) string {
+	if key.IsNull() || !key.IsKnown() {
+		return "[?]"
+	}
+	switch key.Type() {
+	case cty.String:
+		return fmt.Sprintf("[%q]", key.AsString())
+	case cty.Number:
+		return fmt.Sprintf("[%s]", key.AsBigFloat().Text('f', -1))
+	default:
+		return "[?]"
+	}
+}
+
+// SortedKeys returns the keys of the given map in lexical order.
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// staticString returns the value of a constant string expression, or the empty string if the expression is not constant.
+func staticString(expr hcl.Expression) string {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.String {
+		return ""
+	}
+	return value.AsString()
+}
+
+// staticBool returns the value of a constant bool expression, or false if the expression is not constant.
+func staticBool(expr hcl.Expression) bool {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.Bool {
+		return false
+	}
+	return value.True()
+}
+
+// traversalList decodes a list of static references such as the value of a depends_on argument.
+func traversalList(expr hcl.Expression) ([]hcl.Traversal, error) {
+	exprs, diags := hcl.ExprList(expr)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var traversals []hcl.Traversal
+	for _, e := range exprs {
+		traversal, tDiags := hcl.AbsTraversalForExpr(e)
+		if tDiags.HasErrors() {
+			return nil, tDiags
+		}
+		traversals = append(traversals, traversal)
+	}
+	return traversals, nil
+}
@@ -0,0 +1,28 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"context"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+type tfConfigUtility struct {
+	ctx       context.Context
+	hclParser *hclparse.Parser
+}
+
+// TfConfigUtility defines the interface for utility functions that refactor classic Terraform configuration.
+type TfConfigUtility interface {
+	ModulariseRootModule(request ModulariseRequest) (*ModulariseResult, error)
+}
+
+// NewTfConfigUtility creates a new instance of tfConfigUtility with the provided context.
+func NewTfConfigUtility(ctx context.Context) TfConfigUtility {
+	return &tfConfigUtility{
+		ctx:       ctx,
+		hclParser: hclparse.NewParser(),
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// DependencyLockFileName is the conventional name of the dependency lock file in a configuration directory.
+	DependencyLockFileName = `.terraform.lock.hcl`
+
+	dependencyLockFileHeader = "# This file is maintained automatically by \"terraform init\".\n# Manual edits may be lost in future updates.\n"
+)
+
+// LockedProvider represents a single provider block of a dependency lock file.
+type LockedProvider struct {
+	Source      string
+	Version     string
+	Constraints string
+	Hashes      []string
+	DeclRange   hcl.Range
+}
+
+var (
+	lockFileSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "provider", LabelNames: []string{"source_addr"}},
+		},
+	}
+
+	lockedProviderSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "version", Required: true},
+			{Name: "constraints"},
+			{Name: "hashes"},
+		},
+	}
+)
+
+// LoadDependencyLockFile parses the dependency lock file at the given path and returns the locked providers
+// keyed by their fully qualified source address.
+func LoadDependencyLockFile(parser *hclparse.Parser, lockFilePath string) (map[string]*LockedProvider, error) {
+	if _, err := os.Stat(lockFilePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("dependency lock file %s does not exist", lockFilePath)
+	}
+
+	file, diags := parser.ParseHCLFile(lockFilePath)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse HCL file %s, err: %v", lockFilePath, diags.Error())
+	}
+
+	lockedProviders := make(map[string]*LockedProvider)
+
+	// check if the file is nil or has no body
+	if file == nil || file.Body == nil {
+		return lockedProviders, nil
+	}
+
+	content, _, diags := file.Body.PartialContent(lockFileSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	for _, block := range content.Blocks {
+		providerContent, _, providerDiags := block.Body.PartialContent(lockedProviderSchema)
+		if providerDiags.HasErrors() {
+			return nil, providerDiags
+		}
+
+		lockedProvider := &LockedProvider{
+			Source:    NormalizeProviderSource(block.Labels[0]),
+			Version:   staticString(providerContent.Attributes["version"].Expr),
+			DeclRange: block.DefRange,
+		}
+
+		if attr, ok := providerContent.Attributes["constraints"]; ok {
+			lockedProvider.Constraints = staticString(attr.Expr)
+		}
+
+		if attr, ok := providerContent.Attributes["hashes"]; ok {
+			value, valueDiags := attr.Expr.Value(nil)
+			if valueDiags.HasErrors() {
+				return nil, valueDiags
+			}
+			if !value.IsNull() && value.CanIterateElements() {
+				for it := value.ElementIterator(); it.Next(); {
+					_, hash := it.Element()
+					if hash.Type() != cty.String || hash.IsNull() {
+						return nil, fmt.Errorf("provider %s has an invalid hash in %s", lockedProvider.Source, lockFilePath)
+					}
+					lockedProvider.Hashes = append(lockedProvider.Hashes, hash.AsString())
+				}
+			}
+		}
+
+		lockedProviders[lockedProvider.Source] = lockedProvider
+	}
+
+	return lockedProviders, nil
+}
+
+// WriteDependencyLockFile writes the locked providers to a dependency lock file at the given path, in the same
+// layout terraform init uses. The providers are sorted by source address and their hashes are sorted.
+func WriteDependencyLockFile(lockFilePath string, providers []*LockedProvider) error {
+	sorted := append([]*LockedProvider{}, providers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Source < sorted[j].Source
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(dependencyLockFileHeader)
+	for _, provider := range sorted {
+		buf.WriteString("\n")
+		fmt.Fprintf(&buf, "provider %s {\n", strconv.Quote(provider.Source))
+		fmt.Fprintf(&buf, "  version = %s\n", strconv.Quote(provider.Version))
+		if provider.Constraints != "" {
+			fmt.Fprintf(&buf, "  constraints = %s\n", strconv.Quote(provider.Constraints))
+		}
+		if len(provider.Hashes) > 0 {
+			hashes := append([]string{}, provider.Hashes...)
+			sort.Strings(hashes)
+			buf.WriteString("  hashes = [\n")
+			for _, hash := range hashes {
+				fmt.Fprintf(&buf, "    %s,\n", strconv.Quote(hash))
+			}
+			buf.WriteString("  ]\n")
+		}
+		buf.WriteString("}\n")
+	}
+
+	if err := os.WriteFile(lockFilePath, hclwrite.Format(buf.Bytes()), 0o644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", lockFilePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const (
+	moduleManifestRelPath = `.terraform/modules/modules.json`
+)
+
+// moduleManifest represents the modules.json file written by `terraform init` for installed modules.
+type moduleManifest struct {
+	Modules []struct {
+		Key    string `json:"Key"`
+		Source string `json:"Source"`
+		Dir    string `json:"Dir"`
+	} `json:"Modules"`
+}
+
+// ResolveModuleCallDir returns the directory holding the source of a module called from the root module in rootDir.
+// Local sources are resolved relative to rootDir, other sources are looked up in the module manifest written by
+// `terraform init`. The second return value is false if the directory cannot be found.
+func ResolveModuleCallDir(rootDir string, moduleCall *ModuleCall) (string, bool) {
+	if IsLocalModuleSource(moduleCall.Source) {
+		dir := filepath.Join(rootDir, moduleCall.Source)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, true
+		}
+		return "", false
+	}
+
+	raw, err := os.ReadFile(filepath.Join(rootDir, moduleManifestRelPath))
+	if err != nil {
+		return "", false
+	}
+
+	manifest := &moduleManifest{}
+	if err := json.Unmarshal(raw, manifest); err != nil {
+		return "", false
+	}
+
+	for _, record := range manifest.Modules {
+		if record.Key != moduleCall.Name {
+			continue
+		}
+		dir := record.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(rootDir, dir)
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,889 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	defaultModuleSourcePrefix = `./modules/`
+	childVariablesFileName    = `variables.tf`
+	childOutputsFileName      = `outputs.tf`
+	childVersionsFileName     = `versions.tf`
+)
+
+// ModulariseRequest represents the request parameters for moving root module resources into a child module.
+type ModulariseRequest struct {
+	RootDir      string   // RootDir is the root module directory.
+	ModuleName   string   // ModuleName is the name of the module call the resources are moved into.
+	ModuleSource string   // ModuleSource is the local source of the new module, defaults to ./modules/<ModuleName>.
+	Resources    []string // Resources lists the addresses of the root resources to move, defaults to all of them.
+}
+
+// ModulariseIssue describes a resource or reference that could not be moved automatically.
+type ModulariseIssue struct {
+	Address string     `json:"address"`
+	Reason  string     `json:"reason"`
+	Range   *hcl.Range `json:"range,omitempty"`
+}
+
+// ModulariseResult holds the outcome of a modularisation.
+type ModulariseResult struct {
+	ModuleDir    string             `json:"module_dir"`    // ModuleDir is the directory of the new child module.
+	Moved        []string           `json:"moved"`         // Moved lists the root addresses of the resources that were moved.
+	Issues       []*ModulariseIssue `json:"issues"`        // Issues lists the resources and references that need manual attention.
+	Files        map[string][]byte  `json:"-"`             // Files maps the path of each written file to its content.
+	RemovedFiles []string           `json:"removed_files"` // RemovedFiles lists the root files that were left empty and deleted.
+}
+
+// TextEdit replaces the source bytes between Start and End with Text.
+type TextEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// moduleInput represents a value the root module passes into the new child module.
+type moduleInput struct {
+	Name     string
+	Value    string
+	Variable *Variable
+}
+
+// modulariser holds the state of a single modularisation.
+type modulariser struct {
+	module      *Module
+	moduleName  string
+	moved       map[string]bool
+	blocks      map[string]*hclsyntax.Block
+	inputs      map[string]*moduleInput
+	inputNames  map[string]bool
+	outputs     map[string]string
+	outputNames map[string]bool
+	chained     map[string][][]byte
+	issues      []*ModulariseIssue
+}
+
+// ModulariseRootModule moves root module resources into a new child module. References to the moved resources are
+// rewritten to outputs of the new module, references from the moved resources to root objects are passed in as
+// input variables and a moved block is written for each managed resource, so a plan of the refactored configuration
+// against the existing state should be a no-op. Existing moved blocks that end at a moved resource are kept in front
+// of the new moved block, so that Terraform follows the whole chain. Resources that cannot be moved are left in place
+// and reported.
+func (t *tfConfigUtility) ModulariseRootModule(request ModulariseRequest) (*ModulariseResult, error) {
+	if !hclsyntax.ValidIdentifier(request.ModuleName) {
+		return nil, fmt.Errorf("invalid module name %q", request.ModuleName)
+	}
+
+	module, err := LoadModule(t.hclParser, request.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := module.ModuleCalls[request.ModuleName]; ok {
+		return nil, fmt.Errorf("the root module already calls a module named %s", request.ModuleName)
+	}
+
+	source := request.ModuleSource
+	if source == "" {
+		source = defaultModuleSourcePrefix + request.ModuleName
+	}
+	if !IsLocalModuleSource(source) {
+		return nil, fmt.Errorf("module source %s is not a local path", source)
+	}
+	moduleDir := filepath.Join(request.RootDir, source)
+	if _, err := os.Stat(moduleDir); err == nil {
+		return nil, fmt.Errorf("module directory %s already exists", moduleDir)
+	}
+	callFile := filepath.Join(request.RootDir, fmt.Sprintf("module_%s.tf", request.ModuleName))
+	if _, err := os.Stat(callFile); err == nil {
+		return nil, fmt.Errorf("file %s already exists", callFile)
+	}
+
+	m := &modulariser{
+		module:      module,
+		moduleName:  request.ModuleName,
+		moved:       make(map[string]bool),
+		blocks:      make(map[string]*hclsyntax.Block),
+		inputs:      make(map[string]*moduleInput),
+		inputNames:  make(map[string]bool),
+		outputs:     make(map[string]string),
+		outputNames: make(map[string]bool),
+		chained:     make(map[string][][]byte),
+	}
+
+	candidates := request.Resources
+	if len(candidates) == 0 {
+		candidates = append(SortedKeys(module.ManagedResources), SortedKeys(module.DataResources)...)
+	}
+	for _, addr := range candidates {
+		resource := m.resource(addr)
+		if resource == nil {
+			return nil, fmt.Errorf("resource %s is not declared in the root module", addr)
+		}
+		block := m.syntaxBlock(resource)
+		if block == nil {
+			m.addIssue(addr, "resources declared in JSON configuration files cannot be moved automatically", resource.DeclRange)
+			continue
+		}
+		m.moved[addr] = true
+		m.blocks[addr] = block
+	}
+
+	m.excludeUnmovable()
+	if len(m.moved) == 0 {
+		return nil, fmt.Errorf("none of the resources can be moved into module %s", request.ModuleName)
+	}
+
+	result := &ModulariseResult{
+		ModuleDir: moduleDir,
+		Files:     make(map[string][]byte),
+	}
+
+	// the moved blocks keep the order they are declared in
+	movedAddrs := SortedKeys(m.moved)
+	sort.SliceStable(movedAddrs, func(i, j int) bool {
+		a, b := m.resource(movedAddrs[i]).DeclRange, m.resource(movedAddrs[j]).DeclRange
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Start.Byte < b.Start.Byte
+	})
+
+	childFiles := make(map[string]*bytes.Buffer)
+	for _, addr := range movedAddrs {
+		resource := m.resource(addr)
+		src := m.module.Files[resource.DeclRange.Filename].Bytes
+		start, end := blockExtent(src, m.blocks[addr])
+
+		buf, ok := childFiles[filepath.Base(resource.DeclRange.Filename)]
+		if !ok {
+			buf = &bytes.Buffer{}
+			childFiles[filepath.Base(resource.DeclRange.Filename)] = buf
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		content, err := ApplyTextEdits(src, start, end, m.childEdits(m.blocks[addr]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to move %s: %w", addr, err)
+		}
+		buf.Write(content)
+
+		result.Moved = append(result.Moved, addr)
+	}
+
+	rootEdits := make(map[string][]TextEdit)
+	for filename, file := range m.module.Files {
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if addr := blockResourceAddr(block); addr != "" && m.moved[addr] {
+				rootEdits[filename] = append(rootEdits[filename], RemoveBlockEdit(file.Bytes, block))
+				continue
+			}
+			if key := m.movedBlockTarget(block); key != "" {
+				start, end := blockExtent(file.Bytes, block)
+				m.chained[key] = append(m.chained[key], file.Bytes[start:end])
+				rootEdits[filename] = append(rootEdits[filename], RemoveBlockEdit(file.Bytes, block))
+				continue
+			}
+			rootEdits[filename] = append(rootEdits[filename], m.rootEdits(block)...)
+		}
+	}
+
+	for _, filename := range SortedKeys(rootEdits) {
+		edits := rootEdits[filename]
+		if len(edits) == 0 {
+			continue
+		}
+		src := m.module.Files[filename].Bytes
+		content, err := ApplyTextEdits(src, 0, len(src), edits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite %s: %w", filename, err)
+		}
+		if len(bytes.TrimSpace(content)) == 0 {
+			if err := os.Remove(filename); err != nil {
+				return nil, fmt.Errorf("failed to remove file %s: %w", filename, err)
+			}
+			result.RemovedFiles = append(result.RemovedFiles, filename)
+			continue
+		}
+		if err := writeFormattedFile(filename, content, result.Files); err != nil {
+			return nil, err
+		}
+	}
+
+	variables, err := m.childVariables()
+	if err != nil {
+		return nil, err
+	}
+	appendChildFile(childFiles, childVariablesFileName, variables)
+	appendChildFile(childFiles, childOutputsFileName, m.childOutputs())
+	appendChildFile(childFiles, childVersionsFileName, m.childVersions())
+
+	if err := os.MkdirAll(moduleDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", moduleDir, err)
+	}
+	for _, name := range SortedKeys(childFiles) {
+		if err := writeFormattedFile(filepath.Join(moduleDir, name), childFiles[name].Bytes(), result.Files); err != nil {
+			return nil, err
+		}
+	}
+
+	callContent, err := m.moduleCallFile(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFormattedFile(callFile, callContent, result.Files); err != nil {
+		return nil, err
+	}
+
+	result.Issues = m.issues
+	return result, nil
+}
+
+// resource returns the root resource with the given address, or nil if there is none.
+func (m *modulariser) resource(addr string) *Resource {
+	if resource, ok := m.module.ManagedResources[addr]; ok {
+		return resource
+	}
+	return m.module.DataResources[addr]
+}
+
+// syntaxBlock returns the native syntax block a resource is declared in, or nil for JSON configuration.
+func (m *modulariser) syntaxBlock(resource *Resource) *hclsyntax.Block {
+	body, ok := m.module.Files[resource.DeclRange.Filename].Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+	for _, block := range body.Blocks {
+		if block.DefRange().Start.Byte == resource.DeclRange.Start.Byte {
+			return block
+		}
+	}
+	return nil
+}
+
+func (m *modulariser) addIssue(addr string, reason string, rng hcl.Range) {
+	m.issues = append(m.issues, &ModulariseIssue{
+		Address: addr,
+		Reason:  reason,
+		Range:   rng.Ptr(),
+	})
+}
+
+// excludeUnmovable drops the resources that depend on the root module in ways that cannot be expressed across a
+// module boundary. depends_on and replace_triggered_by can only refer to objects in the same module, so resources
+// are kept together with everything they list there, until no more resources are dropped.
+func (m *modulariser) excludeUnmovable() {
+	for changed := true; changed; {
+		changed = false
+		for _, addr := range SortedKeys(m.moved) {
+			if !m.moved[addr] {
+				continue
+			}
+			for _, ref := range lifecycleReferences(m.blocks[addr]) {
+				key, _ := m.referenceKey(ref.Traversal)
+				if key != "" && m.moved[key] {
+					continue
+				}
+				m.addIssue(addr, fmt.Sprintf("refers to %s in depends_on or replace_triggered_by, which stays in the root module", TraversalString(ref.Traversal)), ref.SrcRange)
+				delete(m.moved, addr)
+				changed = true
+				break
+			}
+		}
+
+		// root resources can only trigger replacement from resources in the same module
+		for _, file := range m.module.Files {
+			body, ok := file.Body.(*hclsyntax.Body)
+			if !ok {
+				continue
+			}
+			for _, block := range body.Blocks {
+				addr := blockResourceAddr(block)
+				if addr == "" || m.moved[addr] {
+					continue
+				}
+				for _, ref := range replaceTriggeredByReferences(block) {
+					key, _ := m.referenceKey(ref.Traversal)
+					if key == "" || !m.moved[key] {
+						continue
+					}
+					m.addIssue(key, fmt.Sprintf("is listed in replace_triggered_by of %s, which stays in the root module", addr), ref.SrcRange)
+					delete(m.moved, key)
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// referenceKey returns the root module object a reference refers to, such as "var.x", "aws_vpc.main" or
+// "data.aws_ami.ubuntu", and the number of traversal steps that name it. The key is empty for references
+// that mean the same in every module, such as count.index or terraform.workspace.
+func (m *modulariser) referenceKey(traversal hcl.Traversal) (string, int) {
+	names := traversalNames(traversal)
+	if len(names) < 2 {
+		return "", 0
+	}
+
+	switch names[0] {
+	case "var", "local", "module":
+		return names[0] + "." + names[1], 2
+	case "path":
+		if names[1] == "module" {
+			return "path.module", 2
+		}
+		return "", 0
+	case "data":
+		if len(names) < 3 {
+			return "", 0
+		}
+		return "data." + names[1] + "." + names[2], 3
+	case "count", "each", "self", "terraform":
+		return "", 0
+	}
+
+	key := names[0] + "." + names[1]
+	if _, ok := m.module.ManagedResources[key]; ok {
+		return key, 2
+	}
+	return "", 0
+}
+
+// movedBlockTarget returns the moved resource a root moved block ends at, or the empty string if the block is not
+// a moved block or ends at anything else.
+func (m *modulariser) movedBlockTarget(block *hclsyntax.Block) string {
+	if block.Type != "moved" {
+		return ""
+	}
+	attr, ok := block.Body.Attributes["to"]
+	if !ok {
+		return ""
+	}
+	traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+	if diags.HasErrors() {
+		return ""
+	}
+	if key, _ := m.referenceKey(traversal); key != "" && m.moved[key] && m.module.ManagedResources[key] != nil {
+		return key
+	}
+	return ""
+}
+
+// childEdits rewrites the references of a moved block to root module objects into input variable references.
+func (m *modulariser) childEdits(block *hclsyntax.Block) []TextEdit {
+	var edits []TextEdit
+	for _, expr := range blockReferenceExprs(block.Body, true) {
+		key, steps := m.referenceKey(expr.Traversal)
+		if key == "" || m.moved[key] {
+			continue
+		}
+
+		input := m.input(key)
+		if key == "var."+input.Name {
+			continue
+		}
+		edits = append(edits, TextEdit{
+			Start: expr.Traversal[0].SourceRange().Start.Byte,
+			End:   expr.Traversal[steps-1].SourceRange().End.Byte,
+			Text:  "var." + input.Name,
+		})
+	}
+	return edits
+}
+
+// rootEdits rewrites the references of a block staying in the root module to moved resources into references
+// to outputs of the new module.
+func (m *modulariser) rootEdits(block *hclsyntax.Block) []TextEdit {
+	var edits []TextEdit
+	switch block.Type {
+	case "moved", "removed", "variable", "terraform":
+		return nil
+	case "import":
+		// import targets are addresses rather than references, so they move along with the resource
+		if attr, ok := block.Body.Attributes["to"]; ok {
+			if traversal, diags := hcl.AbsTraversalForExpr(attr.Expr); !diags.HasErrors() {
+				if key, _ := m.referenceKey(traversal); key != "" && m.moved[key] {
+					start := traversal[0].SourceRange().Start.Byte
+					edits = append(edits, TextEdit{Start: start, End: start, Text: fmt.Sprintf("module.%s.", m.moduleName)})
+				}
+			}
+		}
+		if attr, ok := block.Body.Attributes["for_each"]; ok {
+			edits = append(edits, m.outputEdits(ExprReferences(attr.Expr))...)
+		}
+		if attr, ok := block.Body.Attributes["id"]; ok {
+			edits = append(edits, m.outputEdits(ExprReferences(attr.Expr))...)
+		}
+		return edits
+	}
+
+	if attr, ok := block.Body.Attributes["depends_on"]; ok {
+		if exprs, diags := hcl.ExprList(attr.Expr); !diags.HasErrors() {
+			for _, expr := range exprs {
+				traversal, diags := hcl.AbsTraversalForExpr(expr)
+				if diags.HasErrors() {
+					continue
+				}
+				if key, _ := m.referenceKey(traversal); key != "" && m.moved[key] {
+					edits = append(edits, TextEdit{
+						Start: expr.Range().Start.Byte,
+						End:   expr.Range().End.Byte,
+						Text:  "module." + m.moduleName,
+					})
+				}
+			}
+		}
+	}
+
+	return append(edits, m.outputEdits(blockReferenceExprs(block.Body, true))...)
+}
+
+// outputEdits rewrites references to moved resources into references to outputs of the new module.
+func (m *modulariser) outputEdits(exprs []*hclsyntax.ScopeTraversalExpr) []TextEdit {
+	var edits []TextEdit
+	for _, expr := range exprs {
+		key, steps := m.referenceKey(expr.Traversal)
+		if key == "" || !m.moved[key] {
+			continue
+		}
+		edits = append(edits, TextEdit{
+			Start: expr.Traversal[0].SourceRange().Start.Byte,
+			End:   expr.Traversal[steps-1].SourceRange().End.Byte,
+			Text:  fmt.Sprintf("module.%s.%s", m.moduleName, m.output(key)),
+		})
+	}
+	return edits
+}
+
+// input returns the input variable that passes the given root module object into the new module.
+func (m *modulariser) input(key string) *moduleInput {
+	if input, ok := m.inputs[key]; ok {
+		return input
+	}
+
+	input := &moduleInput{Value: key}
+	name := strings.ReplaceAll(key, ".", "_")
+	switch {
+	case strings.HasPrefix(key, "var."):
+		name = strings.TrimPrefix(key, "var.")
+		input.Variable = m.module.Variables[name]
+	case strings.HasPrefix(key, "local."):
+		name = strings.TrimPrefix(key, "local.")
+	}
+	input.Name = uniqueName(name, m.inputNames)
+	m.inputs[key] = input
+	return input
+}
+
+// output returns the name of the output that exposes the given moved resource to the root module.
+func (m *modulariser) output(key string) string {
+	if name, ok := m.outputs[key]; ok {
+		return name
+	}
+	name := uniqueName(strings.ReplaceAll(key, ".", "_"), m.outputNames)
+	m.outputs[key] = name
+	return name
+}
+
+// childVariables renders the variable blocks of the new module. Root variables are copied as declared, renamed
+// together with the references to them in their validation blocks if their name is taken, and every other root
+// object is passed in as an untyped variable.
+func (m *modulariser) childVariables() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, key := range SortedKeys(m.inputs) {
+		input := m.inputs[key]
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		if input.Variable != nil {
+			file := m.module.Files[input.Variable.DeclRange.Filename]
+			if body, ok := file.Body.(*hclsyntax.Body); ok {
+				for _, block := range body.Blocks {
+					if block.Type == "variable" && block.DefRange().Start.Byte == input.Variable.DeclRange.Start.Byte {
+						start, end := blockExtent(file.Bytes, block)
+						content, err := ApplyTextEdits(file.Bytes, start, end, renameVariableEdits(block, input.Name))
+						if err != nil {
+							return nil, fmt.Errorf("failed to copy variable %s: %w", input.Variable.Name, err)
+						}
+						buf.Write(content)
+						break
+					}
+				}
+				continue
+			}
+		}
+		fmt.Fprintf(&buf, "variable %q {\n  description = %q\n}\n", input.Name, fmt.Sprintf("The value of %s in the root module.", input.Value))
+	}
+	return buf.Bytes(), nil
+}
+
+// renameVariableEdits returns the edits that rename a variable block, including the references to the variable
+// in its validation blocks.
+func renameVariableEdits(block *hclsyntax.Block, name string) []TextEdit {
+	edits := []TextEdit{{
+		Start: block.LabelRanges[0].Start.Byte,
+		End:   block.LabelRanges[0].End.Byte,
+		Text:  fmt.Sprintf("%q", name),
+	}}
+	if block.Labels[0] == name {
+		return edits
+	}
+	for _, nested := range block.Body.Blocks {
+		if nested.Type != "validation" {
+			continue
+		}
+		for _, expr := range blockReferenceExprs(nested.Body, false) {
+			names := traversalNames(expr.Traversal)
+			if len(names) < 2 || names[0] != "var" || names[1] != block.Labels[0] {
+				continue
+			}
+			rng := expr.Traversal[1].SourceRange()
+			edits = append(edits, TextEdit{Start: rng.Start.Byte, End: rng.End.Byte, Text: "." + name})
+		}
+	}
+	return edits
+}
+
+// childOutputs renders the output blocks exposing the moved resources referenced from the root module.
+func (m *modulariser) childOutputs() []byte {
+	var buf bytes.Buffer
+	for _, key := range SortedKeys(m.outputs) {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "output %q {\n  value = %s\n}\n", m.outputs[key], key)
+	}
+	return buf.Bytes()
+}
+
+// childVersions renders the required_providers of the new module, including the configuration aliases of the
+// aliased provider configurations used by the moved resources.
+func (m *modulariser) childVersions() []byte {
+	aliases := make(map[string][]string)
+	for addr := range m.moved {
+		resource := m.resource(addr)
+		name := resource.ProviderLocalName()
+		if _, ok := aliases[name]; !ok {
+			aliases[name] = nil
+		}
+		if config := resource.ProviderConfigAddr(); config != name && !slices.Contains(aliases[name], config) {
+			aliases[name] = append(aliases[name], config)
+		}
+	}
+
+	file := hclwrite.NewEmptyFile()
+	requiredProviders := file.Body().AppendNewBlock("terraform", nil).Body().AppendNewBlock("required_providers", nil).Body()
+	for _, name := range SortedKeys(aliases) {
+		if IsBuiltinProviderSource(m.module.ProviderSource(name)) {
+			continue
+		}
+
+		attrs := []hclwrite.ObjectAttrTokens{{
+			Name:  hclwrite.TokensForIdentifier("source"),
+			Value: hclwrite.TokensForValue(cty.StringVal(providerSourceForChild(m.module, name))),
+		}}
+		if requiredProvider, ok := m.module.RequiredProviders[name]; ok && requiredProvider.Requirement != "" {
+			attrs = append(attrs, hclwrite.ObjectAttrTokens{
+				Name:  hclwrite.TokensForIdentifier("version"),
+				Value: hclwrite.TokensForValue(cty.StringVal(requiredProvider.Requirement)),
+			})
+		}
+		if len(aliases[name]) > 0 {
+			sort.Strings(aliases[name])
+			var traversals []hclwrite.Tokens
+			for _, alias := range aliases[name] {
+				local, aliasName, _ := strings.Cut(alias, ".")
+				traversals = append(traversals, hclwrite.TokensForTraversal(hcl.Traversal{
+					hcl.TraverseRoot{Name: local},
+					hcl.TraverseAttr{Name: aliasName},
+				}))
+			}
+			attrs = append(attrs, hclwrite.ObjectAttrTokens{
+				Name:  hclwrite.TokensForIdentifier("configuration_aliases"),
+				Value: hclwrite.TokensForTuple(traversals),
+			})
+		}
+		requiredProviders.SetAttributeRaw(name, hclwrite.TokensForObject(attrs))
+	}
+
+	return file.Bytes()
+}
+
+// moduleCallFile renders the module block calling the new module and the moved blocks for the managed resources,
+// each preceded by the existing moved blocks that end at the resource.
+func (m *modulariser) moduleCallFile(source string) ([]byte, error) {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body().AppendNewBlock("module", []string{m.moduleName}).Body()
+	body.SetAttributeValue("source", cty.StringVal(source))
+
+	for _, key := range SortedKeys(m.inputs) {
+		input := m.inputs[key]
+		body.SetAttributeRaw(input.Name, hclwrite.TokensForTraversal(TraversalFromAddr(key)))
+	}
+
+	// an explicit providers argument disables the implicit inheritance of the default configurations,
+	// so it is only written when aliased configurations have to be passed and then lists all of them
+	configs := make(map[string]bool)
+	aliased := false
+	for addr := range m.moved {
+		config := m.resource(addr).ProviderConfigAddr()
+		configs[config] = true
+		aliased = aliased || strings.Contains(config, ".")
+	}
+	if aliased {
+		var providers []hclwrite.ObjectAttrTokens
+		for _, config := range SortedKeys(configs) {
+			traversal := hclwrite.TokensForTraversal(TraversalFromAddr(config))
+			providers = append(providers, hclwrite.ObjectAttrTokens{Name: traversal, Value: traversal})
+		}
+		body.SetAttributeRaw("providers", hclwrite.TokensForObject(providers))
+	}
+
+	for _, addr := range SortedKeys(m.moved) {
+		if m.module.ManagedResources[addr] == nil {
+			// data resources are read again on every plan and have nothing to move
+			continue
+		}
+		for _, src := range m.chained[addr] {
+			chained, diags := hclwrite.ParseConfig(src, "", hcl.InitialPos)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("failed to copy the moved blocks ending at %s: %v", addr, diags.Error())
+			}
+			file.Body().AppendNewline()
+			file.Body().AppendUnstructuredTokens(chained.BuildTokens(nil))
+		}
+		file.Body().AppendNewline()
+		moved := file.Body().AppendNewBlock("moved", nil).Body()
+		moved.SetAttributeTraversal("from", TraversalFromAddr(addr))
+		moved.SetAttributeTraversal("to", TraversalFromAddr(fmt.Sprintf("module.%s.%s", m.moduleName, addr)))
+	}
+
+	return file.Bytes(), nil
+}
+
+// blockResourceAddr returns the address of a resource or data block, or the empty string for any other block.
+func blockResourceAddr(block *hclsyntax.Block) string {
+	if len(block.Labels) != 2 {
+		return ""
+	}
+	switch block.Type {
+	case "resource":
+		return block.Labels[0] + "." + block.Labels[1]
+	case "data":
+		return "data." + block.Labels[0] + "." + block.Labels[1]
+	}
+	return ""
+}
+
+// blockReferenceExprs returns all the references in a block body, skipping the arguments that hold addresses
+// rather than references: depends_on, provider, providers and the lifecycle arguments.
+func blockReferenceExprs(body *hclsyntax.Body, topLevel bool) []*hclsyntax.ScopeTraversalExpr {
+	var exprs []*hclsyntax.ScopeTraversalExpr
+	for _, name := range SortedKeys(body.Attributes) {
+		if topLevel && (name == "depends_on" || name == "provider" || name == "providers") {
+			continue
+		}
+		exprs = append(exprs, ExprReferences(body.Attributes[name].Expr)...)
+	}
+	for _, block := range body.Blocks {
+		if block.Type == "lifecycle" {
+			// only the nested condition blocks of lifecycle hold references
+			for _, nested := range block.Body.Blocks {
+				exprs = append(exprs, blockReferenceExprs(nested.Body, false)...)
+			}
+			continue
+		}
+		exprs = append(exprs, blockReferenceExprs(block.Body, false)...)
+	}
+	return exprs
+}
+
+// ExprReferences returns all the references in an expression.
+func ExprReferences(expr hclsyntax.Expression) []*hclsyntax.ScopeTraversalExpr {
+	var exprs []*hclsyntax.ScopeTraversalExpr
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		if traversal, ok := node.(*hclsyntax.ScopeTraversalExpr); ok {
+			exprs = append(exprs, traversal)
+		}
+		return nil
+	})
+	return exprs
+}
+
+// lifecycleReferences returns the references of a resource block that must stay within the same module,
+// those in depends_on and replace_triggered_by.
+func lifecycleReferences(block *hclsyntax.Block) []*hclsyntax.ScopeTraversalExpr {
+	var exprs []*hclsyntax.ScopeTraversalExpr
+	if attr, ok := block.Body.Attributes["depends_on"]; ok {
+		exprs = append(exprs, ExprReferences(attr.Expr)...)
+	}
+	return append(exprs, replaceTriggeredByReferences(block)...)
+}
+
+// replaceTriggeredByReferences returns the references in the replace_triggered_by argument of a resource block.
+func replaceTriggeredByReferences(block *hclsyntax.Block) []*hclsyntax.ScopeTraversalExpr {
+	var exprs []*hclsyntax.ScopeTraversalExpr
+	for _, nested := range block.Body.Blocks {
+		if nested.Type != "lifecycle" {
+			continue
+		}
+		if attr, ok := nested.Body.Attributes["replace_triggered_by"]; ok {
+			exprs = append(exprs, ExprReferences(attr.Expr)...)
+		}
+	}
+	return exprs
+}
+
+// traversalNames returns the leading root and attribute names of a traversal, stopping at the first index step.
+func traversalNames(traversal hcl.Traversal) []string {
+	var names []string
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, s.Name)
+		case hcl.TraverseAttr:
+			names = append(names, s.Name)
+		default:
+			return names
+		}
+	}
+	return names
+}
+
+// TraversalFromAddr builds a traversal from a dotted address without index keys, such as "module.app.aws_vpc.main".
+func TraversalFromAddr(addr string) hcl.Traversal {
+	parts := strings.Split(addr, ".")
+	traversal := hcl.Traversal{hcl.TraverseRoot{Name: parts[0]}}
+	for _, part := range parts[1:] {
+		traversal = append(traversal, hcl.TraverseAttr{Name: part})
+	}
+	return traversal
+}
+
+// blockExtent returns the byte range of a block including the comment lines directly above it and the
+// trailing newline, so the block can be cut out of its file cleanly.
+func blockExtent(src []byte, block *hclsyntax.Block) (int, int) {
+	start := block.Range().Start.Byte
+	end := block.Range().End.Byte
+	if end < len(src) && src[end] == '\n' {
+		end++
+	}
+
+	start = bytes.LastIndexByte(src[:start], '\n') + 1
+	for start > 0 {
+		prevStart := bytes.LastIndexByte(src[:start-1], '\n') + 1
+		line := strings.TrimSpace(string(src[prevStart : start-1]))
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
+			break
+		}
+		start = prevStart
+	}
+
+	return start, end
+}
+
+// skipBlankLines returns the position after the blank lines starting at pos.
+func skipBlankLines(src []byte, pos int) int {
+	for pos < len(src) {
+		next := bytes.IndexByte(src[pos:], '\n')
+		if next < 0 || len(bytes.TrimSpace(src[pos:pos+next])) > 0 {
+			break
+		}
+		pos += next + 1
+	}
+	return pos
+}
+
+// RemoveBlockEdit returns the edit that cuts a block out of its file, together with the comment lines directly
+// above it and the blank lines following it.
+func RemoveBlockEdit(src []byte, block *hclsyntax.Block) TextEdit {
+	start, end := blockExtent(src, block)
+	return TextEdit{Start: start, End: skipBlankLines(src, end)}
+}
+
+// ApplyTextEdits returns the source bytes between start and end with the given edits applied.
+// It returns an error if an edit overlaps another one or lies outside the range.
+func ApplyTextEdits(src []byte, start, end int, edits []TextEdit) ([]byte, error) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].Start < edits[j].Start
+	})
+
+	var buf bytes.Buffer
+	pos := start
+	for _, edit := range edits {
+		if edit.Start > edit.End || edit.Start < start || edit.End > end {
+			return nil, fmt.Errorf("the edit of bytes %d to %d lies outside of bytes %d to %d", edit.Start, edit.End, start, end)
+		}
+		if edit.Start < pos {
+			return nil, fmt.Errorf("the edit of bytes %d to %d overlaps the edit ending at byte %d", edit.Start, edit.End, pos)
+		}
+		buf.Write(src[pos:edit.Start])
+		buf.WriteString(edit.Text)
+		pos = edit.End
+	}
+	buf.Write(src[pos:end])
+	return buf.Bytes(), nil
+}
+
+// appendChildFile appends generated content to a file of the new module.
+func appendChildFile(files map[string]*bytes.Buffer, name string, content []byte) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return
+	}
+	buf, ok := files[name]
+	if !ok {
+		buf = &bytes.Buffer{}
+		files[name] = buf
+	}
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+	buf.Write(content)
+}
+
+// writeFormattedFile formats and writes a configuration file and records its content.
+func writeFormattedFile(path string, content []byte, written map[string][]byte) error {
+	content = hclwrite.Format(content)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	written[path] = content
+	return nil
+}
+
+// providerSourceForChild returns the source address of a provider as declared in the root module,
+// falling back to the implied hashicorp provider.
+func providerSourceForChild(module *Module, name string) string {
+	if requiredProvider, ok := module.RequiredProviders[name]; ok && requiredProvider.Source != "" {
+		return requiredProvider.Source
+	}
+	return defaultProviderNamespace + "/" + name
+}
+
+// uniqueName returns name, or name with a numeric suffix if it is already taken, and marks it as taken.
+func uniqueName(name string, taken map[string]bool) string {
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	taken[candidate] = true
+	return candidate
+}
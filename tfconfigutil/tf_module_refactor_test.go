@@ -0,0 +1,281 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+const modulariseRootConfig = `
+variable "name" {
+  type = string
+
+  validation {
+    condition     = length(var.name) > 0
+    error_message = "The name of var.name must not be empty."
+  }
+}
+
+locals {
+  name = "${var.name}-bucket"
+}
+
+resource "aws_s3_bucket" "a" {
+  acl    = local.name
+  bucket = var.name
+}
+
+resource "aws_s3_bucket_policy" "a" {
+  bucket = aws_s3_bucket.a.id
+  policy = "{}"
+}
+
+resource "aws_s3_bucket" "kept" {
+  bucket = aws_s3_bucket.a.bucket
+}
+
+output "bucket" {
+  value = aws_s3_bucket.a.arn
+}
+`
+
+const modulariseMovedConfig = `
+moved {
+  from = aws_s3_bucket.old
+  to   = aws_s3_bucket.a
+}
+`
+
+func writeModulariseRoot(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(modulariseRootConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "moved.tf"), []byte(modulariseMovedConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// resolveMoves follows the moved blocks from a state address to the address it ends at.
+func resolveMoves(t *testing.T, moved []*Moved, addr string) string {
+	t.Helper()
+
+	for range len(moved) + 1 {
+		next := ""
+		for _, m := range moved {
+			if TraversalString(m.From) == addr {
+				if next != "" {
+					t.Fatalf("more than one moved block starts at %s", addr)
+				}
+				next = TraversalString(m.To)
+			}
+		}
+		if next == "" {
+			return addr
+		}
+		addr = next
+	}
+	t.Fatalf("the moved blocks starting at %s form a cycle", addr)
+	return ""
+}
+
+func TestModulariseRootModule_PlanIsNoOp(t *testing.T) {
+	dir := writeModulariseRoot(t)
+
+	result, err := NewTfConfigUtility(context.Background()).ModulariseRootModule(ModulariseRequest{
+		RootDir:    dir,
+		ModuleName: "storage",
+		Resources:  []string{"aws_s3_bucket.a", "aws_s3_bucket_policy.a"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Issues) > 0 {
+		t.Fatalf("unexpected issues: %+v", result.Issues[0])
+	}
+
+	root, err := LoadModule(hclparse.NewParser(), dir)
+	if err != nil {
+		t.Fatalf("failed to load the refactored root module: %v", err)
+	}
+	child, err := LoadModule(hclparse.NewParser(), result.ModuleDir)
+	if err != nil {
+		t.Fatalf("failed to load the new module: %v", err)
+	}
+
+	// every address of the existing state must end at a resource that is still declared
+	declared := func(addr string) bool {
+		if childAddr, ok := strings.CutPrefix(addr, "module.storage."); ok {
+			return child.ManagedResources[childAddr] != nil
+		}
+		return root.ManagedResources[addr] != nil
+	}
+	for stateAddr, want := range map[string]string{
+		"aws_s3_bucket.old":      "module.storage.aws_s3_bucket.a",
+		"aws_s3_bucket.a":        "module.storage.aws_s3_bucket.a",
+		"aws_s3_bucket_policy.a": "module.storage.aws_s3_bucket_policy.a",
+		"aws_s3_bucket.kept":     "aws_s3_bucket.kept",
+	} {
+		got := resolveMoves(t, root.Moved, stateAddr)
+		if got != want {
+			t.Errorf("%s moves to %s, want %s", stateAddr, got, want)
+		}
+		if !declared(got) {
+			t.Errorf("%s moves to %s, which is not declared", stateAddr, got)
+		}
+	}
+
+	// every reference across the module boundary must resolve
+	for _, resource := range child.ManagedResources {
+		for _, traversal := range bodyTraversals(t, resource.Config) {
+			if traversal.RootName() == "var" {
+				name := traversal[1].(hcl.TraverseAttr).Name
+				if child.Variables[name] == nil {
+					t.Errorf("%s.%s refers to the undeclared variable %s", resource.Type, resource.Name, name)
+				}
+			}
+		}
+	}
+	call := root.ModuleCalls["storage"]
+	if call == nil {
+		t.Fatal("the root module does not call the new module")
+	}
+	for name := range child.Variables {
+		if _, ok := call.Inputs[name]; !ok {
+			t.Errorf("the module call does not set the variable %s", name)
+		}
+	}
+	var rootTraversals []hcl.Traversal
+	for _, resource := range root.ManagedResources {
+		rootTraversals = append(rootTraversals, bodyTraversals(t, resource.Config)...)
+	}
+	for _, output := range root.Outputs {
+		rootTraversals = append(rootTraversals, output.Expr.Variables()...)
+	}
+	for _, traversal := range rootTraversals {
+		switch traversal.RootName() {
+		case "module":
+			name := traversal[2].(hcl.TraverseAttr).Name
+			if child.Outputs[name] == nil {
+				t.Errorf("the root module refers to the undeclared output %s", name)
+			}
+		case "aws_s3_bucket", "aws_s3_bucket_policy":
+			addr := traversal.RootName() + "." + traversal[1].(hcl.TraverseAttr).Name
+			if root.ManagedResources[addr] == nil {
+				t.Errorf("the root module still refers to the moved resource %s", addr)
+			}
+		}
+	}
+}
+
+func TestModulariseRootModule_ChainsExistingMovedBlocks(t *testing.T) {
+	dir := writeModulariseRoot(t)
+
+	result, err := NewTfConfigUtility(context.Background()).ModulariseRootModule(ModulariseRequest{
+		RootDir:    dir,
+		ModuleName: "storage",
+		Resources:  []string{"aws_s3_bucket.a"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "moved.tf")); !os.IsNotExist(err) {
+		t.Errorf("the emptied moved.tf was not removed")
+	}
+
+	callFile := string(result.Files[filepath.Join(dir, "module_storage.tf")])
+	existing := strings.Index(callFile, "from = aws_s3_bucket.old")
+	generated := strings.Index(callFile, "from = aws_s3_bucket.a")
+	if existing < 0 || generated < 0 || existing > generated {
+		t.Errorf("the existing moved block is not kept in front of the new one:\n%s", callFile)
+	}
+}
+
+func TestModulariseRootModule_RenamesVariableValidations(t *testing.T) {
+	dir := writeModulariseRoot(t)
+
+	result, err := NewTfConfigUtility(context.Background()).ModulariseRootModule(ModulariseRequest{
+		RootDir:    dir,
+		ModuleName: "storage",
+		Resources:  []string{"aws_s3_bucket.a"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	src := result.Files[filepath.Join(result.ModuleDir, childVariablesFileName)]
+	file, diags := hclsyntax.ParseConfig(src, childVariablesFileName, hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse the variables of the new module: %s", diags.Error())
+	}
+
+	names := make(map[string]bool)
+	validated := 0
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		names[block.Labels[0]] = true
+		for _, validation := range block.Body.Blocks {
+			validated++
+			for _, traversal := range validation.Body.Attributes["condition"].Expr.Variables() {
+				if got := traversal[1].(hcl.TraverseAttr).Name; got != block.Labels[0] {
+					t.Errorf("the validation of variable %s refers to var.%s", block.Labels[0], got)
+				}
+			}
+		}
+	}
+	if !names["name"] || !names["name_2"] || validated != 1 {
+		t.Errorf("expected the variable and the local named name as inputs, got %v", names)
+	}
+	if !strings.Contains(string(src), "The name of var.name must not be empty.") {
+		t.Errorf("the error message was rewritten:\n%s", src)
+	}
+}
+
+func TestApplyTextEdits(t *testing.T) {
+	src := []byte("0123456789")
+
+	got, err := ApplyTextEdits(src, 2, 8, []TextEdit{{Start: 5, End: 6, Text: "x"}, {Start: 2, End: 3, Text: "y"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "y34x67" {
+		t.Errorf("got %q, want %q", got, "y34x67")
+	}
+
+	for name, edits := range map[string][]TextEdit{
+		"overlap":        {{Start: 3, End: 5}, {Start: 4, End: 6}},
+		"before start":   {{Start: 1, End: 3}},
+		"after end":      {{Start: 7, End: 9}},
+		"reversed range": {{Start: 5, End: 4}},
+	} {
+		if _, err := ApplyTextEdits(src, 2, 8, edits); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func bodyTraversals(t *testing.T, body hcl.Body) []hcl.Traversal {
+	t.Helper()
+
+	syntaxBody, ok := body.(*hclsyntax.Body)
+	if !ok {
+		t.Fatalf("unexpected body type %T", body)
+	}
+	var traversals []hcl.Traversal
+	for _, attr := range syntaxBody.Attributes {
+		traversals = append(traversals, attr.Expr.Variables()...)
+	}
+	return traversals
+}
@@ -0,0 +1,206 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	versionExpression           = `^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`
+	versionConstraintExpression = `^(=|!=|>=|<=|>|<|~>)?\s*(.+)$`
+)
+
+// Version is a provider version number, for example `5.31.0` or `1.0.0-beta1`.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	segments   int // segments is the number of release segments that were written, used by the ~> operator.
+}
+
+// ParseVersion parses a version number. Missing minor and patch segments default to zero.
+func ParseVersion(s string) (Version, error) {
+	matches := regexp.MustCompile(versionExpression).FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	v := Version{Prerelease: matches[4]}
+	for i, segment := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if matches[i+1] == "" {
+			break
+		}
+		n, err := strconv.Atoi(matches[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		*segment = n
+		v.segments++
+	}
+	return v, nil
+}
+
+// String returns the version in its canonical form, for example `5.31.0`.
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower than, equal to or higher than o.
+// A prerelease is lower than the release of the same version, and prereleases are ordered as in semantic versioning.
+func (v Version) Compare(o Version) int {
+	for _, pair := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	default:
+		return comparePrerelease(v.Prerelease, o.Prerelease)
+	}
+}
+
+// comparePrerelease compares two prerelease tags by their dot separated identifiers. Numeric identifiers compare
+// numerically and lower than alphanumeric ones, which compare in ASCII order, and a tag that is a prefix of the
+// other is lower, so `alpha` < `alpha.1` < `alpha.beta` < `beta.2` < `beta.11` < `rc.1`.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if cmp := strings.Compare(as[i], bs[i]); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// versionConstraint is a single operator and version of a constraint string.
+type versionConstraint struct {
+	op      string
+	version Version
+}
+
+// VersionConstraints is a parsed version constraint string, such as `>= 1.2.0, < 2.0.0`.
+// A version must satisfy all the constraints.
+type VersionConstraints []versionConstraint
+
+// ParseVersionConstraints parses a comma separated version constraint string with the operators Terraform
+// supports in required_providers. An empty string allows every release.
+func ParseVersionConstraints(s string) (VersionConstraints, error) {
+	var constraints VersionConstraints
+	constraintRegex := regexp.MustCompile(versionConstraintExpression)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		matches := constraintRegex.FindStringSubmatch(part)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid version constraint %q", part)
+		}
+		version, err := ParseVersion(matches[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", part, err)
+		}
+		op := matches[1]
+		if op == "" {
+			op = "="
+		}
+		constraints = append(constraints, versionConstraint{op: op, version: version})
+	}
+	return constraints, nil
+}
+
+// Allows reports whether the version satisfies every constraint. As in Terraform, a prerelease is only allowed
+// by a constraint that requests exactly that version.
+func (c VersionConstraints) Allows(v Version) bool {
+	if v.Prerelease != "" {
+		exact := false
+		for _, constraint := range c {
+			if constraint.op == "=" && constraint.version.Compare(v) == 0 {
+				exact = true
+			}
+		}
+		if !exact {
+			return false
+		}
+	}
+
+	for _, constraint := range c {
+		cmp := v.Compare(constraint.version)
+		var ok bool
+		switch constraint.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			ok = cmp >= 0 && v.Compare(constraint.version.pessimisticBound()) < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// pessimisticBound returns the exclusive upper bound of the ~> operator, which allows only the rightmost
+// written segment to increase, for example `2.0.0` for `~> 1.2` and `1.3.0` for `~> 1.2.3`.
+func (v Version) pessimisticBound() Version {
+	switch v.segments {
+	case 3:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return Version{Major: v.Major + 1}
+	}
+}
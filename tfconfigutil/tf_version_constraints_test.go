@@ -0,0 +1,48 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfconfigutil
+
+import (
+	"testing"
+)
+
+func TestVersion_Compare(t *testing.T) {
+	// each version is lower than the next one
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"2.0.0",
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			a, err := ParseVersion(ordered[i])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			b, err := ParseVersion(ordered[j])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s compared to %s is %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	componentAddressPrefix = `component.`
+	dependencySourceState  = `state`
+	dependencySourceConfig = `config`
+	moduleOutputsFileName  = `outputs.tf`
+)
+
+// ComponentAssignment decides which component each state resource belongs to, using the same mappings
+// MigrateTFState accepts. When both maps are empty every top-level module becomes a component of the same name.
+type ComponentAssignment struct {
+	ResourceAddressMap map[string]string `json:"resource_address_map"` // ResourceAddressMap maps resource or resource instance addresses to component addresses.
+	ModuleAddressMap   map[string]string `json:"module_address_map"`   // ModuleAddressMap maps top-level module names to component names.
+}
+
+// ComponentDependencyRequest represents the request parameters for analysing the dependencies between components.
+type ComponentDependencyRequest struct {
+	StateFilePath               string              // StateFilePath is an optional path to the state file, otherwise the state is pulled from the configured backend.
+	TerraformConfigFilesAbsPath string              // TerraformConfigFilesAbsPath is the absolute path to the directory containing the root module.
+	Assignment                  ComponentAssignment // Assignment decides which component each resource belongs to.
+	WriteOutputs                bool                // WriteOutputs appends the proposed outputs to the outputs.tf file of the module sources that are available locally.
+}
+
+// ComponentDependencyEdge represents a dependency between two resources, or two module calls, that belong to
+// different components.
+type ComponentDependencyEdge struct {
+	From          string `json:"from"`
+	FromComponent string `json:"from_component"`
+	To            string `json:"to"`
+	ToComponent   string `json:"to_component"`
+	Source        string `json:"source"` // Source is either "state" for instance dependencies or "config" for module output references.
+	Wired         bool   `json:"wired"`  // Wired reports whether the configuration already passes a value of the dependency into the dependent component.
+}
+
+// ProposedComponentInput is an input a component needs to keep a dependency on another component.
+type ProposedComponentInput struct {
+	Component  string   `json:"component"`
+	Name       string   `json:"name"`
+	Value      string   `json:"value"`
+	Dependents []string `json:"dependents"`
+}
+
+// ProposedModuleOutput is an output a module must declare so that another component can depend on its resources.
+type ProposedModuleOutput struct {
+	Component string `json:"component"`
+	Dir       string `json:"dir,omitempty"` // Dir is the module source directory, empty when it is not available locally.
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Existing  bool   `json:"existing"` // Existing reports whether the module already declares the output.
+	Written   bool   `json:"written"`  // Written reports whether the output was appended to the module source.
+}
+
+// ComponentDependencyReport is the result of analysing the dependencies between components.
+type ComponentDependencyReport struct {
+	Edges      []*ComponentDependencyEdge `json:"edges"`
+	Inputs     []*ProposedComponentInput  `json:"inputs"`
+	Outputs    []*ProposedModuleOutput    `json:"outputs"`
+	Unresolved []string                   `json:"unresolved"`
+}
+
+// AnalyzeComponentDependencies builds the resource dependency graph from the instance dependencies in the state and
+// the module output references in the root module, and lists the edges that cross component boundaries. For every
+// edge the configuration does not already wire, it proposes a component.<name>.<output> input on the dependent
+// component and the module output that input needs, writing missing outputs if requested.
+func (t *tfWorkspaceStateUtility) AnalyzeComponentDependencies(request ComponentDependencyRequest) (*ComponentDependencyReport, error) {
+	root, err := tfconfigutil.LoadModule(t.hclParser, request.TerraformConfigFilesAbsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Terraform configuration, err: %v", err)
+	}
+
+	state, err := t.ReadWorkspaceState(request.TerraformConfigFilesAbsPath, request.StateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace state: %v", err)
+	}
+
+	report := &ComponentDependencyReport{}
+	assignment := request.Assignment
+
+	// module outputs each component already receives through module output references, keyed by the component and
+	// the name of the module call, with "*" standing for all outputs when the whole module object is passed
+	wired := make(map[[2]string]map[string]bool)
+	for _, name := range tfconfigutil.SortedKeys(root.ModuleCalls) {
+		moduleCall := root.ModuleCalls[name]
+		from := assignment.componentForModule(name)
+
+		var traversals []hcl.Traversal
+		for _, input := range moduleCall.Inputs {
+			traversals = append(traversals, input.Expr.Variables()...)
+		}
+		if moduleCall.ForEach != nil {
+			traversals = append(traversals, moduleCall.ForEach.Variables()...)
+		}
+		traversals = append(traversals, moduleCall.DependsOn...)
+
+		seen := make(map[string]bool)
+		for _, traversal := range traversals {
+			if traversal.RootName() != "module" || len(traversal) < 2 {
+				continue
+			}
+			attr, ok := traversal[1].(hcl.TraverseAttr)
+			if !ok {
+				continue
+			}
+
+			to := assignment.componentForModule(attr.Name)
+			if from == "" || to == "" || from == to {
+				continue
+			}
+			key := [2]string{from, attr.Name}
+			if wired[key] == nil {
+				wired[key] = make(map[string]bool)
+			}
+			// the output follows the module name, or the instance key of a module that uses count or for_each
+			output := "*"
+			for _, step := range traversal[2:min(len(traversal), 4)] {
+				if outputAttr, ok := step.(hcl.TraverseAttr); ok {
+					output = outputAttr.Name
+					break
+				}
+			}
+			wired[key][output] = true
+
+			if seen[attr.Name] {
+				continue
+			}
+			seen[attr.Name] = true
+			report.Edges = append(report.Edges, &ComponentDependencyEdge{
+				From:          "module." + name,
+				FromComponent: from,
+				To:            "module." + attr.Name,
+				ToComponent:   to,
+				Source:        dependencySourceConfig,
+				Wired:         true,
+			})
+		}
+	}
+
+	// the dependencies in the state are configuration addresses, so a dependency on a resource in a module that
+	// uses count or for_each stands for the resource in every instance of the module
+	resources := make(map[string][]*WorkspaceStateResource)
+	for _, resource := range state.Resources {
+		resources[resource.ConfigAddr()] = append(resources[resource.ConfigAddr()], resource)
+	}
+
+	children := make(map[string]*tfconfigutil.Module)
+	inputs := make(map[string]*ProposedComponentInput)
+	outputs := make(map[string]*ProposedModuleOutput)
+	unresolved := make(map[string]bool)
+
+	for _, resource := range state.Resources {
+		from := assignment.ComponentFor(resource)
+		if from == "" {
+			continue
+		}
+
+		dependencies := make(map[string]bool)
+		for _, instance := range resource.Instances {
+			for _, dependency := range instance.Dependencies {
+				dependencies[dependency] = true
+			}
+		}
+
+		// dependencies on resources that no longer exist are dropped on the next apply
+		for _, addr := range tfconfigutil.SortedKeys(dependencies) {
+			for _, dependency := range resources[addr] {
+				to := assignment.ComponentFor(dependency)
+				if to == "" || to == from {
+					continue
+				}
+
+				child, relAddr, err := t.dependencyModule(root, dependency, children)
+				if err != nil {
+					return nil, err
+				}
+
+				edge := &ComponentDependencyEdge{
+					From:          resource.Addr(),
+					FromComponent: from,
+					To:            dependency.Addr(),
+					ToComponent:   to,
+					Source:        dependencySourceState,
+					Wired:         dependencyWired(child, relAddr, wired[[2]string{from, topLevelModuleName(dependency.Module)}]),
+				}
+				report.Edges = append(report.Edges, edge)
+				if edge.Wired {
+					continue
+				}
+
+				output, err := t.outputForDependency(root, dependency, to, children, outputs)
+				if err != nil {
+					return nil, err
+				}
+				if output == nil {
+					unresolved[fmt.Sprintf("%s depends on %s, which is nested too deep in component %s to be exposed automatically", resource.Addr(), dependency.Addr(), to)] = true
+					continue
+				}
+
+				key := from + "\x00" + output.Component + "." + output.Name
+				input, ok := inputs[key]
+				if !ok {
+					input = &ProposedComponentInput{
+						Component: from,
+						Name:      output.Name,
+						Value:     fmt.Sprintf("component.%s.%s", output.Component, output.Name),
+					}
+					inputs[key] = input
+				}
+				if !slices.Contains(input.Dependents, resource.Addr()) {
+					input.Dependents = append(input.Dependents, resource.Addr())
+				}
+			}
+		}
+	}
+
+	for _, key := range tfconfigutil.SortedKeys(inputs) {
+		report.Inputs = append(report.Inputs, inputs[key])
+	}
+	for _, key := range tfconfigutil.SortedKeys(outputs) {
+		report.Outputs = append(report.Outputs, outputs[key])
+	}
+	report.Unresolved = tfconfigutil.SortedKeys(unresolved)
+
+	if request.WriteOutputs {
+		if err := writeProposedOutputs(report.Outputs); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// ComponentFor returns the name of the component the resource is assigned to, or the empty string if it is
+// not assigned to any component.
+func (a ComponentAssignment) ComponentFor(resource *WorkspaceStateResource) string {
+	if component, ok := a.ResourceAddressMap[resource.Addr()]; ok {
+		return componentNameFromAddress(component)
+	}
+	for _, instance := range resource.Instances {
+		if component, ok := a.ResourceAddressMap[resource.InstanceAddr(instance)]; ok {
+			return componentNameFromAddress(component)
+		}
+	}
+
+	matches := regexp.MustCompile(moduleCallNameExpression).FindStringSubmatch(resource.Module)
+	if matches == nil {
+		return ""
+	}
+	return a.componentForModule(matches[1])
+}
+
+// componentForModule returns the name of the component a top-level module is assigned to.
+func (a ComponentAssignment) componentForModule(name string) string {
+	if len(a.ResourceAddressMap) == 0 && len(a.ModuleAddressMap) == 0 {
+		return name
+	}
+	return a.ModuleAddressMap[name]
+}
+
+// componentNameFromAddress returns the component name of a stack address such as `component.app` or
+// `component.app["a"].aws_instance.web`. Components of embedded stacks are named by their configuration address,
+// for example `stack.net.component.vpc`, to tell them apart from root components of the same name.
+func componentNameFromAddress(addr string) string {
+	if strings.HasPrefix(addr, stackAddressPrefix) {
+		if parsed, err := ParseStackComponentAddress(addr); err == nil {
+			return parsed.ConfigAddr()
+		}
+	}
+	name := strings.TrimPrefix(addr, componentAddressPrefix)
+	if i := strings.IndexAny(name, ".["); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// outputForDependency returns the module output exposing a resource to other components, reusing an output the
+// module already declares where possible. It returns nil for resources in nested modules, which can only be exposed
+// by changing each module on the way.
+func (t *tfWorkspaceStateUtility) outputForDependency(root *tfconfigutil.Module, dependency *WorkspaceStateResource, component string, children map[string]*tfconfigutil.Module, outputs map[string]*ProposedModuleOutput) (*ProposedModuleOutput, error) {
+	child, relAddr, err := t.dependencyModule(root, dependency, children)
+	if err != nil || relAddr == "" {
+		return nil, err
+	}
+	dir := ""
+	if child != nil {
+		dir = child.Dir
+	}
+
+	key := component + "." + relAddr
+	if output, ok := outputs[key]; ok {
+		return output, nil
+	}
+
+	output := &ProposedModuleOutput{
+		Component: component,
+		Dir:       dir,
+		Name:      strings.ReplaceAll(relAddr, ".", "_"),
+		Value:     relAddr,
+	}
+
+	if child != nil {
+		// an output referring to the whole resource is the best match, any output referring to it will do
+		for _, name := range tfconfigutil.SortedKeys(child.Outputs) {
+			for _, traversal := range child.Outputs[name].Expr.Variables() {
+				ref := tfconfigutil.TraversalString(traversal)
+				if ref != relAddr && (output.Existing || !strings.HasPrefix(ref, relAddr+".")) {
+					continue
+				}
+				output.Name, output.Value, output.Existing = name, ref, true
+			}
+			if output.Existing && output.Value == relAddr {
+				break
+			}
+		}
+		if _, exists := child.Outputs[output.Name]; exists && !output.Existing {
+			output.Name += "_resource"
+		}
+	}
+
+	outputs[key] = output
+	return output, nil
+}
+
+// dependencyModule returns the top-level module a resource is declared in, loaded from its source if that is
+// available locally, and the address of the resource relative to that module. The module is nil for resources in
+// the root module or modules whose source is not available, and the address is empty for resources in nested
+// modules.
+func (t *tfWorkspaceStateUtility) dependencyModule(root *tfconfigutil.Module, dependency *WorkspaceStateResource, children map[string]*tfconfigutil.Module) (*tfconfigutil.Module, string, error) {
+	if dependency.Module == "" {
+		return nil, dependency.Addr(), nil
+	}
+
+	matches := regexp.MustCompile(moduleCallNameExpression).FindStringSubmatch(dependency.Module)
+	if matches == nil || strings.Contains(strings.TrimPrefix(dependency.Module, matches[0]), "module.") {
+		return nil, "", nil
+	}
+	relAddr := strings.TrimPrefix(dependency.Addr(), dependency.Module+".")
+
+	moduleName := matches[1]
+	if cached, ok := children[moduleName]; ok {
+		return cached, relAddr, nil
+	}
+	var child *tfconfigutil.Module
+	if moduleCall, ok := root.ModuleCalls[moduleName]; ok {
+		if childDir, ok := tfconfigutil.ResolveModuleCallDir(root.Dir, moduleCall); ok {
+			loaded, err := tfconfigutil.LoadModule(t.hclParser, childDir)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to load module %s, err: %v", moduleName, err)
+			}
+			child = loaded
+		}
+	}
+	children[moduleName] = child
+	return child, relAddr, nil
+}
+
+// dependencyWired reports whether one of the module outputs a component receives exposes the resource at relAddr
+// in the module.
+func dependencyWired(child *tfconfigutil.Module, relAddr string, wiredOutputs map[string]bool) bool {
+	if child == nil || relAddr == "" || len(wiredOutputs) == 0 {
+		return false
+	}
+	for name, output := range child.Outputs {
+		if !wiredOutputs["*"] && !wiredOutputs[name] {
+			continue
+		}
+		for _, traversal := range output.Expr.Variables() {
+			ref := tfconfigutil.TraversalString(traversal)
+			if ref == relAddr || strings.HasPrefix(ref, relAddr+".") || strings.HasPrefix(ref, relAddr+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// topLevelModuleName returns the name of the root module call a state module address belongs to, for example
+// "app" for `module.app["a"].module.db`, or the empty string for the root module.
+func topLevelModuleName(moduleAddr string) string {
+	matches := regexp.MustCompile(moduleCallNameExpression).FindStringSubmatch(moduleAddr)
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// writeProposedOutputs appends the outputs that do not exist yet to the outputs.tf file of their module.
+func writeProposedOutputs(outputs []*ProposedModuleOutput) error {
+	perDir := make(map[string][]*ProposedModuleOutput)
+	for _, output := range outputs {
+		if output.Existing || output.Dir == "" {
+			continue
+		}
+		perDir[output.Dir] = append(perDir[output.Dir], output)
+	}
+
+	for _, dir := range tfconfigutil.SortedKeys(perDir) {
+		path := filepath.Join(dir, moduleOutputsFileName)
+		content, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+
+		file := hclwrite.NewEmptyFile()
+		sort.Slice(perDir[dir], func(i, j int) bool {
+			return perDir[dir][i].Name < perDir[dir][j].Name
+		})
+		for _, output := range perDir[dir] {
+			file.Body().AppendNewline()
+			block := file.Body().AppendNewBlock("output", []string{output.Name})
+			block.Body().SetAttributeTraversal("value", tfconfigutil.TraversalFromAddr(output.Value))
+		}
+
+		// only the generated blocks are formatted, the existing content is kept as it is
+		generated := hclwrite.Format(bytes.TrimLeft(file.Bytes(), "\n"))
+		if len(bytes.TrimSpace(content)) > 0 {
+			if !bytes.HasSuffix(content, []byte("\n")) {
+				content = append(content, '\n')
+			}
+			generated = append(append(content, '\n'), generated...)
+		}
+		if err := os.WriteFile(path, generated, 0o644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+
+		for _, output := range perDir[dir] {
+			output.Written = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+const (
+	moduleInstanceExpression = `^module\.([^.\[]+)(\[(?:"(?:[^"\\]|\\.)*"|[0-9]+)\])?`
+)
+
+// ComponentInstancesMode describes how a module or component is instantiated, mirroring the Instances reported
+// by the FindStackConfigurationComponents RPC.
+type ComponentInstancesMode string
+
+const (
+	ComponentInstancesSingle  ComponentInstancesMode = "single"
+	ComponentInstancesCount   ComponentInstancesMode = "count"
+	ComponentInstancesForEach ComponentInstancesMode = "for_each"
+)
+
+// forEachFunctions are the functions available when evaluating the for_each expression of a component.
+var forEachFunctions = map[string]function.Function{
+	"concat":   stdlib.ConcatFunc,
+	"distinct": stdlib.DistinctFunc,
+	"keys":     stdlib.KeysFunc,
+	"merge":    stdlib.MergeFunc,
+	"setunion": stdlib.SetUnionFunc,
+	"tolist":   stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+	"tomap":    stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+	"toset":    stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+}
+
+// ComponentInstanceSet describes the instances of a top-level module in the workspace state and of the component
+// it is migrated into.
+type ComponentInstanceSet struct {
+	Component        string                 `json:"component"`
+	Mode             ComponentInstancesMode `json:"mode"`                    // Mode is how the module is instantiated in the workspace state.
+	Keys             []string               `json:"keys,omitempty"`          // Keys are the component instance keys of the module instances in the state, for example `["a"]`.
+	ForEach          bool                   `json:"for_each"`                // ForEach reports whether the component declares a for_each argument.
+	ForEachEvaluated bool                   `json:"for_each_evaluated"`      // ForEachEvaluated reports whether the for_each expression could be evaluated statically.
+	ForEachKeys      []string               `json:"for_each_keys,omitempty"` // ForEachKeys are the instance keys the for_each expression evaluates to.
+}
+
+// ComponentInstanceMappingReport is the result of mapping the module instances of a workspace state to component instances.
+type ComponentInstanceMappingReport struct {
+	Mapping    ComponentAssignment     `json:"mapping"`
+	Components []*ComponentInstanceSet `json:"components"`
+	Errors     []string                `json:"errors,omitempty"`
+	Warnings   []string                `json:"warnings,omitempty"`
+}
+
+// HasErrors reports whether the module instances cannot be migrated into the components as they are configured.
+func (r *ComponentInstanceMappingReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// stackComponent is a component block of the stack configuration.
+type stackComponent struct {
+	name    string
+	forEach hcl.Expression
+}
+
+// MapComponentInstances maps the top-level modules of a fully modular workspace state to the components of the
+// same name, like WorkspaceToStackAddressMap, while preserving the instance keys of modules that use count or
+// for_each. A module with a single instance is mapped through the module address map, the instances of a module
+// with several are mapped per resource instance, so `module.svc["a"].aws_instance.web` becomes
+// `component.svc["a"].aws_instance.web`. Count indexes become string keys, as components only support for_each.
+// The instance keys are validated against the for_each expression of the component where it can be evaluated from
+// literals and variable defaults.
+func (t *tfWorkspaceStateUtility) MapComponentInstances(request WorkspaceToStackAddressMapRequest) (*ComponentInstanceMappingReport, error) {
+	stackFiles, err := t.getStackFiles(request.StackSourceBundleAbsPath)
+	if err != nil {
+		return nil, err
+	}
+	components, variables, err := t.loadStackComponents(stackFiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("no components found in the stack files")
+	}
+
+	state, err := t.ReadWorkspaceState(request.TerraformConfigFilesAbsPath, request.StateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace state: %v", err)
+	}
+
+	moduleRegex := regexp.MustCompile(moduleInstanceExpression)
+	modules := make(map[string]*ComponentInstanceSet)
+	keyed := make(map[string][]*WorkspaceStateResource)
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		matches := moduleRegex.FindStringSubmatch(resource.Module)
+		if matches == nil {
+			return nil, fmt.Errorf("the Terraform state is not fully modular, resource %s is not in a module", resource.Addr())
+		}
+
+		name, key := matches[1], matches[2]
+		set, ok := modules[name]
+		if !ok {
+			set = &ComponentInstanceSet{Component: name, Mode: ComponentInstancesSingle}
+			modules[name] = set
+		}
+		if key == "" {
+			continue
+		}
+
+		set.Mode = ComponentInstancesForEach
+		if !strings.HasPrefix(key, `["`) {
+			set.Mode = ComponentInstancesCount
+		}
+		key = set.componentKey(key)
+		if !slices.Contains(set.Keys, key) {
+			set.Keys = append(set.Keys, key)
+		}
+		keyed[name] = append(keyed[name], resource)
+	}
+
+	var names []string
+	for name := range modules {
+		if _, ok := components[name]; !ok {
+			return nil, fmt.Errorf("the top-level module %s does not match any component", name)
+		}
+		names = append(names, name)
+	}
+	for name := range components {
+		if _, ok := modules[name]; !ok {
+			return nil, fmt.Errorf("the component %s does not match any top-level module", name)
+		}
+	}
+	sort.Strings(names)
+
+	report := &ComponentInstanceMappingReport{
+		Mapping: ComponentAssignment{
+			ResourceAddressMap: make(map[string]string),
+			ModuleAddressMap:   make(map[string]string),
+		},
+	}
+	for _, name := range names {
+		set := modules[name]
+		sort.Strings(set.Keys)
+		report.Components = append(report.Components, set)
+		report.validateInstances(set, components[name], variables)
+
+		if set.Mode == ComponentInstancesSingle {
+			report.Mapping.ModuleAddressMap[name] = name
+			continue
+		}
+		for _, resource := range keyed[name] {
+			for _, instance := range resource.Instances {
+				from := resource.InstanceAddr(instance)
+				matches := moduleRegex.FindStringSubmatch(from)
+				key := set.componentKey(matches[2])
+				report.Mapping.ResourceAddressMap[from] = fmt.Sprintf("component.%s%s%s", name, key, from[len(matches[0]):])
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// componentKey returns the component instance key of a module instance key.
+func (s *ComponentInstanceSet) componentKey(key string) string {
+	if s.Mode == ComponentInstancesCount {
+		return "[" + strconv.Quote(strings.Trim(key, "[]")) + "]"
+	}
+	return key
+}
+
+// validateInstances checks that the module instances in the state can be migrated into the component. A for_each
+// expression that refers to variables is evaluated with their default values, which the deployment inputs may
+// override, so the problems found with it are only reported as warnings.
+func (r *ComponentInstanceMappingReport) validateInstances(set *ComponentInstanceSet, component *stackComponent, variables map[string]cty.Value) {
+	set.ForEach = component.forEach != nil
+	switch {
+	case set.Mode == ComponentInstancesSingle && set.ForEach:
+		r.Errors = append(r.Errors, fmt.Sprintf("the component %s uses for_each, but module %s has a single instance in the state", set.Component, set.Component))
+		return
+	case set.Mode != ComponentInstancesSingle && !set.ForEach:
+		r.Errors = append(r.Errors, fmt.Sprintf("the module %s has %d instances in the state, but component %s does not use for_each", set.Component, len(set.Keys), set.Component))
+		return
+	case set.Mode == ComponentInstancesCount:
+		r.Warnings = append(r.Warnings, fmt.Sprintf("the module %s uses count, its instances are mapped to the string keys %s of component %s", set.Component, strings.Join(set.Keys, ", "), set.Component))
+	}
+	if !set.ForEach {
+		return
+	}
+
+	report := func(msg string) {
+		r.Errors = append(r.Errors, msg)
+	}
+	if len(component.forEach.Variables()) > 0 {
+		report = func(msg string) {
+			r.Warnings = append(r.Warnings, msg+", when evaluated with the variable defaults, check the deployment inputs")
+		}
+	}
+
+	keys, err := evaluateForEachKeys(component.forEach, variables)
+	if err != nil {
+		report(fmt.Sprintf("invalid for_each of component %s: %v", set.Component, err))
+		return
+	}
+	if keys == nil {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("the for_each of component %s cannot be evaluated statically, its instance keys were not validated", set.Component))
+		return
+	}
+	set.ForEachEvaluated = true
+	set.ForEachKeys = keys
+
+	for _, key := range set.Keys {
+		if !slices.Contains(keys, key) {
+			report(fmt.Sprintf("the state holds instance %s of module %s, but the for_each of component %s has no such key", key, set.Component, set.Component))
+		}
+	}
+	for _, key := range keys {
+		if !slices.Contains(set.Keys, key) {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("the instance %s of component %s has no state and will be created", key, set.Component))
+		}
+	}
+}
+
+// evaluateForEachKeys evaluates a component for_each expression and returns its instance keys in address form.
+// It returns nil without an error if the expression refers to anything other than variables with a default value.
+func evaluateForEachKeys(expr hcl.Expression, variables map[string]cty.Value) ([]string, error) {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "var" || len(traversal) < 2 {
+			return nil, nil
+		}
+		attr, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			return nil, nil
+		}
+		if _, ok := variables[attr.Name]; !ok {
+			return nil, nil
+		}
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(variables)},
+		Functions: forEachFunctions,
+	}
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return nil, nil
+	}
+	if !value.IsWhollyKnown() {
+		return nil, nil
+	}
+	if value.IsNull() {
+		return nil, fmt.Errorf("the for_each value is null")
+	}
+
+	var keys []string
+	ty := value.Type()
+	switch {
+	case ty.IsMapType() || ty.IsObjectType():
+		for it := value.ElementIterator(); it.Next(); {
+			key, _ := it.Element()
+			keys = append(keys, "["+strconv.Quote(key.AsString())+"]")
+		}
+	case ty.IsSetType():
+		if !ty.ElementType().Equals(cty.String) {
+			return nil, fmt.Errorf("the for_each value must be a map or a set of strings, got %s", ty.FriendlyName())
+		}
+		for it := value.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			if element.IsNull() {
+				return nil, fmt.Errorf("the for_each set must not contain null values")
+			}
+			keys = append(keys, "["+strconv.Quote(element.AsString())+"]")
+		}
+	default:
+		return nil, fmt.Errorf("the for_each value must be a map or a set of strings, got %s", ty.FriendlyName())
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// loadStackComponents returns the component blocks of the stack files and the default values of their variables.
+func (t *tfWorkspaceStateUtility) loadStackComponents(stackFiles []string) (map[string]*stackComponent, map[string]cty.Value, error) {
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "component", LabelNames: []string{"name"}},
+			{Type: "variable", LabelNames: []string{"name"}},
+		},
+	}
+	forEachSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "for_each"}},
+	}
+	defaultSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "default"}},
+	}
+
+	components := make(map[string]*stackComponent)
+	variables := make(map[string]cty.Value)
+	for _, filePath := range stackFiles {
+		file, diags := t.hclParser.ParseHCLFile(filePath)
+		if diags.HasErrors() {
+			return nil, nil, fmt.Errorf("failed to parse HCL file %s, err: %v", filePath, diags.Error())
+		}
+		if file == nil || file.Body == nil {
+			continue
+		}
+		content, _, diags := file.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+
+		for _, block := range content.Blocks {
+			switch block.Type {
+			case "component":
+				component := &stackComponent{name: block.Labels[0]}
+				attrs, _, _ := block.Body.PartialContent(forEachSchema)
+				if attr, ok := attrs.Attributes["for_each"]; ok {
+					component.forEach = attr.Expr
+				}
+				components[component.name] = component
+			case "variable":
+				attrs, _, _ := block.Body.PartialContent(defaultSchema)
+				attr, ok := attrs.Attributes["default"]
+				if !ok {
+					continue
+				}
+				if value, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+					variables[block.Labels[0]] = value
+				}
+			}
+		}
+	}
+
+	return components, variables, nil
+}
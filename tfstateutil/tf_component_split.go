@@ -0,0 +1,520 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	defaultMaxComponents        = 8
+	componentSplitFileFormat    = `component_split_%d.json`
+	dependencyAffinityWeight    = 3.0
+	typePrefixAffinityWeight    = 1.0
+	providerAffinityWeight      = 0.5
+	invalidComponentNameChars   = `[^a-zA-Z0-9_]`
+	defaultSplitComponentPrefix = `component`
+)
+
+// ComponentSplitRequest represents the request parameters for suggesting how to split a workspace into components.
+type ComponentSplitRequest struct {
+	StateFilePath               string // StateFilePath is an optional path to the state file, otherwise the state is pulled from the configured backend.
+	TerraformConfigFilesAbsPath string // TerraformConfigFilesAbsPath is the absolute path to the directory containing the root module.
+	MaxComponents               int    // MaxComponents is the largest number of components to propose, defaults to 8.
+	OutputDir                   string // OutputDir is an optional directory to write a mapping file for each proposal to.
+}
+
+// ComponentSplitProposal is a candidate split of a workspace into components.
+type ComponentSplitProposal struct {
+	Components          map[string][]string `json:"components"`            // Components maps each proposed component to the resources it holds.
+	Mapping             ComponentAssignment `json:"mapping"`               // Mapping is the assignment in the form MigrateTFState accepts.
+	CrossComponentEdges int                 `json:"cross_component_edges"` // CrossComponentEdges counts the resource dependencies that cross component boundaries.
+	Imbalance           float64             `json:"imbalance"`             // Imbalance is the share of resources the largest component holds beyond an even split, from 0 for equal sizes.
+	Score               float64             `json:"score"`                 // Score is the share of dependencies crossing component boundaries plus the imbalance, lower is better.
+	MappingFilePath     string              `json:"mapping_file_path,omitempty"`
+}
+
+// ComponentSplitReport lists the split proposals, one per number of components, ordered by their score.
+type ComponentSplitReport struct {
+	Resources int                       `json:"resources"`
+	Edges     int                       `json:"edges"`
+	Proposals []*ComponentSplitProposal `json:"proposals"`
+}
+
+// splitCluster is a group of resources that is kept together while clustering.
+type splitCluster struct {
+	Module    string // Module is the top-level module the resources belong to, empty for root module resources.
+	Resources []*WorkspaceStateResource
+	Prefixes  map[string]int
+	Providers map[string]int
+}
+
+// splitAffinity holds the affinity between the active clusters as adjacency maps, so that only the pairs with any
+// affinity are stored, together with a queue of candidate merges ordered by their score.
+type splitAffinity struct {
+	weights map[int]map[int]float64
+	queue   splitMergeQueue
+}
+
+// splitMerge is a candidate merge of two clusters. Entries whose score is out of date are skipped when popped.
+type splitMerge struct {
+	Pair  [2]int
+	Score float64
+}
+
+// splitMergeQueue is a max-heap of candidate merges, ties are broken by the lowest pair of cluster indexes.
+type splitMergeQueue []splitMerge
+
+func (q splitMergeQueue) Len() int { return len(q) }
+
+func (q splitMergeQueue) Less(i, j int) bool {
+	if q[i].Score != q[j].Score {
+		return q[i].Score > q[j].Score
+	}
+	if q[i].Pair[0] != q[j].Pair[0] {
+		return q[i].Pair[0] < q[j].Pair[0]
+	}
+	return q[i].Pair[1] < q[j].Pair[1]
+}
+
+func (q splitMergeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *splitMergeQueue) Push(x any) { *q = append(*q, x.(splitMerge)) }
+
+func (q *splitMergeQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// SuggestComponentSplit clusters the resources of a workspace state into candidate components. Resources of the
+// same top-level module always stay together, the remaining groups are merged by agglomerative clustering on their
+// affinity, which is driven by the dependencies between them and, to a lesser degree, shared resource type prefixes
+// and provider configurations. One proposal is made for every number of components from two up to MaxComponents,
+// and each is scored by the share of dependencies that would cross component boundaries and by how uneven the
+// component sizes are.
+func (t *tfWorkspaceStateUtility) SuggestComponentSplit(request ComponentSplitRequest) (*ComponentSplitReport, error) {
+	state, err := t.ReadWorkspaceState(request.TerraformConfigFilesAbsPath, request.StateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace state: %v", err)
+	}
+
+	maxComponents := request.MaxComponents
+	if maxComponents <= 0 {
+		maxComponents = defaultMaxComponents
+	}
+
+	clusters, clusterOf := initialSplitClusters(state)
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no managed resources found in the Terraform state")
+	}
+
+	edges := dependencyEdges(state)
+	report := &ComponentSplitReport{Edges: len(edges)}
+	for _, cluster := range clusters {
+		report.Resources += len(cluster.Resources)
+	}
+
+	affinity := newSplitAffinity(clusters, edges, clusterOf)
+	active := make(map[int]bool)
+	for i := range clusters {
+		active[i] = true
+	}
+
+	var proposals []*ComponentSplitProposal
+	for {
+		// a single component is no split at all, unless nothing can be split
+		if len(active) <= maxComponents && (len(active) > 1 || len(clusters) == 1) {
+			proposals = append(proposals, buildSplitProposal(clusters, active, edges, clusterOf))
+		}
+		if len(active) == 1 {
+			break
+		}
+
+		best, ok := affinity.popBest(clusters, active)
+		if !ok {
+			// without any affinity left, merge the two smallest clusters
+			keys := activeClusterKeys(active)
+			sort.SliceStable(keys, func(i, j int) bool {
+				return len(clusters[keys[i]].Resources) < len(clusters[keys[j]].Resources)
+			})
+			best = orderedPair(keys[0], keys[1])
+		}
+
+		mergeSplitClusters(clusters, active, affinity, best[0], best[1], clusterOf)
+	}
+
+	sort.SliceStable(proposals, func(i, j int) bool {
+		if proposals[i].Score != proposals[j].Score {
+			return proposals[i].Score < proposals[j].Score
+		}
+		return len(proposals[i].Components) > len(proposals[j].Components)
+	})
+	report.Proposals = proposals
+
+	if request.OutputDir != "" {
+		if err := os.MkdirAll(request.OutputDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", request.OutputDir, err)
+		}
+		for _, proposal := range proposals {
+			path := filepath.Join(request.OutputDir, fmt.Sprintf(componentSplitFileFormat, len(proposal.Components)))
+			if err := WriteComponentMappingFile(path, proposal.Mapping); err != nil {
+				return nil, err
+			}
+			proposal.MappingFilePath = path
+		}
+	}
+
+	return report, nil
+}
+
+// WriteComponentMappingFile writes a component assignment as JSON, in the form LoadComponentMappingFile reads.
+func WriteComponentMappingFile(path string, mapping ComponentAssignment) error {
+	raw, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode component mapping: %w", err)
+	}
+	if err := os.WriteFile(path, append(raw, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadComponentMappingFile reads a component assignment written by WriteComponentMappingFile. The maps can be
+// passed to MigrateTFState as they are.
+func LoadComponentMappingFile(path string) (ComponentAssignment, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ComponentAssignment{}, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	var mapping ComponentAssignment
+	if err := json.Unmarshal(raw, &mapping); err != nil {
+		return ComponentAssignment{}, fmt.Errorf("failed to decode component mapping %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// initialSplitClusters groups the managed resources by top-level module, every root module resource starts
+// in a cluster of its own. It also returns the index of the cluster of each resource address.
+func initialSplitClusters(state *WorkspaceState) ([]*splitCluster, map[string]int) {
+	var clusters []*splitCluster
+	clusterOf := make(map[string]int)
+	moduleClusters := make(map[string]int)
+	moduleRegex := regexp.MustCompile(moduleCallNameExpression)
+
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+
+		index := -1
+		if matches := moduleRegex.FindStringSubmatch(resource.Module); matches != nil {
+			if existing, ok := moduleClusters[matches[1]]; ok {
+				index = existing
+			} else {
+				moduleClusters[matches[1]] = len(clusters)
+				clusters = append(clusters, &splitCluster{Module: matches[1], Prefixes: make(map[string]int), Providers: make(map[string]int)})
+				index = len(clusters) - 1
+			}
+		} else {
+			clusters = append(clusters, &splitCluster{Prefixes: make(map[string]int), Providers: make(map[string]int)})
+			index = len(clusters) - 1
+		}
+
+		cluster := clusters[index]
+		cluster.Resources = append(cluster.Resources, resource)
+		cluster.Prefixes[resourceTypePrefix(resource.Type)]++
+		cluster.Providers[resource.Provider]++
+		clusterOf[resource.Addr()] = index
+	}
+
+	return clusters, clusterOf
+}
+
+// dependencyEdges returns the distinct dependencies between managed resources recorded in the state. The state
+// records dependencies by configuration address, so a dependency on a resource in a module that uses count or
+// for_each is an edge to the resource in every instance of the module.
+func dependencyEdges(state *WorkspaceState) [][2]string {
+	managed := make(map[string][]string)
+	for _, resource := range state.Resources {
+		if resource.Mode == "managed" {
+			managed[resource.ConfigAddr()] = append(managed[resource.ConfigAddr()], resource.Addr())
+		}
+	}
+
+	seen := make(map[[2]string]bool)
+	var edges [][2]string
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		for _, instance := range resource.Instances {
+			for _, dependency := range instance.Dependencies {
+				for _, addr := range managed[dependency] {
+					edge := [2]string{resource.Addr(), addr}
+					if seen[edge] {
+						continue
+					}
+					seen[edge] = true
+					edges = append(edges, edge)
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// newSplitAffinity computes the affinity between the initial clusters. Dependencies add to the affinity of the two
+// clusters they connect, resource type prefixes and provider configurations add to the affinity of the clusters
+// sharing them. Prefixes and providers every cluster shares do not tell the clusters apart and are skipped, which
+// keeps the affinity sparse.
+func newSplitAffinity(clusters []*splitCluster, edges [][2]string, clusterOf map[string]int) *splitAffinity {
+	affinity := &splitAffinity{weights: make(map[int]map[int]float64)}
+	for _, edge := range edges {
+		a, b := clusterOf[edge[0]], clusterOf[edge[1]]
+		if a != b {
+			affinity.add(a, b, dependencyAffinityWeight)
+		}
+	}
+
+	shared := func(keysOf func(cluster *splitCluster) map[string]int, weight float64) {
+		holders := make(map[string][]int)
+		for i, cluster := range clusters {
+			for key := range keysOf(cluster) {
+				holders[key] = append(holders[key], i)
+			}
+		}
+		for _, key := range tfconfigutil.SortedKeys(holders) {
+			indexes := holders[key]
+			if len(indexes) == len(clusters) {
+				continue
+			}
+			for i, a := range indexes {
+				for _, b := range indexes[i+1:] {
+					affinity.add(a, b, weight)
+				}
+			}
+		}
+	}
+	shared(func(cluster *splitCluster) map[string]int { return cluster.Prefixes }, typePrefixAffinityWeight)
+	shared(func(cluster *splitCluster) map[string]int { return cluster.Providers }, providerAffinityWeight)
+
+	for a, neighbours := range affinity.weights {
+		for b := range neighbours {
+			if a < b {
+				affinity.push(clusters, a, b)
+			}
+		}
+	}
+	return affinity
+}
+
+// add adds weight to the affinity between two clusters.
+func (s *splitAffinity) add(a, b int, weight float64) {
+	if s.weights[a] == nil {
+		s.weights[a] = make(map[int]float64)
+	}
+	if s.weights[b] == nil {
+		s.weights[b] = make(map[int]float64)
+	}
+	s.weights[a][b] += weight
+	s.weights[b][a] += weight
+}
+
+// score returns the affinity of two clusters relative to their size, so that one cluster does not absorb everything.
+func (s *splitAffinity) score(clusters []*splitCluster, a, b int) float64 {
+	return s.weights[a][b] / math.Sqrt(float64(len(clusters[a].Resources)*len(clusters[b].Resources)))
+}
+
+// push queues the merge of two clusters with their current score.
+func (s *splitAffinity) push(clusters []*splitCluster, a, b int) {
+	heap.Push(&s.queue, splitMerge{Pair: orderedPair(a, b), Score: s.score(clusters, a, b)})
+}
+
+// popBest returns the pair of active clusters with the highest score, skipping queued merges that are out of date.
+func (s *splitAffinity) popBest(clusters []*splitCluster, active map[int]bool) ([2]int, bool) {
+	for s.queue.Len() > 0 {
+		merge := heap.Pop(&s.queue).(splitMerge)
+		a, b := merge.Pair[0], merge.Pair[1]
+		if !active[a] || !active[b] {
+			continue
+		}
+		if _, ok := s.weights[a][b]; !ok || s.score(clusters, a, b) != merge.Score {
+			continue
+		}
+		return merge.Pair, true
+	}
+	return [2]int{}, false
+}
+
+// mergeSplitClusters merges cluster b into cluster a, moves the affinity of b over to a and queues the merges of a
+// with its neighbours at their new scores.
+func mergeSplitClusters(clusters []*splitCluster, active map[int]bool, affinity *splitAffinity, a, b int, clusterOf map[string]int) {
+	target, source := clusters[a], clusters[b]
+	target.Resources = append(target.Resources, source.Resources...)
+	for prefix, count := range source.Prefixes {
+		target.Prefixes[prefix] += count
+	}
+	for provider, count := range source.Providers {
+		target.Providers[provider] += count
+	}
+	if target.Module == "" || (source.Module != "" && len(source.Resources) > len(target.Resources)-len(source.Resources)) {
+		target.Module = source.Module
+	}
+	for _, resource := range source.Resources {
+		clusterOf[resource.Addr()] = a
+	}
+
+	for other, weight := range affinity.weights[b] {
+		delete(affinity.weights[other], b)
+		if other != a && active[other] {
+			affinity.add(a, other, weight)
+		}
+	}
+	delete(affinity.weights, b)
+	delete(affinity.weights[a], b)
+	delete(active, b)
+
+	for other := range affinity.weights[a] {
+		if active[other] {
+			affinity.push(clusters, a, other)
+		}
+	}
+}
+
+// buildSplitProposal turns the active clusters into a proposal with named components and a mapping.
+func buildSplitProposal(clusters []*splitCluster, active map[int]bool, edges [][2]string, clusterOf map[string]int) *ComponentSplitProposal {
+	proposal := &ComponentSplitProposal{
+		Components: make(map[string][]string),
+		Mapping: ComponentAssignment{
+			ResourceAddressMap: make(map[string]string),
+			ModuleAddressMap:   make(map[string]string),
+		},
+	}
+
+	taken := make(map[string]bool)
+	for _, index := range activeClusterKeys(active) {
+		cluster := clusters[index]
+		name := uniqueComponentName(splitClusterName(cluster), taken)
+
+		for _, resource := range cluster.Resources {
+			proposal.Components[name] = append(proposal.Components[name], resource.Addr())
+
+			matches := regexp.MustCompile(moduleCallNameExpression).FindStringSubmatch(resource.Module)
+			if matches != nil {
+				proposal.Mapping.ModuleAddressMap[matches[1]] = name
+				continue
+			}
+			// the keys of the resource map must include the instance keys
+			for _, instance := range resource.Instances {
+				proposal.Mapping.ResourceAddressMap[resource.InstanceAddr(instance)] = componentAddressPrefix + name
+			}
+		}
+		sort.Strings(proposal.Components[name])
+	}
+
+	for _, edge := range edges {
+		if clusterOf[edge[0]] != clusterOf[edge[1]] {
+			proposal.CrossComponentEdges++
+		}
+	}
+
+	total, largest := 0, 0
+	for _, resources := range proposal.Components {
+		total += len(resources)
+		largest = max(largest, len(resources))
+	}
+	if len(proposal.Components) > 1 {
+		even := float64(total) / float64(len(proposal.Components))
+		proposal.Imbalance = (float64(largest) - even) / (float64(total) - even)
+	}
+	proposal.Score = proposal.Imbalance
+	if len(edges) > 0 {
+		proposal.Score += float64(proposal.CrossComponentEdges) / float64(len(edges))
+	}
+
+	return proposal
+}
+
+// splitClusterName names a cluster after its largest module, or after its most common resource type prefix.
+func splitClusterName(cluster *splitCluster) string {
+	if cluster.Module != "" {
+		return cluster.Module
+	}
+
+	best := ""
+	for _, prefix := range tfconfigutil.SortedKeys(cluster.Prefixes) {
+		if best == "" || cluster.Prefixes[prefix] > cluster.Prefixes[best] {
+			best = prefix
+		}
+	}
+	if _, service, found := strings.Cut(best, "_"); found {
+		best = service
+	}
+	return best
+}
+
+// uniqueComponentName turns a name into a valid component name that is not taken yet.
+func uniqueComponentName(name string, taken map[string]bool) string {
+	name = regexp.MustCompile(invalidComponentNameChars).ReplaceAllString(name, "_")
+	if !hclsyntax.ValidIdentifier(name) {
+		name = defaultSplitComponentPrefix + "_" + name
+	}
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	taken[candidate] = true
+	return candidate
+}
+
+// resourceTypePrefix returns the provider and service part of a resource type, for example "aws_s3" for
+// "aws_s3_bucket_policy".
+func resourceTypePrefix(resourceType string) string {
+	parts := strings.SplitN(resourceType, "_", 3)
+	if len(parts) < 2 {
+		return resourceType
+	}
+	return parts[0] + "_" + parts[1]
+}
+
+// sharedWeight returns the number of keys two clusters have in common.
+func sharedWeight(a, b map[string]int) float64 {
+	shared := 0.0
+	for key := range a {
+		if _, ok := b[key]; ok {
+			shared++
+		}
+	}
+	return shared
+}
+
+func orderedPair(a, b int) [2]int {
+	if a > b {
+		return [2]int{b, a}
+	}
+	return [2]int{a, b}
+}
+
+func activeClusterKeys(active map[int]bool) []int {
+	keys := make([]int, 0, len(active))
+	for key := range active {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,432 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	remoteStateDataSourceType = `terraform_remote_state`
+	moduleCallNameExpression  = `^module\.([^.\[]+)`
+)
+
+// ReadinessSeverity classifies how a readiness finding affects a migration.
+type ReadinessSeverity string
+
+const (
+	// ReadinessSeverityBlocker marks a finding that must be resolved before the workspace can be migrated.
+	ReadinessSeverityBlocker ReadinessSeverity = "blocker"
+	// ReadinessSeverityWarning marks a finding that does not prevent the migration but needs attention.
+	ReadinessSeverityWarning ReadinessSeverity = "warning"
+)
+
+// ReadinessVerdict is the overall outcome of a migration readiness assessment.
+type ReadinessVerdict string
+
+const (
+	ReadinessVerdictReady             ReadinessVerdict = "ready"
+	ReadinessVerdictReadyWithWarnings ReadinessVerdict = "ready_with_warnings"
+	ReadinessVerdictNotReady          ReadinessVerdict = "not_ready"
+)
+
+// The checks performed by AssessMigrationReadiness.
+const (
+	ReadinessCheckProvisioner          = "provisioner"
+	ReadinessCheckRemoteState          = "remote_state"
+	ReadinessCheckBackend              = "backend"
+	ReadinessCheckDeposedObject        = "deposed_object"
+	ReadinessCheckTaintedObject        = "tainted_object"
+	ReadinessCheckRootModuleResource   = "root_module_resource"
+	ReadinessCheckProviderLock         = "provider_lock"
+	ReadinessCheckInvalidComponentName = "invalid_component_name"
+)
+
+// supportedBackends lists the backends whose state can still be read by the Terraform versions that provide the RPC API.
+// The remaining backends were deprecated and later removed from Terraform.
+var supportedBackends = mapset.NewSet[string](
+	"local", "remote", "cloud", "s3", "gcs", "azurerm", "consul", "cos", "http", "kubernetes", "oss", "pg",
+)
+
+// MigrationReadinessRequest represents the request parameters for assessing whether a workspace can be migrated to a stack.
+type MigrationReadinessRequest struct {
+	StateFilePath               string // StateFilePath is an optional path to the state file, otherwise the state is pulled from the configured backend.
+	TerraformConfigFilesAbsPath string // TerraformConfigFilesAbsPath is the absolute path to the directory containing Terraform configuration files.
+	DependencyLockFilePath      string // DependencyLockFilePath is an optional path to the dependency lock file, defaults to .terraform.lock.hcl in the configuration directory.
+}
+
+// ReadinessFinding represents a single blocker or warning found while assessing a workspace.
+type ReadinessFinding struct {
+	Severity ReadinessSeverity `json:"severity"`
+	Check    string            `json:"check"`
+	Address  string            `json:"address,omitempty"`
+	Summary  string            `json:"summary"`
+	Detail   string            `json:"detail,omitempty"`
+	Range    *hcl.Range        `json:"range,omitempty"`
+}
+
+// MigrationReadinessReport is the result of assessing whether a workspace can be migrated to a stack.
+type MigrationReadinessReport struct {
+	Verdict  ReadinessVerdict    `json:"verdict"`
+	Blockers int                 `json:"blockers"`
+	Warnings int                 `json:"warnings"`
+	Findings []*ReadinessFinding `json:"findings"`
+}
+
+// AssessMigrationReadiness inspects the classic Terraform configuration and state of a workspace and reports
+// the blockers and warnings that affect its migration to a stack, along with an overall readiness verdict.
+func (t *tfWorkspaceStateUtility) AssessMigrationReadiness(request MigrationReadinessRequest) (*MigrationReadinessReport, error) {
+	modules, err := t.loadLocalModuleTree(request.TerraformConfigFilesAbsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Terraform configuration, err: %v", err)
+	}
+
+	state, err := t.ReadWorkspaceState(request.TerraformConfigFilesAbsPath, request.StateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace state: %v", err)
+	}
+
+	lockFilePath := request.DependencyLockFilePath
+	if lockFilePath == "" {
+		lockFilePath = filepath.Join(request.TerraformConfigFilesAbsPath, tfconfigutil.DependencyLockFileName)
+	}
+
+	report := &MigrationReadinessReport{}
+	report.add(checkProvisioners(modules)...)
+	report.add(checkRemoteStateDataSources(modules, state)...)
+	report.add(checkBackend(modules[""])...)
+	report.add(checkResourceInstanceStatus(state)...)
+	report.add(t.checkRootModuleResources(state)...)
+
+	lockFindings, err := t.checkProviderLocks(modules, state, lockFilePath)
+	if err != nil {
+		return nil, err
+	}
+	report.add(lockFindings...)
+	report.add(checkComponentNames(modules[""], state)...)
+
+	switch {
+	case report.Blockers > 0:
+		report.Verdict = ReadinessVerdictNotReady
+	case report.Warnings > 0:
+		report.Verdict = ReadinessVerdictReadyWithWarnings
+	default:
+		report.Verdict = ReadinessVerdictReady
+	}
+
+	return report, nil
+}
+
+// add appends the findings to the report and updates the blocker and warning counts.
+func (r *MigrationReadinessReport) add(findings ...*ReadinessFinding) {
+	for _, finding := range findings {
+		if finding.Severity == ReadinessSeverityBlocker {
+			r.Blockers++
+		} else {
+			r.Warnings++
+		}
+		r.Findings = append(r.Findings, finding)
+	}
+}
+
+// loadLocalModuleTree loads the root module and, recursively, every child module called with a local source.
+// The returned map is keyed by the module path, with the empty string for the root module.
+func (t *tfWorkspaceStateUtility) loadLocalModuleTree(rootDir string) (map[string]*tfconfigutil.Module, error) {
+	modules := make(map[string]*tfconfigutil.Module)
+
+	var load func(modulePath string, dir string) error
+	load = func(modulePath string, dir string) error {
+		module, err := tfconfigutil.LoadModule(t.hclParser, dir)
+		if err != nil {
+			return err
+		}
+		modules[modulePath] = module
+
+		for _, name := range tfconfigutil.SortedKeys(module.ModuleCalls) {
+			moduleCall := module.ModuleCalls[name]
+			if !tfconfigutil.IsLocalModuleSource(moduleCall.Source) {
+				continue
+			}
+
+			childDir := filepath.Join(dir, moduleCall.Source)
+			if _, err := os.Stat(childDir); err != nil {
+				continue
+			}
+
+			childPath := "module." + name
+			if modulePath != "" {
+				childPath = modulePath + "." + childPath
+			}
+			if err := load(childPath, childDir); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := load("", rootDir); err != nil {
+		return nil, err
+	}
+
+	return modules, nil
+}
+
+// checkProvisioners reports every provisioner, since they run in the stack agent's environment rather than the workspace's.
+func checkProvisioners(modules map[string]*tfconfigutil.Module) []*ReadinessFinding {
+	var findings []*ReadinessFinding
+	for _, modulePath := range tfconfigutil.SortedKeys(modules) {
+		module := modules[modulePath]
+		for _, addr := range tfconfigutil.SortedKeys(module.ManagedResources) {
+			resource := module.ManagedResources[addr]
+			for _, provisioner := range resource.Provisioners {
+				findings = append(findings, &ReadinessFinding{
+					Severity: ReadinessSeverityWarning,
+					Check:    ReadinessCheckProvisioner,
+					Address:  joinModuleAddress(modulePath, addr),
+					Summary:  fmt.Sprintf("Resource uses a %q provisioner", provisioner.Type),
+					Detail:   "Provisioners are not run for migrated resources and will run in the stack's execution environment for new instances, where local files and network access may differ.",
+					Range:    provisioner.DeclRange.Ptr(),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkRemoteStateDataSources reports terraform_remote_state data sources found either in configuration or in state.
+func checkRemoteStateDataSources(modules map[string]*tfconfigutil.Module, state *WorkspaceState) []*ReadinessFinding {
+	var findings []*ReadinessFinding
+	reported := mapset.NewSet[string]()
+
+	for _, modulePath := range tfconfigutil.SortedKeys(modules) {
+		module := modules[modulePath]
+		for _, addr := range tfconfigutil.SortedKeys(module.DataResources) {
+			resource := module.DataResources[addr]
+			if resource.Type != remoteStateDataSourceType {
+				continue
+			}
+			absAddr := joinModuleAddress(modulePath, addr)
+			reported.Add(absAddr)
+			findings = append(findings, remoteStateFinding(absAddr, resource.DeclRange.Ptr()))
+		}
+	}
+
+	for _, resource := range state.Resources {
+		if resource.Mode != "data" || resource.Type != remoteStateDataSourceType {
+			continue
+		}
+		if reported.Contains(resource.Addr()) {
+			continue
+		}
+		reported.Add(resource.Addr())
+		findings = append(findings, remoteStateFinding(resource.Addr(), nil))
+	}
+
+	return findings
+}
+
+func remoteStateFinding(addr string, rng *hcl.Range) *ReadinessFinding {
+	return &ReadinessFinding{
+		Severity: ReadinessSeverityBlocker,
+		Check:    ReadinessCheckRemoteState,
+		Address:  addr,
+		Summary:  "Configuration reads another workspace through terraform_remote_state",
+		Detail:   "Stacks cannot read workspace state. The producer must be migrated into the same stack and referenced as a component, or linked through published outputs.",
+		Range:    rng,
+	}
+}
+
+// checkBackend reports backends whose state cannot be read by Terraform versions that support stacks.
+func checkBackend(root *tfconfigutil.Module) []*ReadinessFinding {
+	if root.Backend == nil || supportedBackends.Contains(root.Backend.Type) {
+		return nil
+	}
+
+	return []*ReadinessFinding{
+		{
+			Severity: ReadinessSeverityBlocker,
+			Check:    ReadinessCheckBackend,
+			Summary:  fmt.Sprintf("The %q backend is not supported", root.Backend.Type),
+			Detail:   "This backend was removed from Terraform. Migrate the state to a supported backend, or pass a local copy of the state file, before migrating the workspace.",
+			Range:    root.Backend.DeclRange.Ptr(),
+		},
+	}
+}
+
+// checkResourceInstanceStatus reports deposed and tainted resource instance objects.
+func checkResourceInstanceStatus(state *WorkspaceState) []*ReadinessFinding {
+	var findings []*ReadinessFinding
+	for _, resource := range state.Resources {
+		for _, instance := range resource.Instances {
+			addr := resource.InstanceAddr(instance)
+			switch {
+			case instance.Deposed != "":
+				findings = append(findings, &ReadinessFinding{
+					Severity: ReadinessSeverityBlocker,
+					Check:    ReadinessCheckDeposedObject,
+					Address:  addr,
+					Summary:  fmt.Sprintf("Resource instance has a deposed object %s", instance.Deposed),
+					Detail:   "Deposed objects are left behind by an incomplete create_before_destroy replacement. Run an apply in the workspace to clean them up before migrating.",
+				})
+			case instance.Status == "tainted":
+				findings = append(findings, &ReadinessFinding{
+					Severity: ReadinessSeverityWarning,
+					Check:    ReadinessCheckTaintedObject,
+					Address:  addr,
+					Summary:  "Resource instance is tainted",
+					Detail:   "The object will be migrated as damaged and replaced by the first stack apply.",
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkRootModuleResources reports resources declared directly in the root module.
+// Such a state can only be migrated into a stack with exactly one component.
+func (t *tfWorkspaceStateUtility) checkRootModuleResources(state *WorkspaceState) []*ReadinessFinding {
+	resources := state.ResourceInstanceAddresses()
+	if t.IsFullyModular(resources) {
+		return nil
+	}
+
+	var findings []*ReadinessFinding
+	for _, resource := range state.Resources {
+		if resource.Module != "" {
+			continue
+		}
+		findings = append(findings, &ReadinessFinding{
+			Severity: ReadinessSeverityWarning,
+			Check:    ReadinessCheckRootModuleResource,
+			Address:  resource.Addr(),
+			Summary:  "Resource is declared outside of a module",
+			Detail:   "A state that is not fully modular can only be mapped to a single component. Modularise the configuration first to split it into several components.",
+		})
+	}
+	return findings
+}
+
+// checkProviderLocks reports providers used by any module of the configuration or by the state that are missing
+// from the dependency lock file.
+func (t *tfWorkspaceStateUtility) checkProviderLocks(modules map[string]*tfconfigutil.Module, state *WorkspaceState, lockFilePath string) ([]*ReadinessFinding, error) {
+	if _, err := os.Stat(lockFilePath); os.IsNotExist(err) {
+		return []*ReadinessFinding{
+			{
+				Severity: ReadinessSeverityBlocker,
+				Check:    ReadinessCheckProviderLock,
+				Summary:  "Dependency lock file not found",
+				Detail:   fmt.Sprintf("No dependency lock file was found at %s. Run terraform init to create one, or synthesize one from the state and configuration.", lockFilePath),
+			},
+		}, nil
+	}
+
+	lockedProviders, err := tfconfigutil.LoadDependencyLockFile(t.hclParser, lockFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	usedProviders := make(map[string]*hcl.Range)
+	for _, modulePath := range tfconfigutil.SortedKeys(modules) {
+		module := modules[modulePath]
+		for _, localName := range module.ProviderLocalNames() {
+			source := module.ProviderSource(localName)
+			if usedProviders[source] != nil {
+				continue
+			}
+			var rng *hcl.Range
+			if requiredProvider, ok := module.RequiredProviders[localName]; ok {
+				rng = requiredProvider.DeclRange.Ptr()
+			}
+			usedProviders[source] = rng
+		}
+	}
+	var findings []*ReadinessFinding
+	for _, resource := range state.Resources {
+		providerAddr, err := ParseProviderConfigAddr(resource.Provider)
+		if err != nil {
+			findings = append(findings, &ReadinessFinding{
+				Severity: ReadinessSeverityBlocker,
+				Check:    ReadinessCheckProviderLock,
+				Address:  resource.Addr(),
+				Summary:  "Invalid provider address in state",
+				Detail:   fmt.Sprintf("The provider address %q of %s cannot be parsed: %s. Refresh the state with a current Terraform version to rewrite it.", resource.Provider, resource.Addr(), err),
+			})
+			continue
+		}
+		if _, ok := usedProviders[providerAddr.Source]; !ok {
+			usedProviders[providerAddr.Source] = nil
+		}
+	}
+
+	for _, source := range tfconfigutil.SortedKeys(usedProviders) {
+		if tfconfigutil.IsBuiltinProviderSource(source) {
+			continue
+		}
+		if _, ok := lockedProviders[source]; ok {
+			continue
+		}
+		findings = append(findings, &ReadinessFinding{
+			Severity: ReadinessSeverityBlocker,
+			Check:    ReadinessCheckProviderLock,
+			Address:  source,
+			Summary:  "Provider is missing from the dependency lock file",
+			Detail:   fmt.Sprintf("The provider %s is used by the workspace but has no entry in %s.", source, lockFilePath),
+			Range:    usedProviders[source],
+		})
+	}
+
+	return findings, nil
+}
+
+// checkComponentNames reports top-level module names that cannot be used as component names.
+func checkComponentNames(root *tfconfigutil.Module, state *WorkspaceState) []*ReadinessFinding {
+	names := make(map[string]*hcl.Range)
+	for name, moduleCall := range root.ModuleCalls {
+		names[name] = moduleCall.DeclRange.Ptr()
+	}
+
+	// instance keys of multi-instance modules are not part of the module name
+	moduleRegex := regexp.MustCompile(moduleCallNameExpression)
+	for _, resource := range state.ResourceInstanceAddresses() {
+		if matches := moduleRegex.FindStringSubmatch(resource); matches != nil {
+			if _, ok := names[matches[1]]; !ok {
+				names[matches[1]] = nil
+			}
+		}
+	}
+
+	var findings []*ReadinessFinding
+	for _, name := range tfconfigutil.SortedKeys(names) {
+		if hclsyntax.ValidIdentifier(name) {
+			continue
+		}
+		findings = append(findings, &ReadinessFinding{
+			Severity: ReadinessSeverityBlocker,
+			Check:    ReadinessCheckInvalidComponentName,
+			Address:  "module." + name,
+			Summary:  fmt.Sprintf("Module name %q is not a valid component name", name),
+			Detail:   "Component names must be valid identifiers: letters, digits, underscores and dashes, not starting with a digit.",
+			Range:    names[name],
+		})
+	}
+	return findings
+}
+
+// joinModuleAddress prefixes a module-relative address with its module path.
+func joinModuleAddress(modulePath string, addr string) string {
+	if modulePath == "" {
+		return addr
+	}
+	return modulePath + "." + addr
+}
@@ -0,0 +1,81 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+// ProviderRequirement collects what a workspace requires of one provider, from its configuration and its state.
+type ProviderRequirement struct {
+	Source      string   `json:"source"`
+	Constraints []string `json:"constraints,omitempty"` // Constraints are the distinct version constraints of the modules that require the provider.
+	InConfig    bool     `json:"in_config"`             // InConfig reports whether any module of the configuration refers to the provider.
+	InState     bool     `json:"in_state"`              // InState reports whether any resource in the state is managed by the provider.
+}
+
+// ConstraintString returns the constraints joined in the form used by the dependency lock file.
+func (r *ProviderRequirement) ConstraintString() string {
+	return strings.Join(r.Constraints, ", ")
+}
+
+// ProviderRequirements returns the providers required by the root module, its local child modules and the
+// resources in the state, keyed by their fully qualified source address. Built-in providers are not included.
+// The state is optional, it is only read if a state file path is given.
+func (t *tfWorkspaceStateUtility) ProviderRequirements(workingDir string, stateFilePath string) (map[string]*ProviderRequirement, error) {
+	modules, err := t.loadLocalModuleTree(workingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Terraform configuration, err: %v", err)
+	}
+
+	requirements := make(map[string]*ProviderRequirement)
+	requirement := func(source string) *ProviderRequirement {
+		if _, ok := requirements[source]; !ok {
+			requirements[source] = &ProviderRequirement{Source: source}
+		}
+		return requirements[source]
+	}
+
+	for _, path := range tfconfigutil.SortedKeys(modules) {
+		module := modules[path]
+		for _, localName := range module.ProviderLocalNames() {
+			source := module.ProviderSource(localName)
+			if tfconfigutil.IsBuiltinProviderSource(source) {
+				continue
+			}
+			req := requirement(source)
+			req.InConfig = true
+			if requiredProvider, ok := module.RequiredProviders[localName]; ok && requiredProvider.Requirement != "" {
+				if !slices.Contains(req.Constraints, requiredProvider.Requirement) {
+					req.Constraints = append(req.Constraints, requiredProvider.Requirement)
+				}
+			}
+		}
+	}
+
+	if stateFilePath == "" {
+		return requirements, nil
+	}
+
+	state, err := t.ReadWorkspaceState(workingDir, stateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace state: %v", err)
+	}
+	for _, resource := range state.Resources {
+		providerAddr, err := ParseProviderConfigAddr(resource.Provider)
+		if err != nil {
+			return nil, err
+		}
+		if tfconfigutil.IsBuiltinProviderSource(providerAddr.Source) {
+			continue
+		}
+		requirement(providerAddr.Source).InState = true
+	}
+
+	return requirements, nil
+}
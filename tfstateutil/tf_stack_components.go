@@ -0,0 +1,297 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-migrate-utility/tfconfigutil"
+)
+
+const (
+	stackAddressPrefix     = `stack.`
+	stackAddressStepExpr   = `^(stack|component)\.([A-Za-z_][A-Za-z0-9_-]*)(\[(?:"(?:[^"\\]|\\.)*"|[0-9]+)\])?`
+	maxEmbeddedStackDepth  = 16
+	localSourcePathPrefix  = `./`
+	parentSourcePathPrefix = `../`
+)
+
+// StackAddressStep is one step of a stack address, the name of an embedded stack or component and its optional instance key.
+type StackAddressStep struct {
+	Name string
+	Key  string // Key is the instance key as it appears in an address, for example `["a"]`, or empty for a single instance.
+}
+
+// StackComponentAddress is the address of a component instance, possibly inside embedded stacks, for example
+// `stack.net["a"].component.vpc`.
+type StackComponentAddress struct {
+	Stacks    []StackAddressStep // Stacks are the embedded stacks on the way to the component, outermost first.
+	Component StackAddressStep
+	Resource  string // Resource is the remainder of the address after the component, for example `aws_vpc.main`.
+}
+
+// ParseStackComponentAddress parses a component instance address, optionally followed by a resource address
+// within the component.
+func ParseStackComponentAddress(addr string) (*StackComponentAddress, error) {
+	stepRegex := regexp.MustCompile(stackAddressStepExpr)
+	parsed := &StackComponentAddress{}
+	rest := addr
+	for {
+		matches := stepRegex.FindStringSubmatch(rest)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid component address %q, expected a component address such as component.app or stack.net.component.vpc", addr)
+		}
+		step := StackAddressStep{Name: matches[2], Key: matches[3]}
+		rest = rest[len(matches[0]):]
+
+		if matches[1] == "stack" {
+			if !strings.HasPrefix(rest, ".") {
+				return nil, fmt.Errorf("invalid component address %q, the embedded stack %s is not followed by a component", addr, step.Name)
+			}
+			parsed.Stacks = append(parsed.Stacks, step)
+			rest = rest[1:]
+			continue
+		}
+
+		parsed.Component = step
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return nil, fmt.Errorf("invalid component address %q", addr)
+			}
+			parsed.Resource = rest[1:]
+		}
+		return parsed, nil
+	}
+}
+
+// String returns the component instance address, without the resource.
+func (a *StackComponentAddress) String() string {
+	var sb strings.Builder
+	for _, stack := range a.Stacks {
+		sb.WriteString(stackAddressPrefix + stack.Name + stack.Key + ".")
+	}
+	sb.WriteString(componentAddressPrefix + a.Component.Name + a.Component.Key)
+	return sb.String()
+}
+
+// ConfigAddr returns the address of the component in the stack configuration, without any instance keys.
+func (a *StackComponentAddress) ConfigAddr() string {
+	var sb strings.Builder
+	for _, stack := range a.Stacks {
+		sb.WriteString(stackAddressPrefix + stack.Name + ".")
+	}
+	sb.WriteString(componentAddressPrefix + a.Component.Name)
+	return sb.String()
+}
+
+// IsEmbedded reports whether the component is declared in an embedded stack rather than the root stack.
+func (a *StackComponentAddress) IsEmbedded() bool {
+	return len(a.Stacks) > 0
+}
+
+// ListStackComponents returns the configuration addresses of all components of the stack configuration, recursing
+// into the embedded stacks declared by `stack` blocks, for example `component.app` and `stack.net.component.vpc`.
+// Embedded stacks can only be followed if their source is a local path, use the FindStackConfigurationComponents
+// RPC through the state operations for stacks with remote sources.
+func (t *tfWorkspaceStateUtility) ListStackComponents(stackSourceBundleAbsPath string) ([]string, error) {
+	var components []string
+	if err := t.collectStackComponents(stackSourceBundleAbsPath, "", 0, &components); err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("no components found in the stack files")
+	}
+	sort.Strings(components)
+	return components, nil
+}
+
+// collectStackComponents appends the components of the stack in the given directory to the list, prefixing their
+// addresses with the address of the embedded stack.
+func (t *tfWorkspaceStateUtility) collectStackComponents(dir string, prefix string, depth int, components *[]string) error {
+	if depth > maxEmbeddedStackDepth {
+		return fmt.Errorf("embedded stacks are nested more than %d levels deep at %s", maxEmbeddedStackDepth, strings.TrimSuffix(prefix, "."))
+	}
+
+	stackFiles, err := t.getStackFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "component", LabelNames: []string{"name"}},
+			{Type: "stack", LabelNames: []string{"name"}},
+		},
+	}
+	sourceSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "source"}},
+	}
+
+	for _, filePath := range stackFiles {
+		file, diags := t.hclParser.ParseHCLFile(filePath)
+		if diags.HasErrors() {
+			return fmt.Errorf("failed to parse HCL file %s, err: %v", filePath, diags.Error())
+		}
+		if file == nil || file.Body == nil {
+			continue
+		}
+		content, _, diags := file.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		for _, block := range content.Blocks {
+			if block.Type == "component" {
+				*components = append(*components, prefix+componentAddressPrefix+block.Labels[0])
+				continue
+			}
+
+			stackAddr := prefix + stackAddressPrefix + block.Labels[0]
+			attrs, _, _ := block.Body.PartialContent(sourceSchema)
+			attr, ok := attrs.Attributes["source"]
+			if !ok {
+				return fmt.Errorf("the embedded stack %s has no source", stackAddr)
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || value.IsNull() || !value.Type().Equals(cty.String) {
+				return fmt.Errorf("the source of embedded stack %s must be a literal string", stackAddr)
+			}
+			source := value.AsString()
+			if !strings.HasPrefix(source, localSourcePathPrefix) && !strings.HasPrefix(source, parentSourcePathPrefix) {
+				return fmt.Errorf("the embedded stack %s has the remote source %s, its components can only be listed from the source bundle", stackAddr, source)
+			}
+
+			if err := t.collectStackComponents(filepath.Join(dir, source), stackAddr+".", depth+1, components); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateComponentTargets checks that every component targeted by the assignment is one of the given
+// components, which are configuration addresses as returned by ListStackComponents.
+func ValidateComponentTargets(assignment ComponentAssignment, components []string) []error {
+	known := make(map[string]bool, len(components))
+	for _, component := range components {
+		known[component] = true
+	}
+
+	var errs []error
+	check := func(kind string, from string, to string) {
+		target := to
+		if !strings.HasPrefix(to, componentAddressPrefix) && !strings.HasPrefix(to, stackAddressPrefix) {
+			target = componentAddressPrefix + to
+		}
+		addr, err := ParseStackComponentAddress(target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid target of %s %s: %w", kind, from, err))
+			return
+		}
+		if !known[addr.ConfigAddr()] {
+			errs = append(errs, fmt.Errorf("the %s %s targets %s, which is not a component of the stack configuration", kind, from, addr.ConfigAddr()))
+		}
+	}
+
+	for _, from := range tfconfigutil.SortedKeys(assignment.ModuleAddressMap) {
+		check("module", from, assignment.ModuleAddressMap[from])
+	}
+	for _, from := range tfconfigutil.SortedKeys(assignment.ResourceAddressMap) {
+		check("resource", from, assignment.ResourceAddressMap[from])
+	}
+	return errs
+}
+
+// QualifyEmbeddedTargets returns a copy of the assignment in the form MigrateTFState accepts. The module address
+// map only supports components of the root stack, so every module mapped to a component of an embedded stack,
+// such as `stack.net.component.vpc`, is replaced with an entry per resource instance of the module, mapped to its
+// fully qualified address within the component. The instances of a module that uses count or for_each keep their
+// module instance key as component instance key, like MapComponentInstances does, unless the target names a
+// component instance, which is only possible if the module has a single instance.
+func QualifyEmbeddedTargets(state *WorkspaceState, assignment ComponentAssignment) (ComponentAssignment, error) {
+	qualified := ComponentAssignment{
+		ResourceAddressMap: make(map[string]string, len(assignment.ResourceAddressMap)),
+		ModuleAddressMap:   make(map[string]string, len(assignment.ModuleAddressMap)),
+	}
+	for from, to := range assignment.ResourceAddressMap {
+		qualified.ResourceAddressMap[from] = to
+	}
+
+	embedded := make(map[string]*StackComponentAddress)
+	for name, to := range assignment.ModuleAddressMap {
+		if !strings.HasPrefix(to, stackAddressPrefix) {
+			qualified.ModuleAddressMap[name] = to
+			continue
+		}
+		addr, err := ParseStackComponentAddress(to)
+		if err != nil {
+			return ComponentAssignment{}, fmt.Errorf("invalid target of module %s: %w", name, err)
+		}
+		if addr.Resource != "" {
+			return ComponentAssignment{}, fmt.Errorf("the module %s must be mapped to a component, not to the resource %s", name, to)
+		}
+		embedded[name] = addr
+	}
+	if len(embedded) == 0 {
+		return qualified, nil
+	}
+
+	moduleRegex := regexp.MustCompile(moduleInstanceExpression)
+	moduleKeys := make(map[string]map[string]bool)
+	for _, resource := range state.Resources {
+		if matches := moduleRegex.FindStringSubmatch(resource.Module); matches != nil && matches[2] != "" {
+			if moduleKeys[matches[1]] == nil {
+				moduleKeys[matches[1]] = make(map[string]bool)
+			}
+			moduleKeys[matches[1]][matches[2]] = true
+		}
+	}
+
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		matches := moduleRegex.FindStringSubmatch(resource.Module)
+		if matches == nil {
+			continue
+		}
+		addr, ok := embedded[matches[1]]
+		if !ok {
+			continue
+		}
+
+		target := *addr
+		if matches[2] != "" {
+			if addr.Component.Key != "" && len(moduleKeys[matches[1]]) > 1 {
+				return ComponentAssignment{}, fmt.Errorf("the module %s has %d instances in the state, which cannot all be mapped to the component instance %s", matches[1], len(moduleKeys[matches[1]]), addr)
+			}
+			if addr.Component.Key == "" {
+				// count indexes become string keys, as components only support for_each
+				target.Component.Key = matches[2]
+				if !strings.HasPrefix(matches[2], `["`) {
+					target.Component.Key = "[" + strconv.Quote(strings.Trim(matches[2], "[]")) + "]"
+				}
+			}
+		}
+
+		for _, instance := range resource.Instances {
+			from := resource.InstanceAddr(instance)
+			if _, ok := qualified.ResourceAddressMap[from]; ok {
+				continue
+			}
+			qualified.ResourceAddressMap[from] = target.String() + from[len(matches[0]):]
+		}
+	}
+
+	return qualified, nil
+}
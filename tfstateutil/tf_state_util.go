@@ -37,9 +37,16 @@ type tfWorkspaceStateUtility struct {
 
 // TfWorkspaceStateUtility defines the interface for utility functions related to Terraform workspace state.
 type TfWorkspaceStateUtility interface {
+	AnalyzeComponentDependencies(request ComponentDependencyRequest) (*ComponentDependencyReport, error)
+	AssessMigrationReadiness(request MigrationReadinessRequest) (*MigrationReadinessReport, error)
 	IsFullyModular(resources []string) bool
 	ListAllResourcesFromWorkspaceState(workingDir string) ([]string, error)
 	ListAllResourcesFromWorkspaceStateWithStateFile(workingDir string, stateFilePath string) ([]string, error)
+	ListStackComponents(stackSourceBundleAbsPath string) ([]string, error)
+	MapComponentInstances(request WorkspaceToStackAddressMapRequest) (*ComponentInstanceMappingReport, error)
+	ProviderRequirements(workingDir string, stateFilePath string) (map[string]*ProviderRequirement, error)
+	ReadWorkspaceState(workingDir string, stateFilePath string) (*WorkspaceState, error)
+	SuggestComponentSplit(request ComponentSplitRequest) (*ComponentSplitReport, error)
 	WorkspaceToStackAddressMap(request WorkspaceToStackAddressMapRequest) (map[string]string, error)
 }
 
@@ -64,28 +71,9 @@ func (t *tfWorkspaceStateUtility) IsFullyModular(resources []string) bool {
 // ListAllResourcesFromWorkspaceState lists all resources from the Terraform workspace state in the specified working directory.
 // It executes the `terraform state list` command and returns the resources as a slice of strings
 func (t *tfWorkspaceStateUtility) ListAllResourcesFromWorkspaceState(workingDir string) ([]string, error) {
-	cmd := exec.CommandContext(t.ctx, "terraform", "state", "list")
-	cmd.Dir = workingDir
-
-	// Remove TF_LOG and TF_CLI_CONFIG_FILE from the environment for this command
-	// (preserve all other environment variables)
-	env := os.Environ()
-	var filteredEnv []string
-	for _, e := range env {
-		if !strings.HasPrefix(e, "TF_LOG=") || !strings.HasPrefix(e, "TF_CLI_CONFIG_FILE=") {
-			filteredEnv = append(filteredEnv, e)
-		}
-	}
-	cmd.Env = filteredEnv
-
-	// Capture only stdout
-	output, err := cmd.Output()
+	output, err := t.runStateCommand(workingDir, "list")
 	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return nil, fmt.Errorf("failed to run terraform state list: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("failed to run terraform state list: %w", err)
+		return nil, err
 	}
 
 	// Convert to string and split by line
@@ -107,10 +95,25 @@ func (t *tfWorkspaceStateUtility) ListAllResourcesFromWorkspaceStateWithStateFil
 		return nil, fmt.Errorf("state file %s does not exist", stateFilePath)
 	}
 
-	args := []string{"state", "list"}
-	args = append(args, "-state="+stateFilePath)
+	output, err := t.runStateCommand(workingDir, "list", "-state="+stateFilePath)
+	if err != nil {
+		return nil, err
+	}
 
-	cmd := exec.CommandContext(t.ctx, "terraform", args...)
+	// Convert to string and split by line
+	resources := strings.Split(strings.TrimSpace(string(output)), "\n")
+
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resources found in the Terraform state")
+	}
+
+	return resources, nil
+}
+
+// runStateCommand runs a `terraform state` subcommand in the specified working directory and returns its stdout.
+// The listing and the state reads share it so that they see the workspace through the same environment.
+func (t *tfWorkspaceStateUtility) runStateCommand(workingDir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(t.ctx, "terraform", append([]string{"state"}, args...)...)
 	cmd.Dir = workingDir
 
 	// Remove TF_LOG and TF_CLI_CONFIG_FILE from the environment for this command
@@ -118,7 +121,7 @@ func (t *tfWorkspaceStateUtility) ListAllResourcesFromWorkspaceStateWithStateFil
 	env := os.Environ()
 	var filteredEnv []string
 	for _, e := range env {
-		if !strings.HasPrefix(e, "TF_LOG=") || !strings.HasPrefix(e, "TF_CLI_CONFIG_FILE=") {
+		if !strings.HasPrefix(e, "TF_LOG=") && !strings.HasPrefix(e, "TF_CLI_CONFIG_FILE=") {
 			filteredEnv = append(filteredEnv, e)
 		}
 	}
@@ -129,19 +132,11 @@ func (t *tfWorkspaceStateUtility) ListAllResourcesFromWorkspaceStateWithStateFil
 	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
-			return nil, fmt.Errorf("failed to run terraform state list: %s", string(exitErr.Stderr))
+			return nil, fmt.Errorf("failed to run terraform state %s: %s", args[0], string(exitErr.Stderr))
 		}
-		return nil, fmt.Errorf("failed to run terraform state list: %w", err)
-	}
-
-	// Convert to string and split by line
-	resources := strings.Split(strings.TrimSpace(string(output)), "\n")
-
-	if len(resources) == 0 {
-		return nil, fmt.Errorf("no resources found in the Terraform state")
+		return nil, fmt.Errorf("failed to run terraform state %s: %w", args[0], err)
 	}
-
-	return resources, nil
+	return output, nil
 }
 
 // WorkspaceToStackAddressMap creates a mapping of workspace resources to stack addresses based on the provided Terraform configuration files and stack source bundle path.
@@ -212,6 +207,13 @@ func (t *tfWorkspaceStateUtility) WorkspaceToStackAddressMap(request WorkspaceTo
 		return nil, fmt.Errorf("failed to get top-level modules, err: %v", err)
 	}
 
+	// modules with several instances must keep their instance keys, which only MapComponentInstances preserves
+	for _, topLevelModule := range topLevelModules.ToSlice() {
+		if strings.Contains(topLevelModule, "[") {
+			return nil, fmt.Errorf("the top-level module %s uses count or for_each, use MapComponentInstances to map its instances", topLevelModule)
+		}
+	}
+
 	// 6. components name must match the top-level module names
 	if topLevelModules.SymmetricDifference(componentsSet).Cardinality() != 0 {
 		return nil, fmt.Errorf("the top-level modules %v do not match the components %v", topLevelModules.ToSlice(), componentsSet.ToSlice())
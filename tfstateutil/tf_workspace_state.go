@@ -0,0 +1,222 @@
+// Copyright IBM Corp. 2025
+// SPDX-License-Identifier: MPL-2.0
+
+package tfstateutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	workspaceStateFormatVersion  = 4
+	providerConfigAddrExpression = `^((?:module\.[^.\[]+(?:\[[^\]]+\])?\.)*)provider\["([^"]+)"\](?:\.(.+))?$`
+	moduleInstanceKeyExpression  = `(module\.[^.\[]+)\[(?:"(?:[^"\\]|\\.)*"|[0-9]+)\]`
+)
+
+// WorkspaceState represents a Terraform workspace state file in the version 4 format.
+type WorkspaceState struct {
+	Version          int                              `json:"version"`
+	TerraformVersion string                           `json:"terraform_version"`
+	Serial           uint64                           `json:"serial"`
+	Lineage          string                           `json:"lineage"`
+	Outputs          map[string]*WorkspaceStateOutput `json:"outputs"`
+	Resources        []*WorkspaceStateResource        `json:"resources"`
+	CheckResults     json.RawMessage                  `json:"check_results"`
+}
+
+// WorkspaceStateOutput represents a root module output value in a workspace state file.
+type WorkspaceStateOutput struct {
+	Value     json.RawMessage `json:"value"`
+	Type      json.RawMessage `json:"type"`
+	Sensitive bool            `json:"sensitive,omitempty"`
+}
+
+// WorkspaceStateResource represents a resource and all of its instances in a workspace state file.
+type WorkspaceStateResource struct {
+	Module    string                    `json:"module,omitempty"`
+	Mode      string                    `json:"mode"`
+	Type      string                    `json:"type"`
+	Name      string                    `json:"name"`
+	EachMode  string                    `json:"each,omitempty"`
+	Provider  string                    `json:"provider"`
+	Instances []*WorkspaceStateInstance `json:"instances"`
+}
+
+// WorkspaceStateInstance represents a single resource instance object in a workspace state file.
+// Deposed objects are represented as separate instances with the Deposed key set.
+type WorkspaceStateInstance struct {
+	IndexKey              json.RawMessage   `json:"index_key,omitempty"`
+	Status                string            `json:"status,omitempty"`
+	Deposed               string            `json:"deposed,omitempty"`
+	SchemaVersion         uint64            `json:"schema_version"`
+	AttributesRaw         json.RawMessage   `json:"attributes,omitempty"`
+	AttributesFlat        map[string]string `json:"attributes_flat,omitempty"`
+	SensitiveAttributes   json.RawMessage   `json:"sensitive_attributes,omitempty"`
+	IdentitySchemaVersion uint64            `json:"identity_schema_version,omitempty"`
+	IdentityRaw           json.RawMessage   `json:"identity,omitempty"`
+	PrivateRaw            []byte            `json:"private,omitempty"`
+	Dependencies          []string          `json:"dependencies,omitempty"`
+	CreateBeforeDestroy   bool              `json:"create_before_destroy,omitempty"`
+}
+
+// ProviderConfigAddr represents an absolute provider configuration address as recorded in state,
+// for example `module.net.provider["registry.terraform.io/hashicorp/aws"].east`.
+type ProviderConfigAddr struct {
+	Module string
+	Source string
+	Alias  string
+}
+
+// ParseWorkspaceState decodes the raw bytes of a version 4 Terraform state file.
+func ParseWorkspaceState(raw []byte) (*WorkspaceState, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, fmt.Errorf("the Terraform state is empty")
+	}
+
+	state := &WorkspaceState{}
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("failed to decode Terraform state, err: %w", err)
+	}
+
+	if state.Version != workspaceStateFormatVersion {
+		return nil, fmt.Errorf("unsupported Terraform state format version %d, expected %d", state.Version, workspaceStateFormatVersion)
+	}
+
+	return state, nil
+}
+
+// ReadWorkspaceState reads the Terraform state of the workspace in the specified working directory.
+// If stateFilePath is set the state file is read directly, otherwise the state is pulled through the same
+// `terraform state` invocation the resource listing uses.
+func (t *tfWorkspaceStateUtility) ReadWorkspaceState(workingDir string, stateFilePath string) (*WorkspaceState, error) {
+	if stateFilePath != "" {
+		raw, err := os.ReadFile(stateFilePath)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("state file %s does not exist", stateFilePath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state file %s: %w", stateFilePath, err)
+		}
+		return ParseWorkspaceState(raw)
+	}
+
+	output, err := t.runStateCommand(workingDir, "pull")
+	if err != nil {
+		return nil, err
+	}
+	return ParseWorkspaceState(output)
+}
+
+// Addr returns the absolute address of the resource, for example `module.app.aws_instance.web`.
+func (r *WorkspaceStateResource) Addr() string {
+	var sb strings.Builder
+	if r.Module != "" {
+		sb.WriteString(r.Module)
+		sb.WriteString(".")
+	}
+	if r.Mode == "data" {
+		sb.WriteString("data.")
+	}
+	sb.WriteString(r.Type)
+	sb.WriteString(".")
+	sb.WriteString(r.Name)
+	return sb.String()
+}
+
+// ConfigAddr returns the address of the resource in the configuration, without the instance keys of the modules
+// it is in, for example `module.app.aws_instance.web` for a resource in `module.app["a"]`. The dependencies
+// recorded in the state use this form.
+func (r *WorkspaceStateResource) ConfigAddr() string {
+	return ModuleConfigAddr(r.Addr())
+}
+
+// ModuleConfigAddr strips the module instance keys from an absolute address, for example `module.app.module.db`
+// for `module.app["a"].module.db[0]`.
+func ModuleConfigAddr(addr string) string {
+	return regexp.MustCompile(moduleInstanceKeyExpression).ReplaceAllString(addr, "$1")
+}
+
+// InstanceAddr returns the absolute address of the given instance of the resource, for example `aws_instance.web[0]`.
+func (r *WorkspaceStateResource) InstanceAddr(instance *WorkspaceStateInstance) string {
+	return r.Addr() + instance.IndexKeyString()
+}
+
+// IndexKeyString renders the instance key as it appears in an address, for example `[0]` or `["a"]`.
+// It returns the empty string for instances of resources that use neither count nor for_each.
+func (i *WorkspaceStateInstance) IndexKeyString() string {
+	if len(i.IndexKey) == 0 || string(i.IndexKey) == "null" {
+		return ""
+	}
+
+	var key interface{}
+	if err := json.Unmarshal(i.IndexKey, &key); err != nil {
+		return ""
+	}
+
+	switch k := key.(type) {
+	case string:
+		return "[" + strconv.Quote(k) + "]"
+	case float64:
+		return "[" + strconv.FormatFloat(k, 'f', -1, 64) + "]"
+	default:
+		return ""
+	}
+}
+
+// ResourceInstanceAddresses returns the absolute addresses of all resource instances in the state,
+// in the same form as the output of `terraform state list`. Deposed objects are not listed separately.
+func (s *WorkspaceState) ResourceInstanceAddresses() []string {
+	var addresses []string
+	seen := make(map[string]struct{})
+	for _, resource := range s.Resources {
+		for _, instance := range resource.Instances {
+			addr := resource.InstanceAddr(instance)
+			if _, ok := seen[addr]; ok {
+				continue
+			}
+			seen[addr] = struct{}{}
+			addresses = append(addresses, addr)
+		}
+	}
+	return addresses
+}
+
+// ParseProviderConfigAddr parses an absolute provider configuration address as recorded in the state.
+func ParseProviderConfigAddr(addr string) (ProviderConfigAddr, error) {
+	matches := regexp.MustCompile(providerConfigAddrExpression).FindStringSubmatch(addr)
+	if matches == nil {
+		return ProviderConfigAddr{}, fmt.Errorf("invalid provider configuration address %q", addr)
+	}
+
+	return ProviderConfigAddr{
+		Module: strings.TrimSuffix(matches[1], "."),
+		Source: matches[2],
+		Alias:  matches[3],
+	}, nil
+}
+
+// String returns the provider configuration address in the same form as recorded in the state.
+func (p ProviderConfigAddr) String() string {
+	var sb strings.Builder
+	if p.Module != "" {
+		sb.WriteString(p.Module)
+		sb.WriteString(".")
+	}
+	sb.WriteString(fmt.Sprintf("provider[%q]", p.Source))
+	if p.Alias != "" {
+		sb.WriteString(".")
+		sb.WriteString(p.Alias)
+	}
+	return sb.String()
+}
+
+// Type returns the provider type, the last segment of the provider source address.
+func (p ProviderConfigAddr) Type() string {
+	return p.Source[strings.LastIndex(p.Source, "/")+1:]
+}